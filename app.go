@@ -2,30 +2,79 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // App struct
 type App struct {
-	ctx          context.Context
-	cancelUpload context.CancelFunc
+	ctx             context.Context
+	cancelUpload    context.CancelFunc
+	categories      *CategoryCache
+	shutdownTracing func(context.Context) error
+
+	// Tray mode, see tray.go. Set from tray goroutines and read on the UI thread.
+	tray     atomic.Pointer[trayIcon]
+	trayOnce sync.Once
+	quitting atomic.Bool
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
-	return &App{}
+	return &App{categories: NewCategoryCache(0)}
 }
 
 // startup is called when the app starts. The context is saved
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+
+	config, err := LoadConfig()
+	if err != nil {
+		config = &Config{}
+	}
+	SetupLogging(config.Logging, os.Stderr)
+	a.categories.SetTTL(time.Duration(config.CategoryCacheMinutes) * time.Minute)
+	a.categories.Start()
+
+	// Pick up edits made to config.json while the app is running
+	configStore.OnChange(func() {
+		if config, err := LoadConfig(); err == nil {
+			a.categories.SetTTL(time.Duration(config.CategoryCacheMinutes) * time.Minute)
+			SetLogLevel(config.Logging.Level)
+		}
+		runtime.EventsEmit(a.ctx, "config-changed")
+	})
+	configStore.Start()
+
+	if config.TrayMode {
+		a.startTray()
+	}
+
+	// Traces are only exported when an OTLP endpoint is configured
+	if a.shutdownTracing, err = SetupTracing(config.Tracing, "ThereforeSharer"); err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+	}
+}
+
+// shutdown is called when the app exits, flushing pending traces
+func (a *App) shutdown(ctx context.Context) {
+	if a.shutdownTracing != nil {
+		a.shutdownTracing(ctx)
+	}
+	if t := a.tray.Load(); t != nil {
+		t.end()
+	}
 }
 
 // ==================== Configuration Methods ====================
@@ -37,7 +86,15 @@ func (a *App) GetConfig() (*Config, error) {
 
 // SaveConfig saves the configuration
 func (a *App) SaveConfig(config *Config) error {
-	return config.SaveConfig()
+	if err := config.SaveConfig(); err != nil {
+		return err
+	}
+	a.categories.SetTTL(time.Duration(config.CategoryCacheMinutes) * time.Minute)
+	SetLogLevel(config.Logging.Level)
+	if config.TrayMode {
+		a.startTray()
+	}
+	return nil
 }
 
 // SetAuthCredentials saves authentication credentials
@@ -58,6 +115,138 @@ func (a *App) SetAuthCredentials(authType, username, password, token string) err
 	return SetAuthToken(authToken)
 }
 
+// ==================== Settings Bundles ====================
+
+// desktopSettings is the config with the secrets kept in the system keychain, as
+// exported to and imported from settings bundles
+type desktopSettings struct {
+	*Config
+	AuthToken    string `json:"auth_token,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+}
+
+func loadDesktopSettings() (*desktopSettings, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.PolicyLocked = nil // Not a setting
+	settings := &desktopSettings{Config: config}
+	if settings.AuthToken, err = GetAuthToken(); err != nil {
+		return nil, err
+	}
+	if settings.SMTPPassword, err = GetSMTPPassword(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// ExportSettings saves the settings as a bundle file chosen in a save dialog. With a
+// passphrase the stored credentials are included, encrypted. It returns the path, or ""
+// if the dialog was cancelled.
+func (a *App) ExportSettings(passphrase string) (string, error) {
+	settings, err := loadDesktopSettings()
+	if err != nil {
+		return "", err
+	}
+	tree, err := settingsTree(settings)
+	if err != nil {
+		return "", err
+	}
+	bundle, err := newSettingsBundle("desktop", tree, passphrase)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Settings",
+		DefaultFilename: "ThereforeSharer-settings.json",
+		Filters:         []runtime.FileFilter{{DisplayName: "Settings Bundle (*.json)", Pattern: "*.json"}},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to save settings: %w", err)
+	}
+	slog.Info("Exported settings", "path", path, "credentials", bundle.Credentials != nil)
+	return path, nil
+}
+
+// SelectSettingsBundle opens a file dialog for choosing a bundle to import, "" if cancelled
+func (a *App) SelectSettingsBundle() (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Import Settings",
+		Filters: []runtime.FileFilter{{DisplayName: "Settings Bundle (*.json)", Pattern: "*.json"}},
+	})
+}
+
+// PreviewSettingsImport reports what importing a bundle would change, without saving
+func (a *App) PreviewSettingsImport(req SettingsImportRequest) (*ImportPreview, error) {
+	preview, _, err := prepareSettingsImport(req)
+	return preview, err
+}
+
+// ImportSettings saves the settings from a bundle, refusing bundles that would leave
+// the config invalid
+func (a *App) ImportSettings(req SettingsImportRequest) (*ImportPreview, error) {
+	preview, imported, err := prepareSettingsImport(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(preview.Errors) > 0 {
+		return preview, &ValidationError{Fields: preview.Errors}
+	}
+
+	if err := a.SaveConfig(imported.Config); err != nil {
+		return nil, err
+	}
+	if preview.CredentialsApplied {
+		if imported.AuthToken != "" {
+			if err := SetAuthToken(imported.AuthToken); err != nil {
+				return nil, fmt.Errorf("failed to store auth token: %w", err)
+			}
+		}
+		if imported.SMTPPassword != "" {
+			if err := SetSMTPPassword(imported.SMTPPassword); err != nil {
+				return nil, fmt.Errorf("failed to store SMTP password: %w", err)
+			}
+		}
+	}
+	slog.Info("Imported settings", "path", req.Path, "profile", req.Profile, "changes", len(preview.Changes))
+	return preview, nil
+}
+
+func prepareSettingsImport(req SettingsImportRequest) (*ImportPreview, *desktopSettings, error) {
+	data, err := os.ReadFile(req.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read settings bundle: %w", err)
+	}
+	bundle, err := parseSettingsBundle(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := loadDesktopSettings()
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := settingsTree(current)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	imported := &desktopSettings{Config: &Config{}}
+	preview, err := bundle.importInto(tree, req, imported)
+	if err != nil {
+		return nil, nil, err
+	}
+	return preview, imported, nil
+}
+
 // ==================== Category Selection ====================
 
 // TestConnectionRequest represents a request to test connection or get categories
@@ -97,81 +286,267 @@ func (a *App) GetCategories(req TestConnectionRequest) ([]CategoryInfo, error) {
 		authToken = storedToken
 	}
 
-	client := NewThereforeAPIClient(req.BaseURL, req.TenantName, authToken)
-	
-	treeViews, err := client.GetCategoriesTree()
+	client := NewThereforeAPIClient(req.BaseURL, req.TenantName, authToken).WithContext(WithRequestID(a.ctx, NewRequestID()))
+
+	// Loading categories from settings always fetches the current tree
+	index, err := a.categories.Get(client, true)
 	if err != nil {
-		return nil, fmt.Errorf("API error: %w", err)
+		return nil, err
 	}
-	
-	categories := FindCategoriesWithPath(treeViews, "")
-	
-	if len(categories) == 0 {
+
+	if len(index.Categories) == 0 {
 		return []CategoryInfo{}, nil
 	}
-	
+
 	var result []CategoryInfo
-	for _, cat := range categories {
+	for _, cat := range index.Categories {
 		result = append(result, CategoryInfo{
 			ObjNo:   cat.ItemNo,
 			Caption: cat.Path,
 		})
 	}
-	
+
+	return result, nil
+}
+
+// GetShareCategories returns the categories a user may choose when sharing, empty
+// when no choice is configured
+func (a *App) GetShareCategories() ([]CategoryInfo, error) {
+	client, config, err := a.getAuthenticatedClient()
+	if err != nil {
+		return nil, err
+	}
+	if len(config.AllowedCategories) == 0 {
+		return []CategoryInfo{}, nil
+	}
+
+	index, err := a.categories.Get(client, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []CategoryInfo{}
+	for _, cat := range AllowedCategoryChoices(config, index.Categories) {
+		result = append(result, CategoryInfo{ObjNo: cat.ItemNo, Caption: cat.Path})
+	}
 	return result, nil
 }
 
+// ValidateRoutingRules checks that every category used by the routing rules still
+// exists, returning the problems found
+func (a *App) ValidateRoutingRules() ([]string, error) {
+	client, config, err := a.getAuthenticatedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := a.categories.Get(client, true)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := ValidateRoutingTargets(config, index.Categories)
+	if problems == nil {
+		problems = []string{}
+	}
+	return problems, nil
+}
+
+// SearchCategories finds categories whose path matches a query, best matches first
+func (a *App) SearchCategories(query string) ([]CategoryInfo, error) {
+	client, _, err := a.getAuthenticatedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := a.categories.Get(client, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []CategoryInfo{}
+	for _, cat := range SearchCategories(index.Categories, query, 0) {
+		result = append(result, CategoryInfo{ObjNo: cat.ItemNo, Caption: cat.Path, Path: cat.Path})
+	}
+	return result, nil
+}
+
+// GetCategoryStatus reports whether the configured category was deleted or renamed
+func (a *App) GetCategoryStatus() (*CategoryStatus, error) {
+	client, config, err := a.getAuthenticatedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := a.categories.Get(client, false)
+	if err != nil {
+		return nil, err
+	}
+
+	status := CheckConfiguredCategory(config, index.Categories)
+	if status.Message != "" {
+		slog.WarnContext(client.context(), "Configured category changed", "category_no", status.CategoryNo, "message", status.Message)
+	}
+	return &status, nil
+}
+
 // ==================== File Sharing ====================
 
 // ShareRequest represents a request to share files
 type ShareRequest struct {
-	Files       []string `json:"files"`       // Full paths to files
-	Password    string   `json:"password"`    // Optional password
-	ExpiryDays  int      `json:"expiryDays"`  // 0 = never, 7, 30, 90, or -1 for custom
-	CustomExpiry string  `json:"customExpiry"` // ISO 8601 date if expiryDays = -1
+	Files        []string `json:"files"`        // Full paths to files
+	Password     string   `json:"password"`     // Optional password
+	ExpiryDays   int      `json:"expiryDays"`   // 0 = never, 7, 30, 90, or -1 for custom
+	CustomExpiry string   `json:"customExpiry"` // YYYY-MM-DD or RFC 3339 time if expiryDays = -1
+	Recipients   []string `json:"recipients"`   // Optional email addresses to send the link to
+	Message      string   `json:"message"`      // Optional message included in the email
+	SendPassword bool     `json:"sendPassword"` // Email the password in a separate second email
+	CategoryNo   int      `json:"categoryNo"`   // Explicit category choice, 0 = routing rules decide
+
+	// GeneratePassword generates the link password instead of using Password
+	GeneratePassword *PasswordOptions `json:"generatePassword,omitempty"`
 }
 
 // ShareResponse represents the result of a share operation
 type ShareResponse struct {
-	URL        string `json:"url"`
-	DocNo      int64  `json:"docNo"`
-	ExpiresAt  string `json:"expiresAt,omitempty"`
+	URL       string         `json:"url"`
+	DocNo     int64          `json:"docNo"`
+	ExpiresAt string         `json:"expiresAt,omitempty"`
+	Email     *EmailDelivery `json:"email,omitempty"`
+	DLP       []DLPMatch     `json:"dlp,omitempty"` // DLP rules the shared files matched
+	Category  *CategoryRoute `json:"category"`      // Category uploaded to and the rule that chose it
+
+	// GeneratedPassword is the generated link password. It is only ever returned here.
+	GeneratedPassword string `json:"generatedPassword,omitempty"`
+}
+
+// GeneratePassword returns a password for sharing to a category, 0 for the default
+// category, that meets its share policy
+func (a *App) GeneratePassword(options PasswordOptions, categoryNo int) (string, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return "", err
+	}
+	if categoryNo == 0 {
+		categoryNo = config.CategoryNo
+	}
+	return GenerateSharePassword(options, config.SharePolicy(categoryNo))
+}
+
+// GetSharePolicy returns the password and expiry requirements for sharing to a
+// category, 0 for the default category
+func (a *App) GetSharePolicy(categoryNo int) (*SharePolicy, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if categoryNo == 0 {
+		categoryNo = config.CategoryNo
+	}
+	policy := config.SharePolicy(categoryNo)
+	return &policy, nil
 }
 
 // ShareFiles uploads files to Therefore and creates a shared link
-func (a *App) ShareFiles(req ShareRequest) (*ShareResponse, error) {
-	// Create cancellable context
-	uploadCtx, cancel := context.WithCancel(a.ctx)
+func (a *App) ShareFiles(req ShareRequest) (resp *ShareResponse, err error) {
+	// Get authenticated client and config
+	client, config, err := a.getAuthenticatedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// Each stage of the share is traced as a child of this span
+	ctx, span := StartSpan(client.context(), "share files", attribute.Int("files.count", len(req.Files)))
+	defer func() { EndSpan(span, err) }()
+	client = client.WithContext(ctx)
+
+	// Create cancellable context, carrying the client's request ID
+	uploadCtx, cancel := context.WithCancel(ctx)
 	a.cancelUpload = cancel
 	defer func() {
 		a.cancelUpload = nil
 	}()
 
-	// Validate files
-	if err := ValidateFiles(req.Files); err != nil {
+	// Validate files and check them against the DLP rules
+	_, dlpSpan := StartSpan(ctx, "dlp inspect")
+	dlp, err := ValidateFiles(req.Files, config.DLPRules)
+	EndSpan(dlpSpan, err)
+	if err != nil {
 		return nil, fmt.Errorf("file validation failed: %w", err)
 	}
 
-	// Get authenticated client and config
-	client, config, err := a.getAuthenticatedClient()
+	expiryTime, err := ParseShareExpiry(req.ExpiryDays, req.CustomExpiry, time.Local)
 	if err != nil {
 		return nil, err
 	}
 
+	if m := dlp.RequiresApproval(); m != nil {
+		return nil, fmt.Errorf("rule %q requires admin approval for %s, share it through the web portal instead", m.Rule, m.File)
+	}
+
+	// Pick the category through the routing rules
+	route, err := ResolveCategory(config, RouteInput{FilePaths: req.Files, RequestedCategory: req.CategoryNo})
+	if err != nil {
+		return nil, err
+	}
+	if err := config.CheckShareRestrictions(req.Files, route.CategoryNo); err != nil {
+		return nil, err
+	}
+	policy := config.SharePolicy(route.CategoryNo)
+	if req.GeneratePassword != nil {
+		if req.Password, err = GenerateSharePassword(*req.GeneratePassword, policy); err != nil {
+			return nil, err
+		}
+	}
+	if err := policy.Check(req.Password, expiryTime); err != nil {
+		return nil, err
+	}
+	if err := dlp.CheckShare(req.Password, expiryTime); err != nil {
+		return nil, err
+	}
+	if route.Rule != RouteDefault {
+		index, err := a.categories.Get(client, false)
+		if err != nil {
+			return nil, err
+		}
+		if err := route.Verify(index.Categories); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check email settings before uploading so a bad address doesn't leave an unsent link
+	var mailer *Mailer
+	var recipients []string
+	if len(req.Recipients) > 0 {
+		recipients, err = ParseRecipients(strings.Join(req.Recipients, ","))
+		if err != nil {
+			return nil, err
+		}
+		mailer, err = a.getMailer(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Read or create ZIP archive
+	_, zipSpan := StartSpan(ctx, "zip")
 	var fileData []byte
 	if len(req.Files) == 1 && strings.EqualFold(filepath.Ext(req.Files[0]), ".zip") {
 		// Single zip file - read it directly without re-zipping
 		fileData, err = os.ReadFile(req.Files[0])
 		if err != nil {
+			EndSpan(zipSpan, err)
 			return nil, fmt.Errorf("failed to read file: %w", err)
 		}
 	} else {
 		fileData, err = CreateZipArchive(req.Files)
 		if err != nil {
+			EndSpan(zipSpan, err)
 			return nil, fmt.Errorf("failed to create archive: %w", err)
 		}
 	}
+	zipSpan.SetAttributes(attribute.Int("zip.size", len(fileData)))
+	zipSpan.End()
 
 	// Check if cancelled
 	if uploadCtx.Err() != nil {
@@ -182,38 +557,67 @@ func (a *App) ShareFiles(req ShareRequest) (*ShareResponse, error) {
 	fileName := GetFileNameForUpload(req.Files, config.DefaultArchive)
 
 	// Create document with progress tracking
-	docResp, err := client.CreateDocumentWithProgress(uploadCtx, config.CategoryNo, fileName, fileData, []IndexDataItem{})
+	docCtx, docSpan := StartSpan(uploadCtx, "CreateDocument", attribute.Int("therefore.category_no", route.CategoryNo))
+	docResp, err := client.CreateDocumentWithProgress(docCtx, route.CategoryNo, fileName, fileData, []IndexDataItem{})
+	EndSpan(docSpan, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload document: %w", err)
 	}
-	
-	// Calculate expiry
-	var expiryTime *time.Time
-	if req.ExpiryDays > 0 {
-		t := time.Now().AddDate(0, 0, req.ExpiryDays)
-		expiryTime = &t
-	} else if req.ExpiryDays == -1 && req.CustomExpiry != "" {
-		t, err := time.Parse(time.RFC3339, req.CustomExpiry)
-		if err == nil {
-			expiryTime = &t
-		}
-	}
-	
+
 	// Create shared link
-	linkResp, err := client.CreateSharedLink(docResp.DocNo, req.Password, expiryTime, fileName)
+	linkCtx, linkSpan := StartSpan(ctx, "CreateSharedLink", attribute.Int64("therefore.doc_no", docResp.DocNo))
+	linkResp, err := client.WithContext(linkCtx).CreateSharedLink(docResp.DocNo, req.Password, expiryTime, fileName)
+	EndSpan(linkSpan, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create shared link: %w", err)
 	}
-	
-	resp := &ShareResponse{
-		URL:   linkResp.URL,
-		DocNo: docResp.DocNo,
+
+	resp = &ShareResponse{
+		URL:      linkResp.URL,
+		DocNo:    docResp.DocNo,
+		DLP:      dlp.Matches,
+		Category: route,
 	}
-	
+
 	if expiryTime != nil {
 		resp.ExpiresAt = expiryTime.Format(time.RFC3339)
 	}
-	
+	if req.GeneratePassword != nil {
+		resp.GeneratedPassword = req.Password
+	}
+
+	// Record the content hash so the stored document can be verified later
+	record := ShareRecord{
+		DocNo:     docResp.DocNo,
+		LinkID:    linkResp.LinkID,
+		URL:       linkResp.URL,
+		Filename:  fileName,
+		SHA256:    HashFileData(fileData),
+		Size:      int64(len(fileData)),
+		CreatedAt: time.Now().Format(time.RFC3339),
+		ExpiresAt: resp.ExpiresAt,
+		DLP:       dlp.Matches,
+
+		PasswordGenerated: req.GeneratePassword != nil,
+	}
+
+	if mailer != nil {
+		resp.Email = deliverShareEmail(mailer, ShareEmail{
+			Recipients:   recipients,
+			Message:      req.Message,
+			URL:          linkResp.URL,
+			Filename:     fileName,
+			ExpiresAt:    resp.ExpiresAt,
+			Password:     req.Password,
+			SendPassword: req.SendPassword,
+		})
+		record.Email = resp.Email
+	}
+
+	if err := SaveShareRecord(record); err != nil {
+		slog.WarnContext(uploadCtx, "Failed to record share", "doc_no", docResp.DocNo, "error", err)
+	}
+
 	return resp, nil
 }
 
@@ -239,10 +643,50 @@ func (a *App) getAuthenticatedClient() (*ThereforeAPIClient, *Config, error) {
 		return nil, nil, fmt.Errorf("no authentication token found")
 	}
 
-	client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token)
+	// Each call gets its own request ID to correlate its log lines
+	client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(WithRequestID(a.ctx, NewRequestID()))
 	return client, config, nil
 }
 
+// getMailer creates a mailer from the config and the stored SMTP password
+func (a *App) getMailer(config *Config) (*Mailer, error) {
+	password, err := GetSMTPPassword()
+	if err != nil {
+		return nil, err
+	}
+	return NewMailer(config, password)
+}
+
+// SetSMTPPassword saves the SMTP password used for sending share emails
+func (a *App) SetSMTPPassword(password string) error {
+	return SetSMTPPassword(password)
+}
+
+// SendTestEmail sends a test email using the saved SMTP settings
+func (a *App) SendTestEmail(to string) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	recipients, err := ParseRecipients(to)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipient provided")
+	}
+
+	mailer, err := a.getMailer(config)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(recipients, "ThereforeSharer test email",
+		"Your ThereforeSharer email settings are working.\n",
+		"<p>Your ThereforeSharer email settings are working.</p>\n")
+}
+
 // ShareHistoryEntry represents a single share history entry
 type ShareHistoryEntry struct {
 	Filename     string `json:"filename"`
@@ -253,6 +697,8 @@ type ShareHistoryEntry struct {
 	ExpiresAt    string `json:"expiresAt"`
 	HasPassword  bool   `json:"hasPassword"`
 	CategoryName string `json:"categoryName"`
+
+	PasswordGenerated bool `json:"passwordGenerated"` // The password was generated when sharing
 }
 
 // GetShareHistory retrieves the share history for the current user
@@ -267,6 +713,14 @@ func (a *App) GetShareHistory() ([]ShareHistoryEntry, error) {
 		return nil, err
 	}
 
+	// Whether a password was generated is only known from the local share records
+	generated := make(map[string]bool)
+	if records, err := LoadShareRecords(); err == nil {
+		for _, r := range records {
+			generated[r.LinkID] = r.PasswordGenerated
+		}
+	}
+
 	// Convert to our format - initialize with empty slice to ensure JSON returns [] not null
 	result := make([]ShareHistoryEntry, 0)
 	for _, entry := range entries {
@@ -279,6 +733,8 @@ func (a *App) GetShareHistory() ([]ShareHistoryEntry, error) {
 			ExpiresAt:    entry.SharedLink.ExpiresAt,
 			HasPassword:  entry.SharedLink.IsPasswordProtected,
 			CategoryName: entry.CategoryName,
+
+			PasswordGenerated: generated[entry.SharedLink.LinkID],
 		})
 	}
 
@@ -305,15 +761,95 @@ func (a *App) DeleteDocument(docNo int64) error {
 	return client.DeleteDocument(docNo)
 }
 
+// GetQRCode renders a share link, such as ShareResponse.URL or a history entry's URL,
+// as a QR code and returns it as a data: URL
+func (a *App) GetQRCode(url string, options QROptions) (string, error) {
+	return QRCodeDataURL(url, options)
+}
+
+// SaveQRCode renders a share link as a QR code and saves it through a native save dialog,
+// returning the saved path or "" if cancelled
+func (a *App) SaveQRCode(url string, options QROptions) (string, error) {
+	data, _, err := RenderQRCode(url, options)
+	if err != nil {
+		return "", err
+	}
+
+	ext := QRFormatPNG
+	if strings.EqualFold(options.Format, QRFormatSVG) {
+		ext = QRFormatSVG
+	}
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Save QR Code",
+		DefaultFilename: "share-link." + ext,
+		Filters:         []runtime.FileFilter{{DisplayName: fmt.Sprintf("%s Image (*.%s)", strings.ToUpper(ext), ext), Pattern: "*." + ext}},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save QR code: %w", err)
+	}
+	return path, nil
+}
+
+// DownloadDocument fetches a shared document from Therefore, verifies it against
+// the locally recorded hash and saves it through a native save dialog
+func (a *App) DownloadDocument(docNo int64) (*DocumentVerification, error) {
+	client, _, err := a.getAuthenticatedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	result, data, err := FetchAndVerifyDocument(client, docNo)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Save Shared Document",
+		DefaultFilename: result.Filename,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty path means the dialog was cancelled - still report the verification
+	if path == "" {
+		return result, nil
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save document: %w", err)
+	}
+	result.SavedPath = path
+
+	return result, nil
+}
+
 // CopyToClipboard copies text to the system clipboard
 func (a *App) CopyToClipboard(text string) error {
 	return runtime.ClipboardSetText(a.ctx, text)
 }
 
-// OpenFileDialog opens a native file browser dialog
-func (a *App) OpenFileDialog() (string, error) {
-	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "Select File to Share",
+// OpenFileDialog opens a native file browser dialog for one or more files, offering
+// the configured file type filters. It returns no paths if cancelled.
+func (a *App) OpenFileDialog() ([]string, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Select Files to Share",
+		Filters: dialogFilters(config),
+	})
+}
+
+// OpenFolderDialog opens a native folder browser dialog, "" if cancelled. GetFilesInfo
+// turns the folder into the files in it.
+func (a *App) OpenFolderDialog() (string, error) {
+	return runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select Folder to Share",
 	})
 }
 
@@ -328,9 +864,10 @@ func (a *App) HasStoredCredentials() bool {
 
 // FileInfo represents file metadata for the frontend
 type FileInfo struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
-	Size int64  `json:"size"`
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Warning string `json:"warning,omitempty"` // Why sharing the file will be refused or restricted
 }
 
 // GetFileInfo returns metadata about a file
@@ -346,6 +883,17 @@ func (a *App) GetFileInfo(path string) (*FileInfo, error) {
 	}, nil
 }
 
+// GetFilesInfo returns metadata about the selected files and the files directly in
+// the selected folders, with their total size and warnings for files over the
+// configured limits
+func (a *App) GetFilesInfo(paths []string) (*FileSelection, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return collectFiles(paths, config), nil
+}
+
 // CancelUpload cancels an ongoing upload
 func (a *App) CancelUpload() {
 	if a.cancelUpload != nil {
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCategoryCacheTTL = 10 * time.Minute
+	categoryProfileIdle     = 24 * time.Hour // Profiles unused for this long are dropped
+	defaultSearchLimit      = 20
+)
+
+// CategoryIndex is a cached copy of a tenant's categories
+type CategoryIndex struct {
+	Categories []CategoryWithPath `json:"categories"`
+	FetchedAt  time.Time          `json:"fetchedAt"`
+	// Version is a hash of the category list. The Therefore API has no ETag or last
+	// change time for the tree, so changes are detected by comparing versions.
+	Version string `json:"version"`
+	Stale   bool   `json:"stale"` // An old copy served because the last refresh failed
+	Error   string `json:"error,omitempty"`
+}
+
+// categoryProfile is the cache entry for one connection profile
+type categoryProfile struct {
+	client     *ThereforeAPIClient
+	index      *CategoryIndex
+	refreshing bool
+	lastUsed   time.Time
+}
+
+// CategoryCache caches the category tree per connection profile, refreshing it in
+// the background and serving the last good copy while Therefore is unreachable
+type CategoryCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	profiles map[string]*categoryProfile
+}
+
+// NewCategoryCache creates a cache whose entries are refreshed after ttl, 0 = default
+func NewCategoryCache(ttl time.Duration) *CategoryCache {
+	if ttl <= 0 {
+		ttl = defaultCategoryCacheTTL
+	}
+	return &CategoryCache{ttl: ttl, profiles: make(map[string]*categoryProfile)}
+}
+
+// SetTTL changes how long cached categories are considered fresh, 0 = default
+func (c *CategoryCache) SetTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultCategoryCacheTTL
+	}
+	c.mu.Lock()
+	c.ttl = ttl
+	c.mu.Unlock()
+}
+
+// categoryProfileKey identifies a connection profile. The token is hashed because
+// different users may see different categories.
+func categoryProfileKey(client *ThereforeAPIClient) string {
+	sum := sha256.Sum256([]byte(client.AuthToken))
+	return client.BaseURL + "|" + client.TenantName + "|" + hex.EncodeToString(sum[:8])
+}
+
+// Start refreshes recently used profiles in the background before they expire
+func (c *CategoryCache) Start() {
+	go func() {
+		for {
+			c.mu.Lock()
+			interval := c.ttl / 2
+			c.mu.Unlock()
+			time.Sleep(interval)
+			c.refreshAll()
+		}
+	}()
+}
+
+// Get returns the categories for a client's connection profile. A fresh cached copy is
+// returned directly, an expired one is returned while it is refreshed in the background,
+// and the tree is only fetched synchronously when nothing is cached or force is set.
+func (c *CategoryCache) Get(client *ThereforeAPIClient, force bool) (*CategoryIndex, error) {
+	key := categoryProfileKey(client)
+
+	c.mu.Lock()
+	profile, ok := c.profiles[key]
+	if !ok {
+		profile = &categoryProfile{}
+		c.profiles[key] = profile
+	}
+	profile.client = client
+	profile.lastUsed = time.Now()
+
+	if profile.index != nil && !force {
+		index := *profile.index
+		if time.Since(index.FetchedAt) > c.ttl && !profile.refreshing {
+			profile.refreshing = true
+			go c.refresh(key, client.WithContext(context.Background()))
+		}
+		c.mu.Unlock()
+		return &index, nil
+	}
+	c.mu.Unlock()
+
+	return c.refresh(key, client)
+}
+
+// refresh fetches the tree for a profile, keeping the old copy if the fetch fails.
+// Background refreshes pass a client detached from the request that triggered them.
+func (c *CategoryCache) refresh(key string, client *ThereforeAPIClient) (*CategoryIndex, error) {
+	c.mu.Lock()
+	profile := c.profiles[key]
+	c.mu.Unlock()
+
+	treeViews, err := client.GetCategoriesTree()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	profile.refreshing = false
+
+	if err != nil {
+		if profile.index == nil {
+			return nil, fmt.Errorf("API error: %w", err)
+		}
+		profile.index.Stale = true
+		profile.index.Error = err.Error()
+		index := *profile.index
+		return &index, nil
+	}
+
+	categories := FindCategoriesWithPath(treeViews, "")
+	if categories == nil {
+		categories = []CategoryWithPath{}
+	}
+	profile.index = &CategoryIndex{
+		Categories: categories,
+		FetchedAt:  time.Now(),
+		Version:    categoryVersion(categories),
+	}
+	index := *profile.index
+	return &index, nil
+}
+
+// refreshAll refreshes profiles that are about to expire and drops idle ones
+func (c *CategoryCache) refreshAll() {
+	c.mu.Lock()
+	due := make(map[string]*ThereforeAPIClient)
+	for key, profile := range c.profiles {
+		if time.Since(profile.lastUsed) > categoryProfileIdle {
+			delete(c.profiles, key)
+			continue
+		}
+		if profile.refreshing || profile.client == nil {
+			continue
+		}
+		if profile.index == nil || time.Since(profile.index.FetchedAt) > c.ttl/2 {
+			profile.refreshing = true
+			due[key] = profile.client.WithContext(context.Background())
+		}
+	}
+	c.mu.Unlock()
+
+	for key, client := range due {
+		c.refresh(key, client)
+	}
+}
+
+// categoryVersion hashes a category list so changes can be detected
+func categoryVersion(categories []CategoryWithPath) string {
+	h := sha256.New()
+	for _, cat := range categories {
+		fmt.Fprintf(h, "%d\x00%s\x00", cat.ItemNo, cat.Path)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// SearchCategories ranks categories by how well their path matches a query. Substring
+// matches rank above fuzzy matches, where the query's characters only appear in order.
+func SearchCategories(categories []CategoryWithPath, query string, limit int) []CategoryWithPath {
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	type scored struct {
+		cat   CategoryWithPath
+		score int
+	}
+	var matches []scored
+	for _, cat := range categories {
+		if query == "" {
+			matches = append(matches, scored{cat, 0})
+			continue
+		}
+		if score := categoryMatchScore(strings.ToLower(cat.Path), strings.ToLower(cat.Name), query); score > 0 {
+			matches = append(matches, scored{cat, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].cat.Path < matches[j].cat.Path
+	})
+
+	result := []CategoryWithPath{}
+	for i := 0; i < len(matches) && i < limit; i++ {
+		result = append(result, matches[i].cat)
+	}
+	return result
+}
+
+// categoryMatchScore scores a lower cased path and name against a lower cased query, 0 = no match
+func categoryMatchScore(path, name, query string) int {
+	switch {
+	case name == query:
+		return 1000
+	case strings.HasPrefix(name, query):
+		return 800
+	case strings.Contains(name, query):
+		return 600
+	case strings.Contains(path, query):
+		return 400
+	}
+
+	// Fuzzy: every query character in order, scoring higher for tighter matches
+	pos, gaps := 0, 0
+	for _, q := range query {
+		i := strings.IndexRune(path[pos:], q)
+		if i < 0 {
+			return 0
+		}
+		gaps += i
+		pos += i + len(string(q))
+	}
+	score := 300 - gaps
+	if score < 1 {
+		score = 1
+	}
+	return score
+}
+
+// CategoryStatus reports whether the configured default category still exists
+type CategoryStatus struct {
+	CategoryNo     int    `json:"categoryNo"`
+	ConfiguredName string `json:"configuredName"`
+	CurrentName    string `json:"currentName,omitempty"`
+	Exists         bool   `json:"exists"`
+	Renamed        bool   `json:"renamed"`
+	Message        string `json:"message,omitempty"`
+}
+
+// CheckConfiguredCategory detects a configured category that was deleted or renamed
+func CheckConfiguredCategory(config *Config, categories []CategoryWithPath) CategoryStatus {
+	status := CategoryStatus{CategoryNo: config.CategoryNo, ConfiguredName: config.CategoryName}
+	if config.CategoryNo == 0 {
+		status.Message = "no category is configured"
+		return status
+	}
+
+	for _, cat := range categories {
+		if cat.ItemNo != config.CategoryNo {
+			continue
+		}
+		status.Exists = true
+		status.CurrentName = cat.Path
+		if config.CategoryName != "" && config.CategoryName != cat.Path && config.CategoryName != cat.Name {
+			status.Renamed = true
+			status.Message = fmt.Sprintf("category %d was renamed from %q to %q", config.CategoryNo, config.CategoryName, cat.Path)
+		}
+		return status
+	}
+
+	status.Message = fmt.Sprintf("category %d (%s) no longer exists - choose a new category in settings", config.CategoryNo, config.CategoryName)
+	return status
+}
@@ -17,10 +17,24 @@ const (
 	configFileName = "config.json"
 	keyringService = "ThereforeSharer"
 	keyringUser    = "auth_token"
+	keyringSMTP    = "smtp_password"
 )
 
+// configMigrations upgrade config files written by older versions, in order. The last
+// one's version is the current schema version.
+var configMigrations = []configMigration{
+	{To: 1, Description: "record the schema version, default a missing auth type to basic", Migrate: func(raw map[string]json.RawMessage) error {
+		if rawString(raw, "auth_type") == "" {
+			setRawString(raw, "auth_type", "basic")
+		}
+		return nil
+	}},
+}
+
 // Config holds the application configuration
 type Config struct {
+	SchemaVersion int `json:"schema_version"` // Set on save, used to migrate older files
+
 	BaseURL         string `json:"base_url"`
 	TenantName      string `json:"tenant_name"`
 	CategoryNo      int    `json:"category_no"`
@@ -28,6 +42,46 @@ type Config struct {
 	AuthType        string `json:"auth_type"` // "basic" or "bearer"
 	IsSetUp         bool   `json:"is_set_up"`
 	DefaultArchive  string `json:"default_archive"` // Default archive name for multiple files
+
+	// Email delivery of share links
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     int    `json:"smtp_port"`
+	SMTPSecurity string `json:"smtp_security"` // "none", "starttls" or "tls"
+	SMTPUsername string `json:"smtp_username"`
+	SMTPFrom     string `json:"smtp_from"`
+
+	// Data-loss-prevention rules checked before files are shared
+	DLPRules []DLPRule `json:"dlp_rules,omitempty"`
+
+	// Category routing: rules pick the upload category, users may choose from the allowed list
+	RoutingRules      []RoutingRule `json:"routing_rules,omitempty"`
+	AllowedCategories []int         `json:"allowed_categories,omitempty"`
+
+	// Minutes the category tree is cached before it is refreshed, 0 = 10
+	CategoryCacheMinutes int `json:"category_cache_minutes,omitempty"`
+
+	// Password and expiry requirements for shared links, by category
+	SharePolicies []SharePolicy `json:"share_policies,omitempty"`
+
+	// Share restrictions, usually locked by the system policy
+	RequirePassword  bool     `json:"require_password,omitempty"`
+	MaxExpiryDays    int      `json:"max_expiry_days,omitempty"`    // 0 = no limit, never-expiring links are refused otherwise
+	AllowedFileTypes []string `json:"allowed_file_types,omitempty"` // Extensions such as "pdf", empty = any
+
+	// File type filters of the file dialog, followed by all files
+	FileFilters []FileFilter `json:"file_filters,omitempty"`
+
+	// Keep running in the system tray (menu bar on macOS) when the window is closed
+	TrayMode bool `json:"tray_mode,omitempty"`
+
+	// Structured log level and format
+	Logging LogConfig `json:"logging"`
+
+	// OpenTelemetry trace export, off unless an endpoint is set
+	Tracing TracingConfig `json:"tracing"`
+
+	// Fields locked by the system policy, set by LoadConfig and never saved
+	PolicyLocked []string `json:"policy_locked,omitempty"`
 }
 
 // GetConfigDir returns the directory where config is stored
@@ -62,46 +116,90 @@ func GetConfigPath() string {
 	return filepath.Join(GetConfigDir(), configFileName)
 }
 
-// LoadConfig loads the configuration from disk
+// configStore holds the config in memory and serialises saves
+var configStore = NewConfigStore(GetConfigPath)
+
+// LoadConfig returns a copy of the configuration with the system policy applied,
+// migrating files written by older versions
 func LoadConfig() (*Config, error) {
-	configPath := GetConfigPath()
-	
-	data, err := os.ReadFile(configPath)
+	config, _, err := configStore.Get()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return &Config{}, nil
-		}
-		return nil, fmt.Errorf("failed to read config: %w", err)
+		return nil, err
+	}
+	policy, err := loadPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if err := applyPolicy(config, policy); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// decodeConfig parses the config file, migrating it if needed. It reports whether the
+// file should be rewritten with the migrated config.
+func decodeConfig(path string, data []byte) (*Config, bool, error) {
+	data, migrated, err := migrateConfig(path, data, configMigrations, true)
+	if err != nil {
+		return nil, false, err
 	}
 
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+		return nil, false, fmt.Errorf("failed to parse config: %w", err)
 	}
+	return &config, migrated, nil
+}
 
-	return &config, nil
+// currentSchemaVersion is the schema version configs are saved with
+func currentSchemaVersion() int {
+	return configMigrations[len(configMigrations)-1].To
 }
 
-// SaveConfig saves the configuration to disk
-func (c *Config) SaveConfig() error {
-	configDir := GetConfigDir()
-	
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+// Validate checks every field and returns a *ValidationError listing the invalid ones
+func (c *Config) Validate() error {
+	v := &ValidationError{}
+	v.URL("base_url", c.BaseURL, c.IsSetUp)
+	if c.IsSetUp {
+		v.OneOf("auth_type", c.AuthType, "basic", "bearer")
+		if c.CategoryNo <= 0 {
+			v.Add("category_no", "must be a positive category number")
+		}
+	} else {
+		v.OneOf("auth_type", c.AuthType, "", "basic", "bearer")
+		v.NotNegative("category_no", int64(c.CategoryNo))
 	}
+	validateSMTP(v, c.SMTPHost, c.SMTPPort, c.SMTPSecurity, c.SMTPFrom)
+	validateDLPRules(v, c.DLPRules)
+	validateRouting(v, c.RoutingRules, c.AllowedCategories)
+	v.NotNegative("category_cache_minutes", int64(c.CategoryCacheMinutes))
+	v.NotNegative("max_expiry_days", int64(c.MaxExpiryDays))
+	validateSharePolicies(v, c.SharePolicies)
+	validateFileFilters(v, c.FileFilters)
+	validateObservability(v, c.Logging, c.Tracing)
+	return v.Err()
+}
 
-	data, err := json.MarshalIndent(c, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+// SaveConfig validates the configuration and saves it to disk. Changing a field locked
+// by the system policy is rejected.
+func (c *Config) SaveConfig() error {
+	if err := c.Validate(); err != nil {
+		return err
 	}
-
-	configPath := GetConfigPath()
-	
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
+	policy, err := loadPolicy()
+	if err != nil {
+		return err
 	}
-
-	return nil
+	c.SchemaVersion = currentSchemaVersion()
+	_, err = configStore.Update("", func(stored *Config) (*Config, error) {
+		saved := cloneConfig(c)
+		if err := checkPolicyLocks(saved, stored, policy); err != nil {
+			return nil, err
+		}
+		saved.PolicyLocked = nil
+		return saved, nil
+	})
+	return err
 }
 
 // GetAuthToken retrieves the authentication token from secure storage
@@ -126,6 +224,23 @@ func DeleteAuthToken() error {
 	return keyring.Delete(keyringService, keyringUser)
 }
 
+// GetSMTPPassword retrieves the SMTP password from secure storage
+func GetSMTPPassword() (string, error) {
+	password, err := keyring.Get(keyringService, keyringSMTP)
+	if err != nil {
+		if err == keyring.ErrNotFound {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get SMTP password: %w", err)
+	}
+	return password, nil
+}
+
+// SetSMTPPassword stores the SMTP password in secure storage
+func SetSMTPPassword(password string) error {
+	return keyring.Set(keyringService, keyringSMTP, password)
+}
+
 // CreateBasicAuthToken creates a Basic auth token from username and password
 func CreateBasicAuthToken(username, password string) string {
 	credentials := username + ":" + password
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// maxFolderFiles caps the files taken from one folder, so picking a folder like the
+// home directory by mistake doesn't fill the share with thousands of files
+const maxFolderFiles = 500
+
+// FileFilter is a file type filter offered by the file dialog
+type FileFilter struct {
+	Name       string   `json:"name"`       // e.g. "Documents"
+	Extensions []string `json:"extensions"` // e.g. "pdf", "docx"
+}
+
+// FileSelection is the metadata of files selected together, for the frontend
+type FileSelection struct {
+	Files     []FileInfo `json:"files"`
+	TotalSize int64      `json:"totalSize"`
+	Warnings  []string   `json:"warnings,omitempty"` // Paths that were skipped, and why
+}
+
+// validateFileFilters checks the file dialog filters
+func validateFileFilters(v *ValidationError, filters []FileFilter) {
+	for i, f := range filters {
+		field := fmt.Sprintf("file_filters[%d]", i)
+		if strings.TrimSpace(f.Name) == "" {
+			v.Add(field+".name", "is required")
+		}
+		if len(f.Extensions) == 0 {
+			v.Add(field+".extensions", "must list at least one extension")
+		}
+		for j, ext := range f.Extensions {
+			ext = strings.TrimPrefix(ext, ".")
+			if ext == "" || strings.ContainsAny(ext, `*?;/\ `) {
+				v.Add(fmt.Sprintf("%s.extensions[%d]", field, j), "must be an extension such as \"pdf\"")
+			}
+		}
+	}
+}
+
+// dialogFilters returns the filters of the file dialog: the configured ones followed by
+// all files. When only some file types may be shared, those are offered instead.
+func dialogFilters(c *Config) []runtime.FileFilter {
+	var filters []runtime.FileFilter
+	for _, f := range c.FileFilters {
+		filters = append(filters, fileDialogFilter(f.Name, f.Extensions))
+	}
+	if len(c.AllowedFileTypes) > 0 {
+		if len(filters) == 0 {
+			filters = append(filters, fileDialogFilter("Allowed Files", c.AllowedFileTypes))
+		}
+		return filters
+	}
+	if len(filters) > 0 {
+		filters = append(filters, runtime.FileFilter{DisplayName: "All Files", Pattern: "*"})
+	}
+	return filters
+}
+
+// fileDialogFilter builds a dialog filter such as "Documents (*.pdf, *.docx)"
+func fileDialogFilter(name string, extensions []string) runtime.FileFilter {
+	patterns := make([]string, len(extensions))
+	for i, ext := range extensions {
+		patterns[i] = "*." + strings.TrimPrefix(ext, ".")
+	}
+	return runtime.FileFilter{
+		DisplayName: fmt.Sprintf("%s (%s)", name, strings.Join(patterns, ", ")),
+		Pattern:     strings.Join(patterns, ";"),
+	}
+}
+
+// collectFiles returns the metadata of the files at paths. Folders contribute the files
+// directly in them; their subfolders and hidden files are left out.
+func collectFiles(paths []string, c *Config) *FileSelection {
+	selection := &FileSelection{Files: []FileInfo{}}
+	seen := make(map[string]bool)
+	add := func(path string, info os.FileInfo) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		selection.Files = append(selection.Files, FileInfo{
+			Name:    info.Name(),
+			Path:    path,
+			Size:    info.Size(),
+			Warning: fileLimitWarning(c, path, info.Size()),
+		})
+		selection.TotalSize += info.Size()
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			selection.Warnings = append(selection.Warnings, fmt.Sprintf("%s can't be read: %v", filepath.Base(path), err))
+			continue
+		}
+		if !info.IsDir() {
+			add(path, info)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			selection.Warnings = append(selection.Warnings, fmt.Sprintf("%s can't be read: %v", filepath.Base(path), err))
+			continue
+		}
+		added, folders := 0, 0
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			if entry.IsDir() {
+				folders++
+				continue
+			}
+			if added == maxFolderFiles {
+				selection.Warnings = append(selection.Warnings, fmt.Sprintf("Only the first %d files of %s were added", maxFolderFiles, info.Name()))
+				break
+			}
+			entryPath := filepath.Join(path, entry.Name())
+			entryInfo, err := os.Stat(entryPath)
+			if err != nil || !entryInfo.Mode().IsRegular() {
+				continue
+			}
+			add(entryPath, entryInfo)
+			added++
+		}
+		if folders > 0 {
+			selection.Warnings = append(selection.Warnings, fmt.Sprintf("%d subfolder(s) of %s were not included", folders, info.Name()))
+		}
+		if added == 0 {
+			selection.Warnings = append(selection.Warnings, fmt.Sprintf("%s has no files to share", info.Name()))
+		}
+	}
+	return selection
+}
+
+// fileLimitWarning tells why a file will be refused or restricted when shared because
+// of its type or size, "" if nothing stands in its way
+func fileLimitWarning(c *Config, path string, size int64) string {
+	if len(c.AllowedFileTypes) > 0 && !hasExtension(c.AllowedFileTypes, path) {
+		return "Only these file types may be shared: " + strings.Join(c.AllowedFileTypes, ", ")
+	}
+	for _, rule := range c.DLPRules {
+		if rule.MaxFileBytes <= 0 || size <= rule.MaxFileBytes {
+			continue
+		}
+		limit := fmt.Sprintf("Larger than the %s limit of rule %q", formatFileSize(rule.MaxFileBytes), rule.Name)
+		switch rule.Action {
+		case DLPActionBlock:
+			return limit + ", sharing it will be blocked"
+		case DLPActionRequireProtect:
+			return limit + ", it needs a password and a short expiry"
+		case DLPActionRequireApproval:
+			return limit + ", it needs admin approval"
+		}
+	}
+	return ""
+}
+
+// formatFileSize formats a byte count the way the frontend does, e.g. "1.5 MB"
+func formatFileSize(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	size, i := float64(bytes), 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", size), ".0") + " " + units[i]
+}
@@ -44,6 +44,20 @@ async function init() {
 
     // Listen for upload progress events
     runtime.EventsOn('upload-progress', handleUploadProgress);
+
+    // config.json was edited outside the app
+    runtime.EventsOn('config-changed', async () => {
+        appState.config = await App.GetConfig();
+        showToast('Settings were changed outside the app and have been reloaded');
+    });
+
+    // Quick shares from the tray, the link is already on the clipboard
+    runtime.EventsOn('tray:shared', resp => {
+        showShareDialog(resp.url, resp.generatedPassword);
+    });
+    runtime.EventsOn('tray:share-failed', message => {
+        showErrorDialog('Share Failed', message);
+    });
 }
 
 // ==================== Main Screen ====================
@@ -70,7 +84,7 @@ function renderMain() {
                 <div class="drop-zone" id="dropZone">
                     <i class="fas fa-cloud-upload-alt drop-icon"></i>
                     <p class="drop-text">Drop files here</p>
-                    <p class="drop-subtext">or <span class="browse-btn" id="browseBtn">browse</span> to select</p>
+                    <p class="drop-subtext">or <span class="browse-btn" id="browseBtn">browse</span> for files or a <span class="browse-btn" id="browseFolderBtn">folder</span></p>
                 </div>
 
                 <div class="file-badge-container">
@@ -89,6 +103,11 @@ function renderMain() {
                             Password:
                         </label>
                         <input type="password" class="input" id="passwordInput" placeholder="Enter password" style="flex: 1;" disabled>
+                        <select class="select" id="passwordModeSelect" title="Type a password or generate one" disabled>
+                            <option value="">Type</option>
+                            <option value="characters">Generate</option>
+                            <option value="words">Passphrase</option>
+                        </select>
                     </div>
                     <div class="option-row">
                         <label style="min-width: 80px;">Expiry:</label>
@@ -101,6 +120,23 @@ function renderMain() {
                         </select>
                         <input type="date" class="input" id="customDate" style="display: none;" disabled>
                     </div>
+                    <div class="option-row">
+                        <label style="min-width: 80px;">Email to:</label>
+                        <input type="text" class="input" id="recipientsInput" placeholder="Optional, comma separated" style="flex: 1;" disabled>
+                    </div>
+                    <div class="option-row" id="emailOptionsRow" style="display: none;">
+                        <input type="text" class="input" id="messageInput" placeholder="Message (optional)" style="flex: 1;">
+                        <label style="margin-left: 8px;">
+                            <input type="checkbox" id="sendPasswordCheck">
+                            Email password
+                        </label>
+                    </div>
+                    <div class="option-row" id="shareCategoryRow" style="display: none;">
+                        <label style="min-width: 80px;">Category:</label>
+                        <select class="select" id="shareCategorySelect" style="flex: 1;">
+                            <option value="0">Automatic</option>
+                        </select>
+                    </div>
                 </div>
 
                 <button class="btn btn-primary share-btn" id="shareBtn" disabled>
@@ -133,6 +169,81 @@ function renderMain() {
 
     setupEventListeners();
     setupFileDrawer();
+    loadShareCategories();
+    checkCategoryStatus();
+    applyShareRestrictions();
+}
+
+// Limit the share options to the share policy of the chosen category, and preselect its default expiry
+async function applyShareRestrictions() {
+    const categoryNo = parseInt(document.getElementById('shareCategorySelect')?.value) || 0;
+    try {
+        appState.sharePolicy = await App.GetSharePolicy(categoryNo);
+    } catch (err) {
+        console.error('Failed to load share policy:', err);
+        return;
+    }
+    const policy = appState.sharePolicy;
+    const maxDays = policy.max_expiry_days || 0;
+    const days = [7, 30, 90];
+    if (policy.default_expiry_days && !days.includes(policy.default_expiry_days)) {
+        days.push(policy.default_expiry_days);
+        days.sort((a, b) => a - b);
+    }
+
+    const expirySelect = document.getElementById('expirySelect');
+    const previous = expirySelect.value;
+    expirySelect.innerHTML = `
+        ${policy.require_expiry ? '' : '<option value="never">Never</option>'}
+        ${days.filter(d => !maxDays || d <= maxDays).map(d => `<option value="${d}">${d} days</option>`).join('')}
+        <option value="custom">Custom date</option>
+    `;
+    if (policy.default_expiry_days) {
+        expirySelect.value = String(policy.default_expiry_days);
+    } else if ([...expirySelect.options].some(o => o.value === previous)) {
+        expirySelect.value = previous;
+    }
+    expirySelect.dispatchEvent(new Event('change'));
+
+    const customDate = document.getElementById('customDate');
+    customDate.min = new Date().toISOString().slice(0, 10);
+    if (maxDays > 0) {
+        const latest = new Date();
+        latest.setDate(latest.getDate() + maxDays);
+        customDate.max = latest.toISOString().slice(0, 10);
+    } else {
+        customDate.removeAttribute('max');
+    }
+    updateFileList();
+}
+
+// Offer the categories users may choose when sharing, if any are configured
+async function loadShareCategories() {
+    try {
+        const categories = await App.GetShareCategories();
+        if (!categories?.length) return;
+        const select = document.getElementById('shareCategorySelect');
+        if (!select) return;
+        select.innerHTML += categories.map(c => `<option value="${c.objNo}">${c.caption}</option>`).join('');
+        document.getElementById('shareCategoryRow').style.display = 'flex';
+    } catch (err) {
+        console.error('Failed to load share categories:', err);
+    }
+}
+
+// Warn when the configured category was deleted or renamed in Therefore
+async function checkCategoryStatus() {
+    try {
+        const status = await App.GetCategoryStatus();
+        if (!status || !status.categoryNo) return;
+        if (!status.exists) {
+            showErrorDialog('Category Missing', status.message);
+        } else if (status.renamed) {
+            showToast(status.message, 'error');
+        }
+    } catch (err) {
+        console.error('Failed to check category:', err);
+    }
 }
 
 // ==================== Settings Screen ====================
@@ -143,6 +254,7 @@ async function openSettings() {
     try {
         const config = await App.GetConfig();
         if (config) {
+            appState.config = config;
             appState.settings.baseURL = config.base_url || '';
             appState.settings.tenantName = config.tenant_name || '';
             appState.settings.authType = config.auth_type || 'basic';
@@ -201,6 +313,12 @@ async function openSettings() {
             </header>
             
             <div class="settings-form">
+                ${appState.config?.policy_locked?.length ? `
+                <div class="info-box">
+                    <i class="fas fa-lock"></i>
+                    <span>Some settings are managed by your organization and can't be changed: ${appState.config.policy_locked.join(', ')}</span>
+                </div>
+                ` : ''}
                 <div class="form-group">
                     <label>Base URL</label>
                     <input type="text" class="input" id="baseURL" placeholder="https://your-server.com" value="${appState.settings.baseURL || ''}" autocapitalize="off" autocorrect="off" spellcheck="false">
@@ -257,6 +375,7 @@ async function openSettings() {
                             <i class="fas fa-sync"></i> Load Categories
                         </button>
                     </div>
+                    <input type="text" class="input" id="categorySearch" placeholder="Search categories..." style="margin-top: 8px;" autocapitalize="off" autocorrect="off" spellcheck="false">
                 </div>
 
                 <div class="form-group">
@@ -265,8 +384,73 @@ async function openSettings() {
                     <small style="color: var(--text-muted); font-size: 12px; margin-top: 4px; display: block;">Used for multiple files. Timestamp will be appended (e.g., Archive-260207-1430.zip)</small>
                 </div>
 
+                <div class="form-group">
+                    <label>Email (SMTP) Server</label>
+                    <div class="category-row">
+                        <input type="text" class="input" id="smtpHost" placeholder="smtp.example.com" value="${appState.config?.smtp_host || ''}" style="flex: 1;" autocapitalize="off" autocorrect="off" spellcheck="false">
+                        <input type="number" class="input" id="smtpPort" placeholder="587" value="${appState.config?.smtp_port || ''}" style="width: 80px; margin-left: 8px;">
+                    </div>
+                    <select class="select" id="smtpSecurity" style="margin-top: 5px;">
+                        <option value="starttls" ${(appState.config?.smtp_security || 'starttls') === 'starttls' ? 'selected' : ''}>STARTTLS</option>
+                        <option value="tls" ${appState.config?.smtp_security === 'tls' ? 'selected' : ''}>TLS</option>
+                        <option value="none" ${appState.config?.smtp_security === 'none' ? 'selected' : ''}>None</option>
+                    </select>
+                    <input type="text" class="input" id="smtpFrom" placeholder="Sender address" value="${appState.config?.smtp_from || ''}" style="margin-top: 5px;" autocapitalize="off" autocorrect="off" spellcheck="false">
+                    <input type="text" class="input" id="smtpUsername" placeholder="SMTP username (optional)" value="${appState.config?.smtp_username || ''}" style="margin-top: 5px;" autocapitalize="off" autocorrect="off" spellcheck="false">
+                    <input type="password" class="input" id="smtpPassword" placeholder="SMTP password (leave blank to keep existing)" style="margin-top: 5px;">
+                    <button class="btn btn-secondary" id="testEmailBtn" style="width: 100%; margin-top: 5px;">
+                        <i class="fas fa-envelope"></i> Send Test Email
+                    </button>
+                </div>
+
+                <div class="form-group">
+                    <label>Data-Loss-Prevention Rules</label>
+                    <textarea class="input" id="dlpRules" rows="4" placeholder='[{"name": "Card numbers", "action": "block", "detectors": ["credit_card"]}, {"name": "Confidential", "action": "require_protection", "filename_patterns": ["*confidential*"], "max_expiry_days": 7}]' spellcheck="false">${appState.config?.dlp_rules ? JSON.stringify(appState.config.dlp_rules, null, 2) : ''}</textarea>
+                </div>
+
+                <div class="form-group">
+                    <label>Category Routing Rules</label>
+                    <textarea class="input" id="routingRules" rows="4" placeholder='[{"name": "Invoices", "category_no": 12, "extensions": [".pdf"]}, {"name": "Large uploads", "category_no": 14, "min_total_bytes": 104857600}]' spellcheck="false">${appState.config?.routing_rules ? JSON.stringify(appState.config.routing_rules, null, 2) : ''}</textarea>
+                    <input type="text" class="input" id="allowedCategories" placeholder="Categories users may choose, comma separated numbers" value="${(appState.config?.allowed_categories || []).join(', ')}" style="margin-top: 5px;">
+                    <button class="btn btn-secondary" id="checkRoutingBtn" style="width: 100%; margin-top: 5px;">
+                        <i class="fas fa-check-circle"></i> Check Routing Categories
+                    </button>
+                </div>
+
+                <div class="form-group">
+                    <label>Share Policies</label>
+                    <textarea class="input" id="sharePolicies" rows="4" placeholder='[{"name": "Finance", "categories": [12], "require_password": true, "min_password_length": 12, "max_expiry_days": 30, "default_expiry_days": 7}]' spellcheck="false">${appState.config?.share_policies ? JSON.stringify(appState.config.share_policies, null, 2) : ''}</textarea>
+                </div>
+
+                <div class="form-group">
+                    <label>File Dialog Filters</label>
+                    <textarea class="input" id="fileFilters" rows="3" placeholder='[{"name": "Documents", "extensions": ["pdf", "docx", "xlsx"]}, {"name": "Images", "extensions": ["png", "jpg"]}]' spellcheck="false">${appState.config?.file_filters ? JSON.stringify(appState.config.file_filters, null, 2) : ''}</textarea>
+                </div>
+
+                <div class="form-group">
+                    <label>
+                        <input type="checkbox" id="trayMode" ${appState.config?.tray_mode ? 'checked' : ''}>
+                        Keep running in the tray when closed
+                    </label>
+                    <small style="color: var(--text-muted); font-size: 12px; margin-top: 4px; display: block;">Shows recent shares and quick share in the system tray (menu bar on macOS). Turning it off takes effect after a restart.</small>
+                </div>
+
                 <button class="btn btn-primary" id="saveSettingsBtn" style="width: 100%;">Save Settings</button>
 
+                <div class="form-group" style="margin-top: 12px;">
+                    <label>Settings Bundle</label>
+                    <input type="password" class="input" id="bundlePassphrase" placeholder="Passphrase for credentials (optional)">
+                    <small style="color: var(--text-muted); font-size: 12px; margin-top: 4px; display: block;">Credentials are only exported, encrypted, when a passphrase is given, and only imported with the same passphrase.</small>
+                    <div class="category-row" style="margin-top: 5px;">
+                        <button class="btn btn-secondary" id="exportSettingsBtn" style="flex: 1;">
+                            <i class="fas fa-file-export"></i> Export
+                        </button>
+                        <button class="btn btn-secondary" id="importSettingsBtn" style="flex: 1; margin-left: 8px;">
+                            <i class="fas fa-file-import"></i> Import
+                        </button>
+                    </div>
+                </div>
+
                 <button class="btn btn-secondary" id="aboutBtn" style="width: 100%; margin-top: 12px;">
                     <i class="fas fa-info-circle"></i> About ThereforeSharer
                 </button>
@@ -279,6 +463,36 @@ async function openSettings() {
     // Back button
     document.getElementById('backBtn').addEventListener('click', renderMain);
 
+    // Settings locked by the system policy can't be edited
+    const policyInputs = {
+        base_url: ['baseURL'],
+        tenant_name: ['tenantName'],
+        auth_type: ['.auth-tab'],
+        category_no: ['categorySelect', 'loadCategoriesBtn', 'categorySearch'],
+        default_archive: ['defaultArchive'],
+        smtp_host: ['smtpHost'],
+        smtp_port: ['smtpPort'],
+        smtp_security: ['smtpSecurity'],
+        smtp_username: ['smtpUsername'],
+        smtp_from: ['smtpFrom'],
+        dlp_rules: ['dlpRules'],
+        routing_rules: ['routingRules'],
+        share_policies: ['sharePolicies'],
+        allowed_categories: ['allowedCategories'],
+        file_filters: ['fileFilters'],
+        tray_mode: ['trayMode']
+    };
+    (appState.config?.policy_locked || []).forEach(field => {
+        (policyInputs[field] || []).forEach(id => {
+            const elements = id.startsWith('.') ? document.querySelectorAll(id) : [document.getElementById(id)];
+            elements.forEach(el => {
+                if (!el) return;
+                el.disabled = true;
+                el.title = 'Locked by your organization\'s policy';
+            });
+        });
+    });
+
     // Auth type tabs
     document.querySelectorAll('.auth-tab').forEach(tab => {
         tab.addEventListener('click', () => {
@@ -292,6 +506,12 @@ async function openSettings() {
     });
 
     // Load categories button
+    let searchTimer;
+    document.getElementById('categorySearch').addEventListener('input', (e) => {
+        clearTimeout(searchTimer);
+        searchTimer = setTimeout(() => searchCategories(e.target.value), 250);
+    });
+
     document.getElementById('loadCategoriesBtn').addEventListener('click', async () => {
         await loadCategories();
     });
@@ -329,17 +549,72 @@ async function openSettings() {
         }
 
         try {
+            const dlpText = document.getElementById('dlpRules').value.trim();
+            let dlpRules;
+            try {
+                dlpRules = dlpText ? JSON.parse(dlpText) : [];
+            } catch (err) {
+                showToast('DLP rules must be valid JSON: ' + err.message, 'error');
+                return;
+            }
+
+            const routingText = document.getElementById('routingRules').value.trim();
+            let routingRules;
+            try {
+                routingRules = routingText ? JSON.parse(routingText) : [];
+            } catch (err) {
+                showToast('Routing rules must be valid JSON: ' + err.message, 'error');
+                return;
+            }
+
+            const policiesText = document.getElementById('sharePolicies').value.trim();
+            let sharePolicies;
+            try {
+                sharePolicies = policiesText ? JSON.parse(policiesText) : [];
+            } catch (err) {
+                showToast('Share policies must be valid JSON: ' + err.message, 'error');
+                return;
+            }
+
+            const filtersText = document.getElementById('fileFilters').value.trim();
+            let fileFilters;
+            try {
+                fileFilters = filtersText ? JSON.parse(filtersText) : [];
+            } catch (err) {
+                showToast('File dialog filters must be valid JSON: ' + err.message, 'error');
+                return;
+            }
+
             // Save config
             const config = {
+                ...appState.config,
                 base_url: baseURL,
                 tenant_name: tenantName,
                 category_no: categoryNo,
                 category_name: categoryName,
                 auth_type: authType,
                 is_set_up: true,
-                default_archive: defaultArchive
+                default_archive: defaultArchive,
+                smtp_host: document.getElementById('smtpHost').value.trim(),
+                smtp_port: parseInt(document.getElementById('smtpPort').value) || 0,
+                smtp_security: document.getElementById('smtpSecurity').value,
+                smtp_username: document.getElementById('smtpUsername').value.trim(),
+                smtp_from: document.getElementById('smtpFrom').value.trim(),
+                dlp_rules: dlpRules,
+                routing_rules: routingRules,
+                share_policies: sharePolicies,
+                allowed_categories: document.getElementById('allowedCategories').value
+                    .split(',').map(v => parseInt(v)).filter(n => n > 0),
+                file_filters: fileFilters,
+                tray_mode: document.getElementById('trayMode').checked
             };
             await App.SaveConfig(config);
+            appState.config = config;
+
+            const smtpPassword = document.getElementById('smtpPassword').value;
+            if (smtpPassword) {
+                await App.SetSMTPPassword(smtpPassword);
+            }
 
             // Only save auth credentials if new ones were provided
             if (hasCredentials) {
@@ -358,12 +633,116 @@ async function openSettings() {
         }
     });
 
+    // Test email button - uses the saved settings
+    document.getElementById('testEmailBtn').addEventListener('click', async () => {
+        const to = document.getElementById('smtpFrom').value.trim();
+        try {
+            await App.SendTestEmail(to);
+            showToast(`Test email sent to ${to}`);
+        } catch (err) {
+            showErrorDialog('Test Email Failed', err?.message || err || 'Unknown error');
+        }
+    });
+
+    // Checks the saved routing rules against the categories in Therefore
+    document.getElementById('checkRoutingBtn').addEventListener('click', async () => {
+        try {
+            const problems = await App.ValidateRoutingRules();
+            if (problems.length === 0) {
+                showToast('All routing categories exist');
+            } else {
+                showErrorDialog('Routing Problems', problems.join('\n'));
+            }
+        } catch (err) {
+            showErrorDialog('Check Failed', err?.message || err || 'Unknown error');
+        }
+    });
+
+    // Settings bundle export and import
+    document.getElementById('exportSettingsBtn').addEventListener('click', async () => {
+        try {
+            const path = await App.ExportSettings(document.getElementById('bundlePassphrase').value);
+            if (path) {
+                showToast(`Settings exported to ${path}`);
+            }
+        } catch (err) {
+            showErrorDialog('Export Failed', err?.message || err || 'Unknown error');
+        }
+    });
+
+    document.getElementById('importSettingsBtn').addEventListener('click', async () => {
+        try {
+            const path = await App.SelectSettingsBundle();
+            if (!path) return;
+            const req = { path, passphrase: document.getElementById('bundlePassphrase').value, profile: '' };
+            showImportPreviewDialog(req, await App.PreviewSettingsImport(req));
+        } catch (err) {
+            showErrorDialog('Import Failed', err?.message || err || 'Unknown error');
+        }
+    });
+
     // About button
     document.getElementById('aboutBtn').addEventListener('click', () => {
         renderAbout();
     });
 }
 
+// Shows what importing a settings bundle changes and imports it on confirmation
+function showImportPreviewDialog(req, preview) {
+    const escape = (s) => String(s ?? '').replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' })[c]);
+    const overlay = document.createElement('div');
+    overlay.className = 'modal-overlay';
+    overlay.innerHTML = `
+        <div class="modal">
+            <h3>Import Settings</h3>
+            <p>Exported from the ${escape(preview.app)} app${preview.exportedAt ? ` on ${new Date(preview.exportedAt).toLocaleString()}` : ''}.</p>
+            ${preview.profiles.length ? `
+            <select class="select" id="importProfile">
+                <option value="">No profile</option>
+                ${preview.profiles.map(p => `<option value="${escape(p)}" ${p === req.profile ? 'selected' : ''}>${escape(p)}</option>`).join('')}
+            </select>
+            ` : ''}
+            ${preview.hasCredentials && !preview.credentialsApplied ? '<p>The bundle contains credentials. Enter its passphrase to import them, otherwise your current credentials are kept.</p>' : ''}
+            <div style="max-height: 200px; overflow-y: auto; font-size: 12px; margin: 8px 0;">
+                ${preview.changes.length ? preview.changes.map(c => `<div><strong>${escape(c.field)}</strong>: ${escape(c.from) || '<em>empty</em>'} &rarr; ${escape(c.to) || '<em>empty</em>'}</div>`).join('') : '<p>Nothing would change.</p>'}
+            </div>
+            ${preview.errors.length ? `<div class="error-message">${preview.errors.map(e => `${escape(e.field)}: ${escape(e.message)}`).join('<br>')}</div>` : ''}
+            <div class="modal-actions">
+                <button class="btn btn-secondary" id="cancelBtn">Cancel</button>
+                <button class="btn btn-primary" id="confirmBtn" ${preview.errors.length || !preview.changes.length ? 'disabled' : ''}>Import</button>
+            </div>
+        </div>
+    `;
+
+    document.body.appendChild(overlay);
+
+    overlay.querySelector('#importProfile')?.addEventListener('change', async (e) => {
+        const next = { ...req, profile: e.target.value };
+        try {
+            const updated = await App.PreviewSettingsImport(next);
+            overlay.remove();
+            showImportPreviewDialog(next, updated);
+        } catch (err) {
+            showErrorDialog('Import Failed', err?.message || err || 'Unknown error');
+        }
+    });
+
+    overlay.querySelector('#confirmBtn').addEventListener('click', async () => {
+        try {
+            await App.ImportSettings(req);
+            overlay.remove();
+            await openSettings();
+            showToast('Settings imported');
+        } catch (err) {
+            showErrorDialog('Import Failed', err?.message || err || 'Unknown error');
+        }
+    });
+
+    overlay.querySelector('#cancelBtn').addEventListener('click', () => {
+        overlay.remove();
+    });
+}
+
 // ==================== About Screen ====================
 function renderAbout() {
     appElement.innerHTML = `
@@ -482,10 +861,25 @@ async function loadCategories() {
     }
 }
 
+// Narrow the category list to matches for a search, using the cached category tree
+async function searchCategories(query) {
+    try {
+        const categories = await App.SearchCategories(query);
+        const select = document.getElementById('categorySelect');
+        if (!select) return;
+        const current = parseInt(select.value) || appState.settings.selectedCategory;
+        select.innerHTML = '<option value="">Select a category...</option>' +
+            categories.map(c => `<option value="${c.objNo}" ${c.objNo === current ? 'selected' : ''}>${c.caption}</option>`).join('');
+    } catch (err) {
+        console.error('Failed to search categories:', err);
+    }
+}
+
 // ==================== Share Dialog ====================
-function showShareDialog(url) {
+function showShareDialog(url, generatedPassword) {
     const dialog = document.createElement('div');
     dialog.className = 'share-dialog';
+    // A generated password is shown once, hidden until revealed and never copied automatically
     dialog.innerHTML = `
         <div class="dialog-content">
             <h3><i class="fas fa-check-circle"></i> Files Shared Successfully!</h3>
@@ -493,13 +887,38 @@ function showShareDialog(url) {
             <div class="url-box">
                 <input type="text" id="shareUrl" value="${url}" readonly>
                 <button class="btn btn-small" id="copyUrlBtn"><i class="fas fa-copy"></i> Copy</button>
+                <button class="btn btn-small" id="qrCodeBtn" title="QR code"><i class="fas fa-qrcode"></i></button>
             </div>
+            ${generatedPassword ? `
+            <p>The link password is shown only this once. Send it through a different channel than the link, such as a phone call or a text message:</p>
+            <div class="url-box">
+                <input type="password" id="generatedPassword" readonly>
+                <button class="btn btn-small" id="revealPasswordBtn" title="Show password"><i class="fas fa-eye"></i></button>
+                <button class="btn btn-small" id="copyPasswordBtn"><i class="fas fa-copy"></i> Copy</button>
+            </div>` : ''}
             <button class="btn btn-primary" id="closeDialogBtn">Close</button>
         </div>
     `;
     
     document.body.appendChild(dialog);
 
+    if (generatedPassword) {
+        const passwordField = dialog.querySelector('#generatedPassword');
+        passwordField.value = generatedPassword;
+        dialog.querySelector('#revealPasswordBtn').addEventListener('click', (e) => {
+            const hidden = passwordField.type === 'password';
+            passwordField.type = hidden ? 'text' : 'password';
+            e.currentTarget.innerHTML = `<i class="fas fa-eye${hidden ? '-slash' : ''}"></i>`;
+        });
+        dialog.querySelector('#copyPasswordBtn').addEventListener('click', () => {
+            App.CopyToClipboard(generatedPassword).then(() => {
+                showToast('Password copied to clipboard!');
+            }).catch(err => {
+                console.error('Failed to copy to clipboard:', err);
+            });
+        });
+    }
+
     // Auto-copy URL to clipboard
     App.CopyToClipboard(url).then(() => {
         showToast('URL copied to clipboard!');
@@ -507,6 +926,8 @@ function showShareDialog(url) {
         console.error('Failed to copy to clipboard:', err);
     });
 
+    dialog.querySelector('#qrCodeBtn').addEventListener('click', () => showQRDialog(url));
+
     // Copy URL button
     dialog.querySelector('#copyUrlBtn').addEventListener('click', () => {
         App.CopyToClipboard(url).then(() => {
@@ -591,7 +1012,7 @@ async function loadShareHistory() {
             const createdDate = new Date(entry.createdAt).toLocaleDateString();
             const hasExpiry = entry.expiresAt && entry.expiresAt !== '';
             const expiryText = hasExpiry ? `Expires: ${new Date(entry.expiresAt).toLocaleDateString()}` : 'No expiry';
-            const passwordIcon = entry.hasPassword ? '<i class="fas fa-lock"></i> ' : '';
+            const passwordIcon = entry.hasPassword ? `<i class="fas fa-lock" title="${entry.passwordGenerated ? 'Generated password' : 'Password protected'}"></i> ` : '';
             const categoryName = entry.categoryName || '';
             const categoryDisplay = categoryName ? `<i class="fas fa-folder"></i> ${categoryName} • ` : '';
 
@@ -609,9 +1030,15 @@ async function loadShareHistory() {
                             <button class="menu-item copy-action" data-url="${entry.url}">
                                 <i class="fas fa-copy"></i> Copy Link
                             </button>
+                            <button class="menu-item qr-action" data-url="${entry.url}">
+                                <i class="fas fa-qrcode"></i> QR Code
+                            </button>
                             <button class="menu-item revoke-action" data-linkid="${entry.linkId}">
                                 <i class="fas fa-ban"></i> Revoke Link
                             </button>
+                            <button class="menu-item download-action" data-docno="${entry.docNo}">
+                                <i class="fas fa-download"></i> Download &amp; Verify
+                            </button>
                             <button class="menu-item delete-action" data-docno="${entry.docNo}">
                                 <i class="fas fa-trash"></i> Delete Document
                             </button>
@@ -682,6 +1109,19 @@ async function loadShareHistory() {
             });
         });
 
+        // QR code handlers
+        historyList.querySelectorAll('.qr-action').forEach(btn => {
+            btn.addEventListener('click', (e) => {
+                e.preventDefault();
+                e.stopPropagation();
+                document.querySelectorAll('.action-menu').forEach(m => {
+                    m.style.display = 'none';
+                    m.parentElement.classList.remove('menu-active');
+                });
+                showQRDialog(btn.dataset.url);
+            });
+        });
+
         // Revoke handlers
         historyList.querySelectorAll('.revoke-action').forEach(btn => {
             btn.addEventListener('click', (e) => {
@@ -708,6 +1148,32 @@ async function loadShareHistory() {
             });
         });
 
+        // Download & verify handlers
+        historyList.querySelectorAll('.download-action').forEach(btn => {
+            btn.addEventListener('click', (e) => {
+                e.preventDefault();
+                e.stopPropagation();
+                const docNo = parseInt(btn.dataset.docno);
+                document.querySelectorAll('.action-menu').forEach(m => {
+                    m.style.display = 'none';
+                    m.parentElement.classList.remove('menu-active');
+                });
+
+                App.DownloadDocument(docNo).then(result => {
+                    if (!result.hasRecord) {
+                        showToast('No local hash recorded - content could not be verified', 'error');
+                    } else if (result.verified) {
+                        showToast(result.savedPath ? 'Saved - content matches what was shared' : 'Content matches what was shared');
+                    } else {
+                        showErrorDialog('Verification Failed', `The stored document does not match the hash recorded when it was shared.<br><br>Recorded: ${result.recordedSha256}<br>Current: ${result.sha256}`);
+                    }
+                }).catch(err => {
+                    console.error('Failed to download document:', err);
+                    showErrorDialog('Failed to Download Document', err?.message || 'Unknown error');
+                });
+            });
+        });
+
         // Delete handlers
         historyList.querySelectorAll('.delete-action').forEach(btn => {
             btn.addEventListener('click', (e) => {
@@ -806,37 +1272,43 @@ function setupEventListeners() {
     // Browse button
     browseBtn.addEventListener('click', async (e) => {
         e.stopPropagation();
-        try {
-            const path = await App.OpenFileDialog();
-            if (path && path !== '') {
-                handleDroppedFiles([path]);
-            }
-        } catch (err) {
-            console.error('Failed to open file dialog:', err);
-        }
+        await browseFiles();
     });
 
-    // Also make the entire drop zone clickable
-    dropZone.addEventListener('click', async () => {
+    // Folder button, adds the files in the folder
+    document.getElementById('browseFolderBtn').addEventListener('click', async (e) => {
+        e.stopPropagation();
         try {
-            const path = await App.OpenFileDialog();
+            const path = await App.OpenFolderDialog();
             if (path && path !== '') {
                 handleDroppedFiles([path]);
             }
         } catch (err) {
-            console.error('Failed to open file dialog:', err);
+            console.error('Failed to open folder dialog:', err);
         }
     });
+
+    // Also make the entire drop zone clickable
+    dropZone.addEventListener('click', browseFiles);
     
     // Password checkbox
     const passwordInput = document.getElementById('passwordInput');
     document.getElementById('passwordCheck').addEventListener('change', (e) => {
-        passwordInput.disabled = !e.target.checked;
         if (!e.target.checked) {
             passwordInput.value = '';
         }
+        syncPasswordInputs();
+    });
+    document.getElementById('passwordModeSelect').addEventListener('change', syncPasswordInputs);
+
+    // Email options only shown once recipients are entered
+    document.getElementById('recipientsInput').addEventListener('input', (e) => {
+        document.getElementById('emailOptionsRow').style.display = e.target.value.trim() ? 'flex' : 'none';
     });
 
+    // Each category may have its own share policy
+    document.getElementById('shareCategorySelect').addEventListener('change', applyShareRestrictions);
+
     // Expiry select
     expirySelect.addEventListener('change', (e) => {
         if (e.target.value === 'custom') {
@@ -862,13 +1334,15 @@ function setupEventListeners() {
         if (appState.files.length === 0) return;
 
         const hasPassword = document.getElementById('passwordCheck').checked;
-        const password = hasPassword ? document.getElementById('passwordInput').value : '';
+        const passwordMode = document.getElementById('passwordModeSelect').value;
+        const password = hasPassword && !passwordMode ? document.getElementById('passwordInput').value : '';
 
         let expiryDays = 0;
         let customExpiry = '';
         const expiryValue = expirySelect.value;
         if (expiryValue === 'custom') {
-            customExpiry = new Date(customDate.value).toISOString();
+            expiryDays = -1;
+            customExpiry = customDate.value; // Ends at the end of that day
         } else if (expiryValue !== 'never') {
             expiryDays = parseInt(expiryValue);
         }
@@ -878,19 +1352,44 @@ function setupEventListeners() {
 
         try {
             // Build request object matching backend ShareRequest struct
+            const recipients = document.getElementById('recipientsInput').value
+                .split(',').map(r => r.trim()).filter(r => r);
             const shareRequest = {
                 files: appState.files.map(f => f.path),
                 password: password,
                 expiryDays: expiryDays,
-                customExpiry: customExpiry
+                customExpiry: customExpiry,
+                recipients: recipients,
+                message: document.getElementById('messageInput').value,
+                sendPassword: document.getElementById('sendPasswordCheck').checked,
+                categoryNo: parseInt(document.getElementById('shareCategorySelect').value) || 0
             };
+            if (hasPassword && passwordMode) {
+                shareRequest.generatePassword = { mode: passwordMode };
+            }
 
             const response = await App.ShareFiles(shareRequest);
 
             // Remove overlay
             overlay.remove();
 
-            showShareDialog(response.url);
+            showShareDialog(response.url, response.generatedPassword);
+
+            if (response.category && response.category.rule !== 'default category') {
+                showToast(`Filed in category ${response.category.categoryNo} by ${response.category.rule}`);
+            }
+
+            if (response.dlp?.length) {
+                showToast(`Shared under DLP rule ${[...new Set(response.dlp.map(m => m.rule))].join(', ')}`);
+            }
+
+            if (response.email) {
+                if (response.email.status === 'sent') {
+                    showToast(`Link emailed to ${response.email.recipients.join(', ')}`);
+                } else {
+                    showErrorDialog('Email Not Sent', `The link was created but could not be emailed: ${response.email.error}`);
+                }
+            }
         } catch (err) {
             console.error('Failed to share files:', err);
 
@@ -918,22 +1417,49 @@ function setupEventListeners() {
 }
 
 // ==================== File Handling ====================
+async function browseFiles() {
+    try {
+        const paths = await App.OpenFileDialog();
+        if (paths && paths.length > 0) {
+            handleDroppedFiles(paths);
+        }
+    } catch (err) {
+        console.error('Failed to open file dialog:', err);
+    }
+}
+
+// Adds files and the files in folders, warning about files that were skipped or
+// that exceed the configured limits
 async function handleDroppedFiles(paths) {
-    for (const path of paths) {
-        // Check if file already exists
-        if (appState.files.some(f => f.path === path)) {
+    const newPaths = paths.filter(path => !appState.files.some(f => f.path === path));
+    if (newPaths.length === 0) {
+        return;
+    }
+
+    let selection;
+    try {
+        selection = await App.GetFilesInfo(newPaths);
+    } catch (err) {
+        console.error('Failed to get file info for', newPaths, err);
+        return;
+    }
+
+    const warnings = [...(selection.warnings || [])];
+    for (const fileInfo of selection.files) {
+        // Check if file already exists, folders can contain files added before
+        if (appState.files.some(f => f.path === fileInfo.path)) {
             continue;
         }
-
-        try {
-            const fileInfo = await App.GetFileInfo(path);
-            appState.files.push(fileInfo);
-        } catch (err) {
-            console.error('Failed to get file info for', path, err);
+        appState.files.push(fileInfo);
+        if (fileInfo.warning) {
+            warnings.push(`${fileInfo.name}: ${fileInfo.warning}`);
         }
     }
 
     updateFileList();
+    if (warnings.length > 0) {
+        showToast(warnings.join('<br>'), 'error');
+    }
 }
 
 function showUploadOverlay() {
@@ -1016,6 +1542,18 @@ function setupFileDrawer() {
     });
 }
 
+// The password can be typed only when it is switched on and not generated
+function syncPasswordInputs() {
+    const passwordCheck = document.getElementById('passwordCheck');
+    const passwordInput = document.getElementById('passwordInput');
+    const passwordModeSelect = document.getElementById('passwordModeSelect');
+    const generated = passwordModeSelect.value !== '';
+    passwordModeSelect.disabled = !passwordCheck.checked;
+    passwordInput.disabled = !passwordCheck.checked || generated;
+    passwordInput.placeholder = generated ? 'Generated when shared' : 'Enter password';
+    if (generated) passwordInput.value = '';
+}
+
 function updateFileList() {
     const fileBadge = document.getElementById('fileBadge');
     const badgeCount = document.getElementById('badgeCount');
@@ -1024,6 +1562,7 @@ function updateFileList() {
     const passwordCheck = document.getElementById('passwordCheck');
     const passwordInput = document.getElementById('passwordInput');
     const expirySelect = document.getElementById('expirySelect');
+    const recipientsInput = document.getElementById('recipientsInput');
     const shareBtn = document.getElementById('shareBtn');
 
     const fileCount = appState.files.length;
@@ -1035,9 +1574,10 @@ function updateFileList() {
         // Disable options
         passwordCheck.disabled = true;
         passwordCheck.checked = false;
-        passwordInput.disabled = true;
         passwordInput.value = '';
+        syncPasswordInputs();
         expirySelect.disabled = true;
+        recipientsInput.disabled = true;
 
         // Disable share button
         shareBtn.disabled = true;
@@ -1047,13 +1587,16 @@ function updateFileList() {
     // Show badge
     fileBadge.style.visibility = 'visible';
     badgeCount.textContent = fileCount;
-    fileBadgeText.textContent = `${fileCount} file${fileCount !== 1 ? 's' : ''} selected`;
-
-    // Enable options
-    passwordCheck.disabled = false;
-    // Password input only enabled if checkbox is checked
-    passwordInput.disabled = !passwordCheck.checked;
+    const totalSize = appState.files.reduce((sum, f) => sum + f.size, 0);
+    fileBadgeText.textContent = `${fileCount} file${fileCount !== 1 ? 's' : ''} selected (${formatFileSize(totalSize)})`;
+
+    // Enable options, a required password can't be switched off
+    const passwordRequired = !!appState.sharePolicy?.require_password;
+    passwordCheck.disabled = passwordRequired;
+    if (passwordRequired) passwordCheck.checked = true;
+    syncPasswordInputs();
     expirySelect.disabled = false;
+    recipientsInput.disabled = false;
 
     // Enable share button
     shareBtn.disabled = false;
@@ -1061,7 +1604,7 @@ function updateFileList() {
     // Update drawer file list
     filesContainer.innerHTML = appState.files.map((file, index) => `
         <div class="file-item">
-            <i class="fas fa-file"></i>
+            <i class="fas ${file.warning ? 'fa-exclamation-triangle' : 'fa-file'}" ${file.warning ? `title="${file.warning.replace(/"/g, '&quot;')}"` : ''}></i>
             <span class="file-name">${file.name}</span>
             <span class="file-size">${formatFileSize(file.size)}</span>
             <button class="file-remove" data-index="${index}" title="Remove file">
@@ -1123,6 +1666,59 @@ function showConfirmDialog(message, onConfirm) {
 }
 
 // ==================== Error Dialog ====================
+// Shows a share link as a QR code, for handing it to someone in person or printing it
+function showQRDialog(url) {
+    const overlay = document.createElement('div');
+    overlay.className = 'modal-overlay';
+    overlay.innerHTML = `
+        <div class="modal">
+            <h3><i class="fas fa-qrcode"></i> QR Code</h3>
+            <img id="qrImage" alt="QR code of the share link" style="width: 256px; height: 256px; margin: 8px auto; display: block; background: #fff;">
+            <div class="option-row" style="justify-content: center;">
+                <label>Error correction:</label>
+                <select class="select" id="qrLevelSelect" title="Higher levels still scan when the code is damaged or partly covered">
+                    <option value="L">Low</option>
+                    <option value="M" selected>Medium</option>
+                    <option value="Q">Quartile</option>
+                    <option value="H">High</option>
+                </select>
+            </div>
+            <div class="modal-actions">
+                <button class="btn btn-secondary" id="savePngBtn"><i class="fas fa-download"></i> PNG</button>
+                <button class="btn btn-secondary" id="saveSvgBtn"><i class="fas fa-download"></i> SVG</button>
+                <button class="btn btn-primary" id="closeQRBtn">Close</button>
+            </div>
+        </div>
+    `;
+    document.body.appendChild(overlay);
+
+    const levelSelect = overlay.querySelector('#qrLevelSelect');
+    const render = async () => {
+        try {
+            overlay.querySelector('#qrImage').src = await App.GetQRCode(url, { format: 'png', size: 512, level: levelSelect.value });
+        } catch (err) {
+            overlay.remove();
+            showErrorDialog('QR Code Failed', err?.message || String(err));
+        }
+    };
+    const save = async (format) => {
+        try {
+            const path = await App.SaveQRCode(url, { format, size: 1024, level: levelSelect.value });
+            if (path) showToast('QR code saved');
+        } catch (err) {
+            showErrorDialog('Failed to Save QR Code', err?.message || String(err));
+        }
+    };
+    levelSelect.addEventListener('change', render);
+    overlay.querySelector('#savePngBtn').addEventListener('click', () => save('png'));
+    overlay.querySelector('#saveSvgBtn').addEventListener('click', () => save('svg'));
+    overlay.querySelector('#closeQRBtn').addEventListener('click', () => overlay.remove());
+    overlay.addEventListener('click', (e) => {
+        if (e.target === overlay) overlay.remove();
+    });
+    render();
+}
+
 function showErrorDialog(title, message) {
     const overlay = document.createElement('div');
     overlay.className = 'modal-overlay';
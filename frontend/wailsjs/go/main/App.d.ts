@@ -8,22 +8,56 @@ export function CopyToClipboard(arg1:string):Promise<void>;
 
 export function DeleteDocument(arg1:number):Promise<void>;
 
+export function DownloadDocument(arg1:number):Promise<main.DocumentVerification>;
+
+export function ExportSettings(arg1:string):Promise<string>;
+
+export function GeneratePassword(arg1:main.PasswordOptions,arg2:number):Promise<string>;
+
 export function GetCategories(arg1:main.TestConnectionRequest):Promise<Array<main.CategoryInfo>>;
 
+export function GetCategoryStatus():Promise<main.CategoryStatus>;
+
 export function GetConfig():Promise<main.Config>;
 
 export function GetFileInfo(arg1:string):Promise<main.FileInfo>;
 
+export function GetFilesInfo(arg1:Array<string>):Promise<main.FileSelection>;
+
+export function GetQRCode(arg1:string,arg2:main.QROptions):Promise<string>;
+
+export function GetShareCategories():Promise<Array<main.CategoryInfo>>;
+
 export function GetShareHistory():Promise<Array<main.ShareHistoryEntry>>;
 
+export function GetSharePolicy(arg1:number):Promise<main.SharePolicy>;
+
 export function HasStoredCredentials():Promise<boolean>;
 
-export function OpenFileDialog():Promise<string>;
+export function ImportSettings(arg1:main.SettingsImportRequest):Promise<main.ImportPreview>;
+
+export function OpenFileDialog():Promise<Array<string>>;
+
+export function OpenFolderDialog():Promise<string>;
+
+export function PreviewSettingsImport(arg1:main.SettingsImportRequest):Promise<main.ImportPreview>;
 
 export function RevokeSharedLink(arg1:string):Promise<void>;
 
 export function SaveConfig(arg1:main.Config):Promise<void>;
 
+export function SaveQRCode(arg1:string,arg2:main.QROptions):Promise<string>;
+
+export function SearchCategories(arg1:string):Promise<Array<main.CategoryInfo>>;
+
+export function SelectSettingsBundle():Promise<string>;
+
+export function SendTestEmail(arg1:string):Promise<void>;
+
 export function SetAuthCredentials(arg1:string,arg2:string,arg3:string,arg4:string):Promise<void>;
 
+export function SetSMTPPassword(arg1:string):Promise<void>;
+
 export function ShareFiles(arg1:main.ShareRequest):Promise<main.ShareResponse>;
+
+export function ValidateRoutingRules():Promise<Array<string>>;
@@ -14,10 +14,26 @@ export function DeleteDocument(arg1) {
   return window['go']['main']['App']['DeleteDocument'](arg1);
 }
 
+export function DownloadDocument(arg1) {
+  return window['go']['main']['App']['DownloadDocument'](arg1);
+}
+
+export function ExportSettings(arg1) {
+  return window['go']['main']['App']['ExportSettings'](arg1);
+}
+
+export function GeneratePassword(arg1, arg2) {
+  return window['go']['main']['App']['GeneratePassword'](arg1, arg2);
+}
+
 export function GetCategories(arg1) {
   return window['go']['main']['App']['GetCategories'](arg1);
 }
 
+export function GetCategoryStatus() {
+  return window['go']['main']['App']['GetCategoryStatus']();
+}
+
 export function GetConfig() {
   return window['go']['main']['App']['GetConfig']();
 }
@@ -26,18 +42,46 @@ export function GetFileInfo(arg1) {
   return window['go']['main']['App']['GetFileInfo'](arg1);
 }
 
+export function GetFilesInfo(arg1) {
+  return window['go']['main']['App']['GetFilesInfo'](arg1);
+}
+
+export function GetQRCode(arg1, arg2) {
+  return window['go']['main']['App']['GetQRCode'](arg1, arg2);
+}
+
+export function GetShareCategories() {
+  return window['go']['main']['App']['GetShareCategories']();
+}
+
 export function GetShareHistory() {
   return window['go']['main']['App']['GetShareHistory']();
 }
 
+export function GetSharePolicy(arg1) {
+  return window['go']['main']['App']['GetSharePolicy'](arg1);
+}
+
 export function HasStoredCredentials() {
   return window['go']['main']['App']['HasStoredCredentials']();
 }
 
+export function ImportSettings(arg1) {
+  return window['go']['main']['App']['ImportSettings'](arg1);
+}
+
 export function OpenFileDialog() {
   return window['go']['main']['App']['OpenFileDialog']();
 }
 
+export function OpenFolderDialog() {
+  return window['go']['main']['App']['OpenFolderDialog']();
+}
+
+export function PreviewSettingsImport(arg1) {
+  return window['go']['main']['App']['PreviewSettingsImport'](arg1);
+}
+
 export function RevokeSharedLink(arg1) {
   return window['go']['main']['App']['RevokeSharedLink'](arg1);
 }
@@ -46,10 +90,34 @@ export function SaveConfig(arg1) {
   return window['go']['main']['App']['SaveConfig'](arg1);
 }
 
+export function SaveQRCode(arg1, arg2) {
+  return window['go']['main']['App']['SaveQRCode'](arg1, arg2);
+}
+
+export function SearchCategories(arg1) {
+  return window['go']['main']['App']['SearchCategories'](arg1);
+}
+
+export function SelectSettingsBundle() {
+  return window['go']['main']['App']['SelectSettingsBundle']();
+}
+
+export function SendTestEmail(arg1) {
+  return window['go']['main']['App']['SendTestEmail'](arg1);
+}
+
 export function SetAuthCredentials(arg1, arg2, arg3, arg4) {
   return window['go']['main']['App']['SetAuthCredentials'](arg1, arg2, arg3, arg4);
 }
 
+export function SetSMTPPassword(arg1) {
+  return window['go']['main']['App']['SetSMTPPassword'](arg1);
+}
+
 export function ShareFiles(arg1) {
   return window['go']['main']['App']['ShareFiles'](arg1);
 }
+
+export function ValidateRoutingRules() {
+  return window['go']['main']['App']['ValidateRoutingRules']();
+}
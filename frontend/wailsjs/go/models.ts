@@ -16,7 +16,44 @@ export namespace main {
 	        this.path = source["path"];
 	    }
 	}
+	export class CategoryRoute {
+	    categoryNo: number;
+	    rule: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new CategoryRoute(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.categoryNo = source["categoryNo"];
+	        this.rule = source["rule"];
+	    }
+	}
+	export class CategoryStatus {
+	    categoryNo: number;
+	    configuredName: string;
+	    currentName?: string;
+	    exists: boolean;
+	    renamed: boolean;
+	    message?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new CategoryStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.categoryNo = source["categoryNo"];
+	        this.configuredName = source["configuredName"];
+	        this.currentName = source["currentName"];
+	        this.exists = source["exists"];
+	        this.renamed = source["renamed"];
+	        this.message = source["message"];
+	    }
+	}
 	export class Config {
+	    schema_version: number;
 	    base_url: string;
 	    tenant_name: string;
 	    category_no: number;
@@ -24,6 +61,24 @@ export namespace main {
 	    auth_type: string;
 	    is_set_up: boolean;
 	    default_archive: string;
+	    smtp_host: string;
+	    smtp_port: number;
+	    smtp_security: string;
+	    smtp_username: string;
+	    smtp_from: string;
+	    dlp_rules?: DLPRule[];
+	    routing_rules?: RoutingRule[];
+	    allowed_categories?: number[];
+	    category_cache_minutes?: number;
+	    share_policies?: SharePolicy[];
+	    require_password?: boolean;
+	    max_expiry_days?: number;
+	    allowed_file_types?: string[];
+	    file_filters?: FileFilter[];
+	    tray_mode?: boolean;
+	    logging: LogConfig;
+	    tracing: TracingConfig;
+	    policy_locked?: string[];
 	
 	    static createFrom(source: any = {}) {
 	        return new Config(source);
@@ -31,6 +86,7 @@ export namespace main {
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.schema_version = source["schema_version"];
 	        this.base_url = source["base_url"];
 	        this.tenant_name = source["tenant_name"];
 	        this.category_no = source["category_no"];
@@ -38,12 +94,167 @@ export namespace main {
 	        this.auth_type = source["auth_type"];
 	        this.is_set_up = source["is_set_up"];
 	        this.default_archive = source["default_archive"];
+	        this.smtp_host = source["smtp_host"];
+	        this.smtp_port = source["smtp_port"];
+	        this.smtp_security = source["smtp_security"];
+	        this.smtp_username = source["smtp_username"];
+	        this.smtp_from = source["smtp_from"];
+	        this.dlp_rules = this.convertValues(source["dlp_rules"], DLPRule);
+	        this.routing_rules = this.convertValues(source["routing_rules"], RoutingRule);
+	        this.allowed_categories = source["allowed_categories"];
+	        this.category_cache_minutes = source["category_cache_minutes"];
+	        this.share_policies = this.convertValues(source["share_policies"], SharePolicy);
+	        this.require_password = source["require_password"];
+	        this.max_expiry_days = source["max_expiry_days"];
+	        this.allowed_file_types = source["allowed_file_types"];
+	        this.file_filters = this.convertValues(source["file_filters"], FileFilter);
+	        this.tray_mode = source["tray_mode"];
+	        this.logging = this.convertValues(source["logging"], LogConfig);
+	        this.tracing = this.convertValues(source["tracing"], TracingConfig);
+	        this.policy_locked = source["policy_locked"];
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class DLPMatch {
+	    rule: string;
+	    action: string;
+	    file: string;
+	    reason: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DLPMatch(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.rule = source["rule"];
+	        this.action = source["action"];
+	        this.file = source["file"];
+	        this.reason = source["reason"];
+	    }
+	}
+	export class DLPRule {
+	    name: string;
+	    action: string;
+	    patterns: string[];
+	    detectors: string[];
+	    extensions: string[];
+	    filename_patterns: string[];
+	    max_file_bytes: number;
+	    max_expiry_days: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new DLPRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.action = source["action"];
+	        this.patterns = source["patterns"];
+	        this.detectors = source["detectors"];
+	        this.extensions = source["extensions"];
+	        this.filename_patterns = source["filename_patterns"];
+	        this.max_file_bytes = source["max_file_bytes"];
+	        this.max_expiry_days = source["max_expiry_days"];
+	    }
+	}
+	export class DocumentVerification {
+	    docNo: number;
+	    filename: string;
+	    size: number;
+	    sha256: string;
+	    recordedSha256?: string;
+	    hasRecord: boolean;
+	    verified: boolean;
+	    savedPath?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DocumentVerification(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.docNo = source["docNo"];
+	        this.filename = source["filename"];
+	        this.size = source["size"];
+	        this.sha256 = source["sha256"];
+	        this.recordedSha256 = source["recordedSha256"];
+	        this.hasRecord = source["hasRecord"];
+	        this.verified = source["verified"];
+	        this.savedPath = source["savedPath"];
+	    }
+	}
+	export class EmailDelivery {
+	    recipients: string[];
+	    status: string;
+	    error?: string;
+	    passwordSent: boolean;
+	    sentAt: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new EmailDelivery(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.recipients = source["recipients"];
+	        this.status = source["status"];
+	        this.error = source["error"];
+	        this.passwordSent = source["passwordSent"];
+	        this.sentAt = source["sentAt"];
+	    }
+	}
+	export class FieldError {
+	    field: string;
+	    message: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FieldError(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.field = source["field"];
+	        this.message = source["message"];
+	    }
+	}
+	export class FileFilter {
+	    name: string;
+	    extensions: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new FileFilter(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.extensions = source["extensions"];
 	    }
 	}
 	export class FileInfo {
 	    name: string;
 	    path: string;
 	    size: number;
+	    warning?: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new FileInfo(source);
@@ -54,6 +265,197 @@ export namespace main {
 	        this.name = source["name"];
 	        this.path = source["path"];
 	        this.size = source["size"];
+	        this.warning = source["warning"];
+	    }
+	}
+	export class FileSelection {
+	    files: FileInfo[];
+	    totalSize: number;
+	    warnings?: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new FileSelection(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.files = this.convertValues(source["files"], FileInfo);
+	        this.totalSize = source["totalSize"];
+	        this.warnings = source["warnings"];
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class ImportPreview {
+	    app: string;
+	    exportedAt: string;
+	    profiles: string[];
+	    hasCredentials: boolean;
+	    credentialsApplied: boolean;
+	    changes: SettingChange[];
+	    errors: FieldError[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ImportPreview(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.app = source["app"];
+	        this.exportedAt = source["exportedAt"];
+	        this.profiles = source["profiles"];
+	        this.hasCredentials = source["hasCredentials"];
+	        this.credentialsApplied = source["credentialsApplied"];
+	        this.changes = this.convertValues(source["changes"], SettingChange);
+	        this.errors = this.convertValues(source["errors"], FieldError);
+	    }
+
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class LogConfig {
+	    level: string;
+	    format: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new LogConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.level = source["level"];
+	        this.format = source["format"];
+	    }
+	}
+	export class PasswordOptions {
+	    mode?: string;
+	    length?: number;
+	    lowercase?: boolean;
+	    uppercase?: boolean;
+	    digits?: boolean;
+	    symbols?: boolean;
+	    words?: number;
+	    separator?: string;
+	    capitalize?: boolean;
+	    number?: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new PasswordOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.mode = source["mode"];
+	        this.length = source["length"];
+	        this.lowercase = source["lowercase"];
+	        this.uppercase = source["uppercase"];
+	        this.digits = source["digits"];
+	        this.symbols = source["symbols"];
+	        this.words = source["words"];
+	        this.separator = source["separator"];
+	        this.capitalize = source["capitalize"];
+	        this.number = source["number"];
+	    }
+	}
+	export class QROptions {
+	    format?: string;
+	    size?: number;
+	    level?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new QROptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.format = source["format"];
+	        this.size = source["size"];
+	        this.level = source["level"];
+	    }
+	}
+	export class RoutingRule {
+	    name: string;
+	    category_no: number;
+	    extensions: string[];
+	    min_total_bytes: number;
+	    max_total_bytes: number;
+	    users: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new RoutingRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.category_no = source["category_no"];
+	        this.extensions = source["extensions"];
+	        this.min_total_bytes = source["min_total_bytes"];
+	        this.max_total_bytes = source["max_total_bytes"];
+	        this.users = source["users"];
+	    }
+	}
+	export class SettingChange {
+	    field: string;
+	    from: string;
+	    to: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SettingChange(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.field = source["field"];
+	        this.from = source["from"];
+	        this.to = source["to"];
+	    }
+	}
+	export class SettingsImportRequest {
+	    path?: string;
+	    passphrase: string;
+	    profile: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SettingsImportRequest(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.passphrase = source["passphrase"];
+	        this.profile = source["profile"];
 	    }
 	}
 	export class ShareHistoryEntry {
@@ -65,6 +467,7 @@ export namespace main {
 	    expiresAt: string;
 	    hasPassword: boolean;
 	    categoryName: string;
+	    passwordGenerated: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new ShareHistoryEntry(source);
@@ -80,6 +483,35 @@ export namespace main {
 	        this.expiresAt = source["expiresAt"];
 	        this.hasPassword = source["hasPassword"];
 	        this.categoryName = source["categoryName"];
+	        this.passwordGenerated = source["passwordGenerated"];
+	    }
+	}
+	export class SharePolicy {
+	    name: string;
+	    categories?: number[];
+	    roles?: string[];
+	    require_password?: boolean;
+	    min_password_length?: number;
+	    min_password_classes?: number;
+	    max_expiry_days?: number;
+	    require_expiry?: boolean;
+	    default_expiry_days?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SharePolicy(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.categories = source["categories"];
+	        this.roles = source["roles"];
+	        this.require_password = source["require_password"];
+	        this.min_password_length = source["min_password_length"];
+	        this.min_password_classes = source["min_password_classes"];
+	        this.max_expiry_days = source["max_expiry_days"];
+	        this.require_expiry = source["require_expiry"];
+	        this.default_expiry_days = source["default_expiry_days"];
 	    }
 	}
 	export class ShareRequest {
@@ -87,6 +519,11 @@ export namespace main {
 	    password: string;
 	    expiryDays: number;
 	    customExpiry: string;
+	    recipients: string[];
+	    message: string;
+	    sendPassword: boolean;
+	    categoryNo: number;
+	    generatePassword?: PasswordOptions;
 	
 	    static createFrom(source: any = {}) {
 	        return new ShareRequest(source);
@@ -98,12 +535,39 @@ export namespace main {
 	        this.password = source["password"];
 	        this.expiryDays = source["expiryDays"];
 	        this.customExpiry = source["customExpiry"];
+	        this.recipients = source["recipients"];
+	        this.message = source["message"];
+	        this.sendPassword = source["sendPassword"];
+	        this.categoryNo = source["categoryNo"];
+	        this.generatePassword = this.convertValues(source["generatePassword"], PasswordOptions);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class ShareResponse {
 	    url: string;
 	    docNo: number;
 	    expiresAt?: string;
+	    email?: EmailDelivery;
+	    dlp?: DLPMatch[];
+	    category?: CategoryRoute;
+	    generatedPassword?: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new ShareResponse(source);
@@ -114,7 +578,29 @@ export namespace main {
 	        this.url = source["url"];
 	        this.docNo = source["docNo"];
 	        this.expiresAt = source["expiresAt"];
+	        this.email = this.convertValues(source["email"], EmailDelivery);
+	        this.dlp = this.convertValues(source["dlp"], DLPMatch);
+	        this.category = this.convertValues(source["category"], CategoryRoute);
+	        this.generatedPassword = source["generatedPassword"];
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class TestConnectionRequest {
 	    baseURL: string;
@@ -138,6 +624,22 @@ export namespace main {
 	        this.token = source["token"];
 	    }
 	}
+	export class TracingConfig {
+	    endpoint: string;
+	    headers?: Record<string, string>;
+	    sample_ratio: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TracingConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.endpoint = source["endpoint"];
+	        this.headers = source["headers"];
+	        this.sample_ratio = source["sample_ratio"];
+	    }
+	}
 
 }
 
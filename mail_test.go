@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpSink is a local SMTP server that keeps the messages it receives
+type smtpSink struct {
+	host string
+	port int
+
+	mu       sync.Mutex
+	messages []*mail.Message
+	accept   int // Messages accepted before DATA is refused, -1 = all
+}
+
+// newSMTPSink starts a sink that accepts the first accept messages, -1 for all
+func newSMTPSink(t *testing.T, accept int) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	addr := ln.Addr().(*net.TCPAddr)
+	s := &smtpSink{host: addr.IP.String(), port: addr.Port, accept: accept}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) mailer() *Mailer {
+	return &Mailer{Host: s.host, Port: s.port, Security: SMTPSecurityNone, From: "Sharer <sharer@example.com>"}
+}
+
+func (s *smtpSink) received() []*mail.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*mail.Message(nil), s.messages...)
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 sink ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb := strings.ToUpper(strings.Fields(line + " ")[0]); verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 sink")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			s.mu.Lock()
+			refuse := s.accept >= 0 && len(s.messages) >= s.accept
+			s.mu.Unlock()
+			if refuse {
+				tp.PrintfLine("554 Message refused")
+				continue
+			}
+			tp.PrintfLine("354 Go ahead")
+			msg, err := mail.ReadMessage(bufio.NewReader(tp.DotReader()))
+			if err != nil {
+				tp.PrintfLine("500 Bad message")
+				continue
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 Queued")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+// messageText returns the decoded subject and text/plain part of a message
+func messageText(t *testing.T, msg *mail.Message) (string, string) {
+	t.Helper()
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("bad subject: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("bad content type: %v", err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("no text part: %v", err)
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			body, _ := io.ReadAll(part)
+			return subject, string(body)
+		}
+	}
+}
+
+func TestDeliverShareEmailSendsPasswordSeparately(t *testing.T) {
+	sink := newSMTPSink(t, -1)
+	email := ShareEmail{
+		Recipients:   []string{"alice@example.com", "bob@example.com"},
+		Message:      "Here is the report",
+		URL:          "https://therefore.example.com/share?id=abc123",
+		Filename:     "report.pdf",
+		ExpiresAt:    "2026-11-01T00:00:00Z",
+		Password:     "s3cret-Passw0rd",
+		SendPassword: true,
+	}
+
+	delivery := deliverShareEmail(sink.mailer(), email)
+	if delivery.Status != "sent" || delivery.Error != "" || !delivery.PasswordSent || delivery.SentAt == "" {
+		t.Fatalf("delivery = %+v", delivery)
+	}
+
+	messages := sink.received()
+	if len(messages) != 2 {
+		t.Fatalf("received %d messages, want the link and the password separately", len(messages))
+	}
+	subject, body := messageText(t, messages[0])
+	if subject != "File shared with you: report.pdf" || !strings.Contains(body, email.URL) || !strings.Contains(body, "1 November 2026") {
+		t.Errorf("link email = %q\n%s", subject, body)
+	}
+	if strings.Contains(body, email.Password) {
+		t.Error("link email contains the password")
+	}
+	if to := messages[0].Header.Get("To"); to != "alice@example.com, bob@example.com" {
+		t.Errorf("To = %q", to)
+	}
+
+	subject, body = messageText(t, messages[1])
+	if subject != "Password for report.pdf" || !strings.Contains(body, email.Password) {
+		t.Errorf("password email = %q\n%s", subject, body)
+	}
+	if strings.Contains(body, email.URL) {
+		t.Error("password email contains the link")
+	}
+}
+
+func TestDeliverShareEmailWithoutPassword(t *testing.T) {
+	sink := newSMTPSink(t, -1)
+	email := ShareEmail{
+		Recipients: []string{"alice@example.com"},
+		URL:        "https://therefore.example.com/share?id=abc123",
+		Filename:   "report.pdf",
+		Password:   "s3cret-Passw0rd", // Set on the link but not to be emailed
+	}
+
+	delivery := deliverShareEmail(sink.mailer(), email)
+	if delivery.Status != "sent" || delivery.PasswordSent {
+		t.Fatalf("delivery = %+v", delivery)
+	}
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("received %d messages, want 1", len(messages))
+	}
+	if _, body := messageText(t, messages[0]); strings.Contains(body, email.Password) || strings.Contains(body, "separate email") {
+		t.Errorf("link email mentions the password:\n%s", body)
+	}
+}
+
+func TestDeliverShareEmailRecordsFailures(t *testing.T) {
+	email := ShareEmail{
+		Recipients:   []string{"alice@example.com"},
+		URL:          "https://therefore.example.com/share?id=abc123",
+		Filename:     "report.pdf",
+		Password:     "s3cret-Passw0rd",
+		SendPassword: true,
+	}
+
+	// The link is sent but the password email is refused
+	sink := newSMTPSink(t, 1)
+	delivery := deliverShareEmail(sink.mailer(), email)
+	if delivery.Status != "failed" || delivery.PasswordSent || !strings.Contains(delivery.Error, "password email failed") {
+		t.Errorf("delivery = %+v", delivery)
+	}
+	if n := len(sink.received()); n != 1 {
+		t.Errorf("received %d messages, want only the link", n)
+	}
+
+	// Nothing listens on the port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	portNo, _ := strconv.Atoi(port)
+	mailer := &Mailer{Host: host, Port: portNo, Security: SMTPSecurityNone, From: "sharer@example.com"}
+	delivery = deliverShareEmail(mailer, email)
+	if delivery.Status != "failed" || !strings.Contains(delivery.Error, "failed to connect") {
+		t.Errorf("delivery = %+v", delivery)
+	}
+}
+
+func TestParseRecipients(t *testing.T) {
+	got, err := ParseRecipients("Alice <alice@example.com>, bob@example.com")
+	if err != nil || fmt.Sprint(got) != "[alice@example.com bob@example.com]" {
+		t.Errorf("ParseRecipients = %v, %v", got, err)
+	}
+	if _, err := ParseRecipients("not an address"); err == nil {
+		t.Error("ParseRecipients accepted an invalid address")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const policyFileName = "policy.json"
+
+// GetPolicyPath returns the system-wide policy file IT deploys to lock settings. It lives
+// outside the user's profile so that only administrators can change it.
+func GetPolicyPath() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join("/Library", "Application Support", appName, policyFileName)
+	case "windows":
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return filepath.Join(programData, appName, policyFileName)
+	default: // Linux and others
+		return filepath.Join("/etc", appName, policyFileName)
+	}
+}
+
+// loadPolicy reads the system policy: config fields by their JSON name, each locked to
+// its value. No policy file means nothing is locked. A policy that can't be read is an
+// error rather than ignored, so a broken deployment doesn't silently unlock settings.
+func loadPolicy() (map[string]json.RawMessage, error) {
+	path := GetPolicyPath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system policy at %s: %w", path, err)
+	}
+
+	var policy map[string]json.RawMessage
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid system policy at %s: %w", path, err)
+	}
+	fields := configFieldNames()
+	for key := range policy {
+		if !fields[key] {
+			return nil, fmt.Errorf("invalid system policy at %s: unknown setting %q", path, key)
+		}
+	}
+	return policy, nil
+}
+
+// configFieldNames lists the JSON names of the config fields a policy may lock
+func configFieldNames() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" && name != "schema_version" && name != "policy_locked" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// applyPolicy sets the locked fields of config to their policy values and lists them
+// in PolicyLocked
+func applyPolicy(config *Config, policy map[string]json.RawMessage) error {
+	config.PolicyLocked = nil
+	if len(policy) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("invalid system policy at %s: %w", GetPolicyPath(), err)
+	}
+	for key := range policy {
+		config.PolicyLocked = append(config.PolicyLocked, key)
+	}
+	sort.Strings(config.PolicyLocked)
+	return nil
+}
+
+// checkPolicyLocks rejects changes to locked fields. Locked fields of config, which hold
+// the policy values after the check, are replaced by the user's own values from stored,
+// so the config file never takes on policy values.
+func checkPolicyLocks(config, stored *Config, policy map[string]json.RawMessage) error {
+	if len(policy) == 0 {
+		return nil
+	}
+	locked := &Config{}
+	if err := applyPolicy(locked, policy); err != nil {
+		return err
+	}
+	want, err := settingsTree(locked)
+	if err != nil {
+		return err
+	}
+	got, err := settingsTree(config)
+	if err != nil {
+		return err
+	}
+	own, err := settingsTree(stored)
+	if err != nil {
+		return err
+	}
+
+	invalid := &ValidationError{}
+	for _, key := range locked.PolicyLocked {
+		if !reflect.DeepEqual(got[key], want[key]) {
+			invalid.Add(key, "is locked by the system policy")
+		}
+		if v, ok := own[key]; ok {
+			got[key] = v
+		} else {
+			delete(got, key)
+		}
+	}
+	if err := invalid.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(got)
+	if err != nil {
+		return err
+	}
+	restored := Config{}
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return err
+	}
+	*config = restored
+	return nil
+}
+
+// SharePolicy returns the share policy for a category: the share policies that apply
+// to it, and the mandatory password and maximum expiry of the config, usually locked by
+// the system policy
+func (c *Config) SharePolicy(categoryNo int) SharePolicy {
+	policies := c.SharePolicies
+	if c.RequirePassword || c.MaxExpiryDays > 0 {
+		policies = append(append([]SharePolicy{}, policies...), SharePolicy{
+			Name:            "organization policy",
+			RequirePassword: c.RequirePassword,
+			MaxExpiryDays:   c.MaxExpiryDays,
+		})
+	}
+	return EffectiveSharePolicy(policies, categoryNo, "")
+}
+
+// CheckShareRestrictions enforces the file types and, when the system policy locks
+// them, the categories a share may use
+func (c *Config) CheckShareRestrictions(files []string, categoryNo int) error {
+	if len(c.AllowedFileTypes) > 0 {
+		for _, path := range files {
+			if !hasExtension(c.AllowedFileTypes, path) {
+				return fmt.Errorf("%s: only these file types may be shared: %s", filepath.Base(path), strings.Join(c.AllowedFileTypes, ", "))
+			}
+		}
+	}
+	if c.isPolicyLocked("allowed_categories") {
+		for _, no := range c.AllowedCategories {
+			if no == categoryNo {
+				return nil
+			}
+		}
+		return fmt.Errorf("category %d is not allowed by the system policy", categoryNo)
+	}
+	return nil
+}
+
+func (c *Config) isPolicyLocked(key string) bool {
+	for _, k := range c.PolicyLocked {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QR code image formats
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+)
+
+// qrLevels maps the error correction levels to the share of the code that may be damaged
+// or covered and still read: L 7%, M 15%, Q 25% and H 30%
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// QROptions configures a rendered QR code
+type QROptions struct {
+	Format string `json:"format,omitempty"` // "png" (default) or "svg"
+	Size   int    `json:"size,omitempty"`   // Width and height in pixels, default 256
+	Level  string `json:"level,omitempty"`  // Error correction "L", "M" (default), "Q" or "H"
+}
+
+// Validate checks the options, zero values mean the defaults
+func (o QROptions) Validate() error {
+	v := &ValidationError{Subject: "QR code options"}
+	v.OneOf("format", o.Format, "", QRFormatPNG, QRFormatSVG)
+	if o.Size != 0 {
+		v.Range("size", int64(o.Size), minQRSize, maxQRSize)
+	}
+	v.OneOf("level", o.Level, "", "L", "M", "Q", "H")
+	return v.Err()
+}
+
+// RenderQRCode encodes content, usually a share link URL, as a QR code image and
+// returns the image with its content type
+func RenderQRCode(content string, o QROptions) ([]byte, string, error) {
+	if err := o.Validate(); err != nil {
+		return nil, "", err
+	}
+	if content == "" {
+		return nil, "", fmt.Errorf("nothing to encode in the QR code")
+	}
+	size := o.Size
+	if size == 0 {
+		size = defaultQRSize
+	}
+	level, ok := qrLevels[strings.ToUpper(o.Level)]
+	if !ok {
+		level = qrcode.Medium
+	}
+
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create QR code: %w", err)
+	}
+	if strings.EqualFold(o.Format, QRFormatSVG) {
+		return qrSVG(code.Bitmap(), size), "image/svg+xml", nil
+	}
+	data, err := code.PNG(size)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to render QR code: %w", err)
+	}
+	return data, "image/png", nil
+}
+
+// QRCodeDataURL renders a QR code as a data: URL for an <img> element
+func QRCodeDataURL(content string, o QROptions) (string, error) {
+	data, contentType, err := RenderQRCode(content, o)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// qrSVG draws the modules of a QR code, quiet zone included, as one path scaled to size.
+// Runs of dark modules in a row become one rectangle to keep the file small.
+func qrSVG(bitmap [][]bool, size int) []byte {
+	var b strings.Builder
+	n := len(bitmap)
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return []byte(b.String())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const recordsFileName = "shares.json"
+
+// recordsMu serialises access to the local share records file
+var recordsMu sync.Mutex
+
+// ShareRecord is the locally recorded state of a completed share
+type ShareRecord struct {
+	DocNo     int64  `json:"docNo"`
+	LinkID    string `json:"linkId"`
+	URL       string `json:"url"`
+	Filename  string `json:"filename"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	CreatedAt string `json:"createdAt"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+
+	Email *EmailDelivery `json:"email,omitempty"`
+
+	// DLP holds the data-loss-prevention rules the shared files matched
+	DLP []DLPMatch `json:"dlp,omitempty"`
+
+	// PasswordGenerated is set when the link password was generated. The password itself
+	// is never recorded.
+	PasswordGenerated bool `json:"passwordGenerated,omitempty"`
+}
+
+// GetRecordsPath returns the full path to the share records file
+func GetRecordsPath() string {
+	return filepath.Join(GetConfigDir(), recordsFileName)
+}
+
+// HashFileData returns the hex encoded SHA-256 of the given data
+func HashFileData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadShareRecords loads all share records from disk
+func LoadShareRecords() ([]ShareRecord, error) {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+	return loadShareRecords()
+}
+
+// loadShareRecords reads the records file, the caller must hold recordsMu
+func loadShareRecords() ([]ShareRecord, error) {
+	data, err := os.ReadFile(GetRecordsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ShareRecord{}, nil
+		}
+		return nil, fmt.Errorf("failed to read share records: %w", err)
+	}
+
+	var records []ShareRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse share records: %w", err)
+	}
+
+	return records, nil
+}
+
+// SaveShareRecord adds a record, replacing any existing record for the same document
+func SaveShareRecord(record ShareRecord) error {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+
+	records, err := loadShareRecords()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range records {
+		if records[i].DocNo == record.DocNo {
+			records[i] = record
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		records = append(records, record)
+	}
+
+	if err := os.MkdirAll(GetConfigDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal share records: %w", err)
+	}
+
+	if err := writeFileAtomic(GetRecordsPath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to write share records: %w", err)
+	}
+
+	return nil
+}
+
+// FindShareRecord returns the record for a document, or nil if none was recorded
+func FindShareRecord(docNo int64) (*ShareRecord, error) {
+	records, err := LoadShareRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		if records[i].DocNo == docNo {
+			return &records[i], nil
+		}
+	}
+
+	return nil, nil
+}
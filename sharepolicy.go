@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expiry choices of a share request besides a number of days
+const (
+	ExpiryNever  = 0
+	ExpiryCustom = -1
+)
+
+// SharePolicy sets requirements for the links shared to some categories or by some
+// portal roles. Every policy that applies to a share is enforced, the strictest wins.
+type SharePolicy struct {
+	Name               string   `json:"name"`
+	Categories         []int    `json:"categories,omitempty"`           // Categories it applies to, empty = all
+	Roles              []string `json:"roles,omitempty"`                // Web portal roles ("admin", "user", "api:<key name>"), empty = all. The desktop app only applies policies without roles.
+	RequirePassword    bool     `json:"require_password,omitempty"`     // Links must have a password
+	MinPasswordLength  int      `json:"min_password_length,omitempty"`  // Also applies when the password is optional
+	MinPasswordClasses int      `json:"min_password_classes,omitempty"` // Lowercase, uppercase, digits and symbols, 0-4
+	MaxExpiryDays      int      `json:"max_expiry_days,omitempty"`      // 0 = no limit, never-expiring links are refused otherwise
+	RequireExpiry      bool     `json:"require_expiry,omitempty"`       // Refuse links that never expire
+	DefaultExpiryDays  int      `json:"default_expiry_days,omitempty"`  // Preselected, and used when a request doesn't give an expiry
+}
+
+// applies reports whether the policy covers a share to categoryNo by role. Role is
+// empty in the desktop app.
+func (p SharePolicy) applies(categoryNo int, role string) bool {
+	if len(p.Categories) > 0 {
+		found := false
+		for _, no := range p.Categories {
+			if no == categoryNo {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(p.Roles) > 0 {
+		if role == "" || !containsFold(p.Roles, role) {
+			return false
+		}
+	}
+	return true
+}
+
+// EffectiveSharePolicy combines the policies that apply to a share into one, keeping
+// the strictest value of each requirement. Name lists the policies that applied.
+func EffectiveSharePolicy(policies []SharePolicy, categoryNo int, role string) SharePolicy {
+	var effective SharePolicy
+	var names []string
+	for _, p := range policies {
+		if !p.applies(categoryNo, role) {
+			continue
+		}
+		names = append(names, p.Name)
+		effective.RequirePassword = effective.RequirePassword || p.RequirePassword
+		effective.RequireExpiry = effective.RequireExpiry || p.RequireExpiry || p.MaxExpiryDays > 0
+		effective.MinPasswordLength = max(effective.MinPasswordLength, p.MinPasswordLength)
+		effective.MinPasswordClasses = max(effective.MinPasswordClasses, p.MinPasswordClasses)
+		if p.MaxExpiryDays > 0 && (effective.MaxExpiryDays == 0 || p.MaxExpiryDays < effective.MaxExpiryDays) {
+			effective.MaxExpiryDays = p.MaxExpiryDays
+		}
+		if effective.DefaultExpiryDays == 0 {
+			effective.DefaultExpiryDays = p.DefaultExpiryDays
+		}
+	}
+	if effective.MaxExpiryDays > 0 && effective.DefaultExpiryDays > effective.MaxExpiryDays {
+		effective.DefaultExpiryDays = effective.MaxExpiryDays
+	}
+	effective.Name = strings.Join(names, ", ")
+	return effective
+}
+
+// Check validates a share's password and expiry against the policy. Violations are
+// reported as a *ValidationError on the "password" and "expiry" fields.
+func (p SharePolicy) Check(password string, expiry *time.Time) error {
+	v := &ValidationError{Subject: "share"}
+	suffix := ""
+	if p.Name != "" {
+		suffix = fmt.Sprintf(" (share policy %s)", p.Name)
+	}
+
+	if password == "" {
+		if p.RequirePassword {
+			v.Add("password", "is required%s", suffix)
+		}
+	} else {
+		if n := len([]rune(password)); n < p.MinPasswordLength {
+			v.Add("password", "must be at least %d characters%s", p.MinPasswordLength, suffix)
+		}
+		if n := passwordClasses(password); n < p.MinPasswordClasses {
+			v.Add("password", "must mix at least %d of lowercase letters, uppercase letters, digits and symbols%s", p.MinPasswordClasses, suffix)
+		}
+	}
+
+	if expiry == nil {
+		if p.RequireExpiry {
+			v.Add("expiry", "links must expire%s", suffix)
+		}
+	} else if p.MaxExpiryDays > 0 {
+		// Up to the end of the last allowed day, so a date picked in a calendar fits
+		y, m, d := time.Now().AddDate(0, 0, p.MaxExpiryDays).In(expiry.Location()).Date()
+		if !expiry.Before(time.Date(y, m, d+1, 0, 0, 0, 0, expiry.Location())) {
+			v.Add("expiry", "must be at most %d days away%s", p.MaxExpiryDays, suffix)
+		}
+	}
+	return v.Err()
+}
+
+// passwordClasses counts the kinds of characters in a password
+func passwordClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, b := range []bool{lower, upper, digit, other} {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// ParseShareExpiry turns a share request's expiry choice into the expiry time, nil for
+// links that never expire. Days is a number of days, ExpiryNever, or ExpiryCustom with
+// custom holding an RFC 3339 time or a YYYY-MM-DD date, which ends at the end of that
+// day in loc. Anything else, and times in the past, are errors.
+func ParseShareExpiry(days int, custom string, loc *time.Location) (*time.Time, error) {
+	switch {
+	case days > 0:
+		t := time.Now().AddDate(0, 0, days)
+		return &t, nil
+	case days == ExpiryNever:
+		return nil, nil
+	case days != ExpiryCustom:
+		return nil, &ValidationError{Subject: "share", Fields: []FieldError{{Field: "expiryDays", Message: fmt.Sprintf("must be a number of days, %d for never or %d for a custom date", ExpiryNever, ExpiryCustom)}}}
+	}
+
+	custom = strings.TrimSpace(custom)
+	if custom == "" {
+		return nil, &ValidationError{Subject: "share", Fields: []FieldError{{Field: "customExpiry", Message: "is required for a custom expiry"}}}
+	}
+	t, err := time.Parse(time.RFC3339, custom)
+	if err != nil {
+		day, dayErr := time.ParseInLocation(time.DateOnly, custom, loc)
+		if dayErr != nil {
+			return nil, &ValidationError{Subject: "share", Fields: []FieldError{{Field: "customExpiry", Message: fmt.Sprintf("%q is not a date (YYYY-MM-DD) or an RFC 3339 time", custom)}}}
+		}
+		t = day.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	if !t.After(time.Now()) {
+		return nil, &ValidationError{Subject: "share", Fields: []FieldError{{Field: "customExpiry", Message: "must be in the future"}}}
+	}
+	return &t, nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	goruntime "runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/systray"
+	"github.com/godbus/dbus/v5"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+//go:embed build/appicon.png
+var trayIconPNG []byte
+
+//go:embed build/windows/icon.ico
+var trayIconICO []byte
+
+const (
+	trayRecentShares    = 10
+	trayRefreshInterval = 5 * time.Minute
+	trayQuickShareDays  = 7 // Expiry of quick shares when a policy requires one but has no default
+)
+
+// trayIcon is the system tray (menu bar on macOS) icon of tray mode. It keeps the app
+// reachable while the window is hidden, lists the recent shares and shares files
+// without opening the window.
+type trayIcon struct {
+	app *App
+	end func()
+
+	mu     sync.Mutex
+	recent []ShareHistoryEntry
+	items  []*systray.MenuItem
+}
+
+// startTray shows the tray icon, once. Turning tray mode off takes effect at the next start.
+func (a *App) startTray() {
+	a.trayOnce.Do(func() {
+		t := &trayIcon{app: a}
+		start, end := systray.RunWithExternalLoop(t.ready, nil)
+		t.end = end
+		a.tray.Store(t)
+		start()
+	})
+}
+
+// beforeClose hides the window instead of quitting while the tray icon is shown
+func (a *App) beforeClose(ctx context.Context) (prevent bool) {
+	if a.tray.Load() == nil || a.quitting.Load() {
+		return false
+	}
+	runtime.WindowHide(ctx)
+	return true
+}
+
+// ready builds the menu once the tray is running
+func (t *trayIcon) ready() {
+	if goruntime.GOOS == "windows" {
+		systray.SetIcon(trayIconICO)
+	} else {
+		systray.SetIcon(trayIconPNG)
+	}
+	systray.SetTooltip(appName)
+
+	open := systray.AddMenuItem("Open "+appName, "Show the window")
+	systray.AddSeparator()
+	recent := systray.AddMenuItem("Recent Shares", "Copy the link of a recent share")
+	for i := 0; i < trayRecentShares; i++ {
+		item := recent.AddSubMenuItem("", "")
+		item.Hide()
+		t.items = append(t.items, item)
+		go t.onCopy(i, item)
+	}
+	shareClipboard := systray.AddMenuItem("Share Clipboard File", "Share the file whose path is on the clipboard")
+	shareFile := systray.AddMenuItem("Share File…", "Choose files to share")
+	systray.AddSeparator()
+	quit := systray.AddMenuItem("Quit", "Quit "+appName)
+
+	go func() {
+		for {
+			select {
+			case <-open.ClickedCh:
+				runtime.WindowShow(t.app.ctx)
+			case <-shareClipboard.ClickedCh:
+				go t.shareClipboard()
+			case <-shareFile.ClickedCh:
+				go t.shareFile()
+			case <-quit.ClickedCh:
+				t.app.quitting.Store(true)
+				runtime.Quit(t.app.ctx)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			t.refresh()
+			time.Sleep(trayRefreshInterval)
+		}
+	}()
+}
+
+// refresh loads the recent shares into the menu
+func (t *trayIcon) refresh() {
+	entries, err := t.app.GetShareHistory()
+	if err != nil {
+		slog.Debug("Failed to load recent shares for the tray", "error", err)
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt > entries[j].CreatedAt })
+	if len(entries) > trayRecentShares {
+		entries = entries[:trayRecentShares]
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recent = entries
+	for i, item := range t.items {
+		if i < len(entries) {
+			item.SetTitle(entries[i].Filename)
+			item.SetTooltip("Copy " + entries[i].URL)
+			item.Show()
+		} else {
+			item.Hide()
+		}
+	}
+}
+
+// onCopy copies the link of the i-th recent share whenever its menu item is clicked
+func (t *trayIcon) onCopy(i int, item *systray.MenuItem) {
+	for range item.ClickedCh {
+		t.mu.Lock()
+		var entry ShareHistoryEntry
+		if i < len(t.recent) {
+			entry = t.recent[i]
+		}
+		t.mu.Unlock()
+		if entry.URL == "" {
+			continue
+		}
+		if err := t.app.CopyToClipboard(entry.URL); err != nil {
+			notify("Copy Failed", err.Error())
+			continue
+		}
+		notify("Link Copied", fmt.Sprintf("%s\n%s", entry.Filename, entry.URL))
+	}
+}
+
+// shareClipboard shares the files named on the clipboard, as paths or file:// URLs, one per line
+func (t *trayIcon) shareClipboard() {
+	text, err := runtime.ClipboardGetText(t.app.ctx)
+	if err != nil {
+		notify("Share Failed", "Could not read the clipboard: "+err.Error())
+		return
+	}
+	var files []string
+	for _, line := range strings.Split(text, "\n") {
+		path := strings.TrimSpace(line)
+		if path == "" || strings.HasPrefix(path, "#") {
+			continue
+		}
+		if u, err := url.Parse(path); err == nil && u.Scheme == "file" {
+			path = u.Path
+			if goruntime.GOOS == "windows" {
+				path = filepath.FromSlash(strings.TrimPrefix(path, "/"))
+			}
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			notify("Share Failed", "The clipboard doesn't hold the path of a file to share")
+			return
+		}
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		notify("Share Failed", "The clipboard doesn't hold the path of a file to share")
+		return
+	}
+	t.share(files)
+}
+
+// shareFile shares files chosen in a native file dialog
+func (t *trayIcon) shareFile() {
+	files, err := t.app.OpenFileDialog()
+	if err != nil {
+		notify("Share Failed", err.Error())
+		return
+	}
+	if len(files) > 0 {
+		t.share(files)
+	}
+}
+
+// share shares files with the defaults of the share policy of the category they are
+// routed to and copies the link. A generated password is shown in the window, it is
+// never put in a notification.
+func (t *trayIcon) share(files []string) {
+	config, err := LoadConfig()
+	if err != nil {
+		notify("Share Failed", err.Error())
+		return
+	}
+	route, err := ResolveCategory(config, RouteInput{FilePaths: files})
+	if err != nil {
+		notify("Share Failed", err.Error())
+		return
+	}
+	policy := config.SharePolicy(route.CategoryNo)
+	req := ShareRequest{Files: files, ExpiryDays: policy.DefaultExpiryDays}
+	if req.ExpiryDays == 0 && policy.RequireExpiry {
+		req.ExpiryDays = trayQuickShareDays
+		if policy.MaxExpiryDays > 0 {
+			req.ExpiryDays = min(policy.MaxExpiryDays, trayQuickShareDays)
+		}
+	}
+	if policy.RequirePassword {
+		req.GeneratePassword = &PasswordOptions{}
+	}
+
+	resp, err := t.app.ShareFiles(req)
+	if err != nil {
+		notify("Share Failed", err.Error())
+		runtime.EventsEmit(t.app.ctx, "tray:share-failed", err.Error())
+		return
+	}
+	copied := t.app.CopyToClipboard(resp.URL) == nil
+	runtime.EventsEmit(t.app.ctx, "tray:shared", resp)
+	go t.refresh()
+
+	message := resp.URL
+	if copied {
+		message = "Link copied to the clipboard\n" + resp.URL
+	}
+	if resp.GeneratedPassword != "" {
+		message += "\nOpen " + appName + " to see the password"
+		runtime.WindowShow(t.app.ctx)
+	}
+	notify("Files Shared", message)
+}
+
+// notify shows a native notification, logging when the desktop can't show one
+func notify(title, message string) {
+	var err error
+	switch goruntime.GOOS {
+	case "linux":
+		err = notifyDBus(title, message)
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		err = exec.Command("osascript", "-e", script).Run()
+	case "windows":
+		cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToastScript)
+		cmd.Env = append(os.Environ(), "TOAST_TITLE="+title, "TOAST_MESSAGE="+message)
+		err = cmd.Run()
+	default:
+		err = fmt.Errorf("notifications are not supported on %s", goruntime.GOOS)
+	}
+	if err != nil {
+		slog.Warn("Failed to show notification", "title", title, "error", err)
+	}
+}
+
+// notifyDBus sends a notification to the freedesktop notification server
+func notifyDBus(title, message string) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	obj := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
+	return obj.Call("org.freedesktop.Notifications.Notify", 0,
+		appName, uint32(0), "", title, message, []string{}, map[string]dbus.Variant{}, int32(-1)).Err
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// windowsToastScript shows a toast with the title and message of the environment, which
+// keeps them from being read as PowerShell
+const windowsToastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:TOAST_TITLE)) > $null
+$text.Item(1).AppendChild($template.CreateTextNode($env:TOAST_MESSAGE)) > $null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('` + appName + `').Show($toast)
+`
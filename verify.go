@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+)
+
+// DocumentVerification reports whether a stored document still matches what was shared
+type DocumentVerification struct {
+	DocNo          int64  `json:"docNo"`
+	Filename       string `json:"filename"`
+	Size           int64  `json:"size"`
+	SHA256         string `json:"sha256"`
+	RecordedSHA256 string `json:"recordedSha256,omitempty"`
+	HasRecord      bool   `json:"hasRecord"`
+	Verified       bool   `json:"verified"`
+	SavedPath      string `json:"savedPath,omitempty"`
+}
+
+// FetchAndVerifyDocument downloads a document's content from Therefore and
+// compares its SHA-256 with the hash recorded when it was shared
+func FetchAndVerifyDocument(client *ThereforeAPIClient, docNo int64) (*DocumentVerification, []byte, error) {
+	streams, err := client.GetDocumentStreams(docNo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch document: %w", err)
+	}
+
+	record, err := FindShareRecord(docNo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Shares are uploaded as a single stream, prefer the one matching the recorded filename
+	stream := &streams[0]
+	if record != nil {
+		for i := range streams {
+			if streams[i].FileName == record.Filename {
+				stream = &streams[i]
+				break
+			}
+		}
+	}
+
+	data, err := stream.Data()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &DocumentVerification{
+		DocNo:    docNo,
+		Filename: stream.FileName,
+		Size:     int64(len(data)),
+		SHA256:   HashFileData(data),
+	}
+
+	if record != nil && record.SHA256 != "" {
+		result.HasRecord = true
+		result.RecordedSHA256 = record.SHA256
+		result.Verified = record.SHA256 == result.SHA256
+	}
+
+	return result, data, nil
+}
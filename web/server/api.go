@@ -7,8 +7,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ThereforeAPIClient handles all API communication with
@@ -17,6 +20,8 @@ type ThereforeAPIClient struct {
 	TenantName string
 	AuthToken  string
 	HTTPClient *http.Client
+
+	ctx context.Context // Carries the request ID of the caller, see WithContext
 }
 
 // NewThereforeAPIClient creates a new API client
@@ -25,20 +30,49 @@ func NewThereforeAPIClient(baseURL, tenantName, authToken string) *ThereforeAPIC
 		BaseURL:    baseURL,
 		TenantName: tenantName,
 		AuthToken:  authToken,
-		HTTPClient: &http.Client{Timeout: 5 * time.Minute}, // Increased for large file uploads
+		HTTPClient: &http.Client{Timeout: 5 * time.Minute, Transport: tracedTransport(nil)}, // Increased for large file uploads
+	}
+}
+
+// WithContext returns a copy of the client whose calls are logged with the request
+// ID of ctx and pass it on to Therefore in the X-Request-ID header
+func (c *ThereforeAPIClient) WithContext(ctx context.Context) *ThereforeAPIClient {
+	client := *c
+	client.ctx = ctx
+	return &client
+}
+
+func (c *ThereforeAPIClient) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// logAPICall logs a finished API call, failures at warn level
+func logAPICall(ctx context.Context, method, endpoint string, status int, start time.Time, err error) {
+	attrs := []any{"method", method, "endpoint", endpoint, "status", status, "duration", time.Since(start)}
+	switch {
+	case err != nil:
+		slog.WarnContext(ctx, "Therefore API request failed", append(attrs, "error", err)...)
+	case status < 200 || status >= 300:
+		slog.WarnContext(ctx, "Therefore API request failed", attrs...)
+	default:
+		slog.DebugContext(ctx, "Therefore API request", attrs...)
 	}
 }
 
 // makeRequest performs an HTTP request with authentication
 func (c *ThereforeAPIClient) makeRequest(method, endpoint string, body []byte) ([]byte, error) {
 	url := c.BaseURL + "/theservice/v0001/restun/" + endpoint
+	ctx := c.context()
 
 	var bodyReader io.Reader
 	if body != nil {
 		bodyReader = bytes.NewReader(body)
 	}
 
-	req, err := http.NewRequest(method, url, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -48,12 +82,18 @@ func (c *ThereforeAPIClient) makeRequest(method, endpoint string, body []byte) (
 	req.Header.Set("TenantName", c.TenantName)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
+	if id := RequestIDFrom(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
 
+	start := time.Now()
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
+		logAPICall(ctx, method, endpoint, 0, start, err)
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	logAPICall(ctx, method, endpoint, resp.StatusCode, start, nil)
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -105,12 +145,17 @@ func (c *ThereforeAPIClient) makeRequestWithProgress(ctx context.Context, method
 	req.Header.Set("TenantName", c.TenantName)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
+	if id := RequestIDFrom(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
 
 	// Important: Set Content-Length explicitly when using custom reader
 	req.ContentLength = int64(len(body))
 
+	start := time.Now()
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
+		logAPICall(ctx, method, endpoint, 0, start, err)
 		// Check if error was due to context cancellation
 		if ctx.Err() == context.Canceled {
 			return nil, fmt.Errorf("upload cancelled")
@@ -118,6 +163,7 @@ func (c *ThereforeAPIClient) makeRequestWithProgress(ctx context.Context, method
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	logAPICall(ctx, method, endpoint, resp.StatusCode, start, nil)
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -244,6 +290,12 @@ func (c *ThereforeAPIClient) CreateDocument(categoryNo int, fileName string, fil
 
 // CreateDocumentWithProgress creates a new document in Therefore with progress tracking
 func (c *ThereforeAPIClient) CreateDocumentWithProgress(ctx context.Context, categoryNo int, fileName string, fileData []byte, indexData []IndexDataItem) (*CreateDocumentResponse, error) {
+	spanCtx := ctx
+	if spanCtx == nil {
+		spanCtx = c.context()
+	}
+	_, span := StartSpan(spanCtx, "encode document", attribute.Int("file.size", len(fileData)))
+
 	req := CreateDocumentRequest{
 		CategoryNo: categoryNo,
 		Streams: []StreamInfo{
@@ -256,6 +308,7 @@ func (c *ThereforeAPIClient) CreateDocumentWithProgress(ctx context.Context, cat
 	}
 
 	reqBody, err := json.Marshal(req)
+	EndSpan(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -374,6 +427,49 @@ func (c *ThereforeAPIClient) DeleteDocument(docNo int64) error {
 	return nil
 }
 
+// DocumentStream represents a file stream stored in a document
+type DocumentStream struct {
+	StreamNo           int    `json:"StreamNo"`
+	FileName           string `json:"FileName"`
+	FileData           []byte `json:"FileData"`
+	FileDataBase64JSON string `json:"FileDataBase64JSON,omitempty"`
+}
+
+// Data returns the decoded content of the stream
+func (s *DocumentStream) Data() ([]byte, error) {
+	if len(s.FileData) > 0 || s.FileDataBase64JSON == "" {
+		return s.FileData, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(s.FileDataBase64JSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode stream %s: %w", s.FileName, err)
+	}
+	return data, nil
+}
+
+// GetDocumentStreams retrieves the file streams stored in a document
+func (c *ThereforeAPIClient) GetDocumentStreams(docNo int64) ([]DocumentStream, error) {
+	reqBody := fmt.Sprintf(`{"DocNo":%d,"IsStreamsInfoAndDataNeeded":true,"IsIndexDataValuesNeeded":false}`, docNo)
+
+	data, err := c.makeRequest("POST", "GetDocument", []byte(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		StreamsInfo []DocumentStream `json:"StreamsInfo"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse get document response: %w", err)
+	}
+
+	if len(result.StreamsInfo) == 0 {
+		return nil, fmt.Errorf("document %d has no file streams", docNo)
+	}
+
+	return result.StreamsInfo, nil
+}
+
 // CreateSharedLink creates a shared link for a document
 func (c *ThereforeAPIClient) CreateSharedLink(docNo int64, password string, expireTime *time.Time, filename string) (*CreateSharedLinkResponse, error) {
 	req := CreateSharedLinkRequest{
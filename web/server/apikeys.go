@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API key scopes
+const (
+	ScopeShare   = "share"
+	ScopeHistory = "history"
+	ScopeRevoke  = "revoke"
+	ScopeAdmin   = "admin"
+)
+
+const (
+	apiKeysFileName     = "api_keys.json"
+	apiKeyUsageFile     = "api_key_usage.json"
+	apiKeyPrefix        = "tsk_"
+	apiKeyMaxUsageLogs  = 1000
+	apiKeyFlushInterval = 30 * time.Second // How often recorded usage is written to disk
+)
+
+var validScopes = map[string]bool{
+	ScopeShare:   true,
+	ScopeHistory: true,
+	ScopeRevoke:  true,
+	ScopeAdmin:   true,
+}
+
+// APIKey is an admin managed credential for machine-to-machine access.
+// Only the SHA-256 of the key is stored.
+type APIKey struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Hint       string   `json:"hint"` // Last characters of the key, for identification
+	Hash       string   `json:"hash,omitempty"`
+	Scopes     []string `json:"scopes"`
+	CategoryNo int      `json:"categoryNo,omitempty"` // Restricts shares to this category, 0 = unrestricted
+	ExpiresAt  string   `json:"expiresAt,omitempty"`
+	CreatedAt  string   `json:"createdAt"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+}
+
+// HasScope reports whether the key grants a scope, admin grants every scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the key is past its expiry
+func (k *APIKey) Expired() bool {
+	if k.ExpiresAt == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, k.ExpiresAt)
+	return err == nil && time.Now().After(t)
+}
+
+// APIKeyUsage records a single request made with an API key
+type APIKeyUsage struct {
+	KeyID  string `json:"keyId"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	IP     string `json:"ip"`
+	Time   string `json:"time"`
+}
+
+// APIKeyStore holds the API keys and their usage log. Usage is kept in memory and
+// written to disk by Flush, so requests made with a key don't each rewrite the files.
+type APIKeyStore struct {
+	mu    sync.Mutex
+	keys  []APIKey
+	usage []APIKeyUsage
+	dirty bool // Usage recorded since the last flush
+}
+
+// NewAPIKeyStore loads API keys and usage from disk
+func NewAPIKeyStore() *APIKeyStore {
+	s := &APIKeyStore{}
+	if err := readJSONFile(apiKeyDataPath(apiKeysFileName), &s.keys); err != nil {
+		slog.Error("Failed to load API keys", "error", err)
+	}
+	if err := readJSONFile(apiKeyDataPath(apiKeyUsageFile), &s.usage); err != nil {
+		slog.Error("Failed to load API key usage", "error", err)
+	}
+	return s
+}
+
+// apiKeyDataPath returns the path of an API key state file, stored next to the config
+func apiKeyDataPath(name string) string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), name)
+}
+
+// hashAPIKey returns the hex encoded SHA-256 of a key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create generates a new key and returns its record and the plaintext key, which is not stored
+func (s *APIKeyStore) Create(name string, scopes []string, categoryNo int, expiresAt string) (*APIKey, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", fmt.Errorf("a name is required")
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return nil, "", fmt.Errorf("unknown scope %q - must be share, history, revoke or admin", scope)
+		}
+	}
+	if expiresAt != "" {
+		if _, err := time.Parse(time.RFC3339, expiresAt); err != nil {
+			return nil, "", fmt.Errorf("invalid expiry date, expected RFC 3339: %w", err)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	plain := apiKeyPrefix + hex.EncodeToString(secret)
+
+	key := APIKey{
+		ID:         newRandomID(),
+		Name:       strings.TrimSpace(name),
+		Hint:       plain[len(plain)-4:],
+		Hash:       hashAPIKey(plain),
+		Scopes:     scopes,
+		CategoryNo: categoryNo,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	if err := s.saveKeysLocked(); err != nil {
+		s.keys = s.keys[:len(s.keys)-1]
+		return nil, "", err
+	}
+
+	created := key
+	created.Hash = ""
+	return &created, plain, nil
+}
+
+// Authenticate returns the key matching a plaintext key, rejecting unknown and expired keys
+func (s *APIKeyStore) Authenticate(plain string) (*APIKey, error) {
+	hash := hashAPIKey(plain)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(s.keys[i].Hash), []byte(hash)) != 1 {
+			continue
+		}
+		if s.keys[i].Expired() {
+			return nil, fmt.Errorf("API key has expired")
+		}
+		key := s.keys[i]
+		return &key, nil
+	}
+	return nil, fmt.Errorf("invalid API key")
+}
+
+// List returns all keys, without their hashes
+func (s *APIKeyStore) List() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]APIKey, len(s.keys))
+	copy(keys, s.keys)
+	for i := range keys {
+		keys[i].Hash = ""
+	}
+	return keys
+}
+
+// Delete removes a key
+func (s *APIKeyStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.keys {
+		if s.keys[i].ID == id {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			return s.saveKeysLocked()
+		}
+	}
+	return fmt.Errorf("API key not found")
+}
+
+// RecordUsage logs a request made with a key and updates its last used time.
+// The change is saved by the next Flush.
+func (s *APIKeyStore) RecordUsage(usage APIKeyUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.usage = append(s.usage, usage)
+	if len(s.usage) > apiKeyMaxUsageLogs {
+		s.usage = s.usage[len(s.usage)-apiKeyMaxUsageLogs:]
+	}
+	for i := range s.keys {
+		if s.keys[i].ID == usage.KeyID {
+			s.keys[i].LastUsedAt = usage.Time
+			break
+		}
+	}
+	s.dirty = true
+}
+
+// StartFlusher saves recorded usage in the background every apiKeyFlushInterval
+func (s *APIKeyStore) StartFlusher() {
+	go func() {
+		ticker := time.NewTicker(apiKeyFlushInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.Flush()
+		}
+	}()
+}
+
+// Flush writes the usage log and last used times recorded since the last flush
+func (s *APIKeyStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return
+	}
+
+	if err := writeJSONFile(apiKeyDataPath(apiKeyUsageFile), s.usage); err != nil {
+		slog.Error("Failed to save API key usage", "error", err)
+		return
+	}
+	if err := s.saveKeysLocked(); err != nil {
+		slog.Error("Failed to save API keys", "error", err)
+		return
+	}
+	s.dirty = false
+}
+
+// Usage returns the logged requests for a key, newest first
+func (s *APIKeyStore) Usage(id string) []APIKeyUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]APIKeyUsage, 0)
+	for i := len(s.usage) - 1; i >= 0; i-- {
+		if s.usage[i].KeyID == id {
+			result = append(result, s.usage[i])
+		}
+	}
+	return result
+}
+
+// saveKeysLocked persists the keys, the caller must hold s.mu
+func (s *APIKeyStore) saveKeysLocked() error {
+	if err := writeJSONFile(apiKeyDataPath(apiKeysFileName), s.keys); err != nil {
+		return fmt.Errorf("failed to save API keys: %w", err)
+	}
+	return nil
+}
+
+// bearerAPIKey extracts an API key from an "Authorization: Bearer" header
+func bearerAPIKey(header string) (string, bool) {
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Approval request states
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+const (
+	approvalsFileName          = "approvals.json"
+	defaultApprovalExpiryHours = 72
+	approvalCheckInterval      = time.Minute
+)
+
+// UploadedShare is a document uploaded to Therefore that is waiting for its shared link
+type UploadedShare struct {
+	DocNo             int64        `json:"docNo"`
+	CategoryNo        int          `json:"categoryNo"`
+	Filename          string       `json:"filename"`
+	Files             []string     `json:"files,omitempty"`
+	SHA256            string       `json:"sha256"`
+	Size              int64        `json:"size"`
+	Password          string       `json:"password,omitempty"`
+	ExpiresAt         string       `json:"expiresAt,omitempty"` // Link expiry
+	Recipients        []string     `json:"recipients,omitempty"`
+	Message           string       `json:"message,omitempty"`
+	SendPassword      bool         `json:"sendPassword,omitempty"`
+	PasswordGenerated bool         `json:"passwordGenerated,omitempty"`
+	SharedBy          string       `json:"sharedBy"`
+	Scan              []ScanResult `json:"scan,omitempty"`
+	DLP               []DLPMatch   `json:"dlp,omitempty"`
+}
+
+// Publish creates the shared link, emails it to any recipients and records the share
+func (s UploadedShare) Publish(client *ThereforeAPIClient, mailer *Mailer) (*ShareRecord, error) {
+	var expiryTime *time.Time
+	if s.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, s.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid link expiry: %w", err)
+		}
+		if t.Before(time.Now()) {
+			return nil, fmt.Errorf("the requested link expiry has already passed")
+		}
+		expiryTime = &t
+	}
+
+	linkResp, err := client.CreateSharedLink(s.DocNo, s.Password, expiryTime, s.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	record := ShareRecord{
+		DocNo:     s.DocNo,
+		LinkID:    linkResp.LinkID,
+		URL:       linkResp.URL,
+		Filename:  s.Filename,
+		SHA256:    s.SHA256,
+		Size:      s.Size,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		ExpiresAt: s.ExpiresAt,
+		Files:     s.Files,
+		SharedBy:  s.SharedBy,
+		Scan:      s.Scan,
+		DLP:       s.DLP,
+
+		PasswordGenerated: s.PasswordGenerated,
+	}
+
+	if mailer != nil && len(s.Recipients) > 0 {
+		record.Email = deliverShareEmail(mailer, ShareEmail{
+			Recipients:   s.Recipients,
+			Message:      s.Message,
+			URL:          linkResp.URL,
+			Filename:     s.Filename,
+			ExpiresAt:    s.ExpiresAt,
+			Password:     s.Password,
+			SendPassword: s.SendPassword,
+		})
+	}
+
+	if err := SaveShareRecord(record); err != nil {
+		slog.Error("Failed to record share", "doc_no", s.DocNo, "error", err)
+	}
+	return &record, nil
+}
+
+// ShareApproval is a share held until an admin approves it
+type ShareApproval struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Reason string `json:"reason"` // Why approval is required
+	UploadedShare
+	RequesterEmail string `json:"requesterEmail,omitempty"` // Told the outcome, if set
+	HasPassword    bool   `json:"hasPassword"`
+	RequestedAt    string `json:"requestedAt"`
+	StaleAt        string `json:"staleAt"` // Pending requests expire after this
+
+	DecidedBy string         `json:"decidedBy,omitempty"`
+	DecidedAt string         `json:"decidedAt,omitempty"`
+	Comment   string         `json:"comment,omitempty"`
+	URL       string         `json:"url,omitempty"`
+	LinkID    string         `json:"linkId,omitempty"`
+	Email     *EmailDelivery `json:"email,omitempty"`
+}
+
+// EventData returns the webhook event data describing this request
+func (a ShareApproval) EventData() WebhookEventData {
+	return WebhookEventData{
+		DocNo:      a.DocNo,
+		LinkID:     a.LinkID,
+		URL:        a.URL,
+		Filename:   a.Filename,
+		Files:      a.Files,
+		User:       a.SharedBy,
+		ExpiresAt:  a.ExpiresAt,
+		ApprovalID: a.ID,
+		Reason:     a.Reason,
+		Comment:    a.Comment,
+	}
+}
+
+// ApprovalStore holds share approval requests
+type ApprovalStore struct {
+	mu    sync.Mutex
+	items []ShareApproval
+
+	// Link passwords of pending requests by ID. They are never written to disk, so
+	// they don't survive a restart.
+	passwords map[string]string
+}
+
+// NewApprovalStore loads approval requests from disk
+func NewApprovalStore() *ApprovalStore {
+	s := &ApprovalStore{passwords: make(map[string]string)}
+	if err := readJSONFile(filepath.Join(filepath.Dir(GetConfigPath()), approvalsFileName), &s.items); err != nil {
+		slog.Error("Failed to load approval requests", "error", err)
+	}
+
+	// Files written by older versions hold the passwords, move them to memory
+	scrubbed := false
+	for i := range s.items {
+		if s.items[i].Password == "" {
+			continue
+		}
+		if s.items[i].Status == ApprovalPending {
+			s.passwords[s.items[i].ID] = s.items[i].Password
+		}
+		s.items[i].Password = ""
+		scrubbed = true
+	}
+	if scrubbed {
+		if err := s.saveLocked(); err != nil {
+			slog.Error("Failed to remove link passwords from approval requests", "error", err)
+		}
+	}
+	return s
+}
+
+// Add queues a new pending request
+func (s *ApprovalStore) Add(share UploadedShare, reason, requesterEmail string, expiryHours int) (ShareApproval, error) {
+	if expiryHours <= 0 {
+		expiryHours = defaultApprovalExpiryHours
+	}
+	now := time.Now()
+	approval := ShareApproval{
+		ID:             newRandomID(),
+		Status:         ApprovalPending,
+		Reason:         reason,
+		UploadedShare:  share,
+		RequesterEmail: requesterEmail,
+		HasPassword:    share.Password != "",
+		RequestedAt:    now.Format(time.RFC3339),
+		StaleAt:        now.Add(time.Duration(expiryHours) * time.Hour).Format(time.RFC3339),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, approval.public())
+	if err := s.saveLocked(); err != nil {
+		s.items = s.items[:len(s.items)-1]
+		return ShareApproval{}, err
+	}
+	if share.Password != "" {
+		s.passwords[approval.ID] = share.Password
+	}
+	return approval.public(), nil
+}
+
+// List returns requests newest first, optionally only those made by one user or with one status
+func (s *ApprovalStore) List(requestedBy, status string) []ShareApproval {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]ShareApproval, 0)
+	for i := len(s.items) - 1; i >= 0; i-- {
+		a := s.items[i]
+		if (requestedBy != "" && a.SharedBy != requestedBy) || (status != "" && a.Status != status) {
+			continue
+		}
+		result = append(result, a.public())
+	}
+	return result
+}
+
+// Get returns a request, without its link password
+func (s *ApprovalStore) Get(id string) (*ShareApproval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.items {
+		if s.items[i].ID == id {
+			a := s.items[i].public()
+			return &a, nil
+		}
+	}
+	return nil, fmt.Errorf("approval request not found")
+}
+
+// Claim moves a pending request to a new status and returns it with its link
+// password, so that only one admin can decide a request. A request whose password
+// was lost in a restart can't be approved, its link would be unprotected.
+func (s *ApprovalStore) Claim(id, status, decidedBy, comment string) (*ShareApproval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.items {
+		if s.items[i].ID != id {
+			continue
+		}
+		if s.items[i].Status != ApprovalPending {
+			return nil, fmt.Errorf("request has already been %s", s.items[i].Status)
+		}
+		password := s.passwords[id]
+		if status == ApprovalApproved && s.items[i].HasPassword && password == "" {
+			return nil, fmt.Errorf("the link password of this request was lost when the server restarted, reject it and ask for the file to be shared again")
+		}
+		previous := s.items[i]
+		claimed := previous
+		claimed.Status = status
+		claimed.DecidedBy = decidedBy
+		claimed.DecidedAt = time.Now().Format(time.RFC3339)
+		claimed.Comment = comment
+
+		s.items[i] = claimed
+		if err := s.saveLocked(); err != nil {
+			s.items[i] = previous
+			return nil, err
+		}
+		delete(s.passwords, id)
+		claimed.Password = password
+		return &claimed, nil
+	}
+	return nil, fmt.Errorf("approval request not found")
+}
+
+// Reopen returns a claimed request to pending, keeping its link password
+func (s *ApprovalStore) Reopen(approval ShareApproval) {
+	approval.Status = ApprovalPending
+	approval.DecidedBy, approval.DecidedAt, approval.Comment = "", "", ""
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.items {
+		if s.items[i].ID == approval.ID {
+			s.items[i] = approval.public()
+			break
+		}
+	}
+	if approval.Password != "" {
+		s.passwords[approval.ID] = approval.Password
+	}
+	if err := s.saveLocked(); err != nil {
+		slog.Error("Failed to save approval requests", "error", err)
+	}
+}
+
+// Update stores the outcome of a decided request
+func (s *ApprovalStore) Update(approval ShareApproval) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	approval.Password = ""
+	for i := range s.items {
+		if s.items[i].ID == approval.ID {
+			s.items[i] = approval
+			break
+		}
+	}
+	if err := s.saveLocked(); err != nil {
+		slog.Error("Failed to save approval requests", "error", err)
+	}
+}
+
+// Stale returns the IDs of pending requests that have passed their expiry
+func (s *ApprovalStore) Stale() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	now := time.Now()
+	for _, a := range s.items {
+		if a.Status != ApprovalPending {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, a.StaleAt); err == nil && now.After(t) {
+			ids = append(ids, a.ID)
+		}
+	}
+	return ids
+}
+
+// public returns a copy of the request safe to send to clients
+func (a ShareApproval) public() ShareApproval {
+	a.Password = ""
+	return a
+}
+
+// saveLocked persists the requests, the caller must hold s.mu
+func (s *ApprovalStore) saveLocked() error {
+	if err := writeJSONFile(filepath.Join(filepath.Dir(GetConfigPath()), approvalsFileName), s.items); err != nil {
+		return fmt.Errorf("failed to save approval requests: %w", err)
+	}
+	return nil
+}
+
+// ApprovalService decides approval requests and expires stale ones
+type ApprovalService struct {
+	store    *ApprovalStore
+	webhooks *WebhookDispatcher
+}
+
+// NewApprovalService creates the approval service
+func NewApprovalService(store *ApprovalStore, webhooks *WebhookDispatcher) *ApprovalService {
+	return &ApprovalService{store: store, webhooks: webhooks}
+}
+
+// Start expires stale requests in the background
+func (s *ApprovalService) Start() {
+	go func() {
+		ticker := time.NewTicker(approvalCheckInterval)
+		defer ticker.Stop()
+		for {
+			s.expireStale()
+			<-ticker.C
+		}
+	}()
+}
+
+// Request queues a share for approval and notifies admins
+func (s *ApprovalService) Request(share UploadedShare, reason, requesterEmail string) (ShareApproval, error) {
+	config, _ := LoadConfig()
+	approval, err := s.store.Add(share, reason, requesterEmail, config.ApprovalExpiryHours)
+	if err != nil {
+		return ShareApproval{}, err
+	}
+
+	s.webhooks.Emit(EventApprovalRequested, approval.EventData())
+	if len(config.ApprovalNotify) > 0 {
+		s.notify(config, config.ApprovalNotify,
+			fmt.Sprintf("Share approval requested: %s", approval.Filename),
+			fmt.Sprintf("%s has asked to share %s.\n\nReason approval is required: %s\n\nThe request expires at %s.", approval.SharedBy, approval.Filename, approval.Reason, formatEmailDate(approval.StaleAt)))
+	}
+	return approval, nil
+}
+
+// Approve creates the shared link for a pending request
+func (s *ApprovalService) Approve(id, decidedBy, comment string) (*ShareApproval, error) {
+	approval, err := s.store.Claim(id, ApprovalApproved, decidedBy, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _ := LoadConfig()
+	token, _ := GetAuthToken()
+	client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token)
+
+	var mailer *Mailer
+	if len(approval.Recipients) > 0 {
+		if mailer, err = NewMailer(config, config.SMTPPassword); err != nil {
+			approval.Email = &EmailDelivery{Recipients: approval.Recipients, Status: "failed", Error: err.Error(), SentAt: time.Now().Format(time.RFC3339)}
+		}
+	}
+
+	record, err := approval.Publish(client, mailer)
+	if err != nil {
+		// Put the request back so it can be retried or rejected
+		s.store.Reopen(*approval)
+		return nil, fmt.Errorf("failed to create shared link: %w", err)
+	}
+
+	approval.URL = record.URL
+	approval.LinkID = record.LinkID
+	if record.Email != nil {
+		approval.Email = record.Email
+	}
+	s.store.Update(*approval)
+
+	s.webhooks.Emit(EventApprovalApproved, approval.EventData())
+	s.webhooks.Emit(EventShareCreated, record.EventData())
+	sharesCreated.WithLabelValues("approval").Inc()
+
+	if approval.RequesterEmail != "" {
+		body := fmt.Sprintf("Your request to share %s was approved by %s.\n\nLink: %s", approval.Filename, decidedBy, record.URL)
+		if comment != "" {
+			body += "\n\nComment: " + comment
+		}
+		s.notify(config, []string{approval.RequesterEmail}, fmt.Sprintf("Share approved: %s", approval.Filename), body)
+	}
+
+	public := approval.public()
+	return &public, nil
+}
+
+// Reject declines a pending request and deletes the uploaded document
+func (s *ApprovalService) Reject(id, decidedBy, comment string) (*ShareApproval, error) {
+	if strings.TrimSpace(comment) == "" {
+		return nil, fmt.Errorf("a comment explaining the rejection is required")
+	}
+	approval, err := s.store.Claim(id, ApprovalRejected, decidedBy, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _ := LoadConfig()
+	s.deleteDocument(config, approval.DocNo)
+	s.webhooks.Emit(EventApprovalRejected, approval.EventData())
+
+	if approval.RequesterEmail != "" {
+		s.notify(config, []string{approval.RequesterEmail},
+			fmt.Sprintf("Share rejected: %s", approval.Filename),
+			fmt.Sprintf("Your request to share %s was rejected by %s.\n\nReason: %s", approval.Filename, decidedBy, comment))
+	}
+
+	public := approval.public()
+	return &public, nil
+}
+
+// expireStale expires pending requests nobody decided in time
+func (s *ApprovalService) expireStale() {
+	for _, id := range s.store.Stale() {
+		approval, err := s.store.Claim(id, ApprovalExpired, "system", "request expired without a decision")
+		if err != nil {
+			continue
+		}
+
+		config, _ := LoadConfig()
+		s.deleteDocument(config, approval.DocNo)
+		s.webhooks.Emit(EventApprovalExpired, approval.EventData())
+
+		if approval.RequesterEmail != "" {
+			s.notify(config, []string{approval.RequesterEmail},
+				fmt.Sprintf("Share request expired: %s", approval.Filename),
+				fmt.Sprintf("Your request to share %s expired before an admin approved it. Please share the file again if it is still needed.", approval.Filename))
+		}
+	}
+}
+
+// deleteDocument removes the uploaded document of a request that won't be shared
+func (s *ApprovalService) deleteDocument(config *Config, docNo int64) {
+	token, _ := GetAuthToken()
+	client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token)
+	if err := client.DeleteDocument(docNo); err != nil {
+		slog.Error("Failed to delete document of unapproved share", "doc_no", docNo, "error", err)
+	}
+}
+
+// notify sends a plain notification email, logging failures
+func (s *ApprovalService) notify(config *Config, to []string, subject, body string) {
+	mailer, err := NewMailer(config, config.SMTPPassword)
+	if err != nil {
+		slog.Error("Failed to send approval notification", "error", err)
+		return
+	}
+	htmlBody := "<p>" + strings.ReplaceAll(html.EscapeString(body), "\n", "<br>") + "</p>"
+	if err := mailer.Send(to, subject, body, htmlBody); err != nil {
+		slog.Error("Failed to send approval notification", "error", err)
+	}
+}
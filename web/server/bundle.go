@@ -0,0 +1,400 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Settings bundle file format
+const (
+	SettingsBundleFormat  = "thereforesharer-settings"
+	SettingsBundleVersion = 1
+)
+
+// scrypt parameters for deriving the credentials key from a passphrase
+const (
+	bundleKDF      = "scrypt"
+	bundleScryptN  = 1 << 15
+	bundleScryptR  = 8
+	bundleScryptP  = 1
+	bundleSaltSize = 16
+)
+
+// SettingsBundle carries settings from one installation to another. Secrets are never
+// stored in Config or Profiles; they travel only in Credentials, encrypted with a passphrase.
+type SettingsBundle struct {
+	Format      string                     `json:"format"`
+	Version     int                        `json:"version"`
+	App         string                     `json:"app"` // The app that exported it, either can import it
+	ExportedAt  string                     `json:"exported_at"`
+	Config      json.RawMessage            `json:"config"`
+	Profiles    map[string]json.RawMessage `json:"profiles,omitempty"` // Named settings applied over Config on import
+	Credentials *EncryptedCredentials      `json:"credentials,omitempty"`
+}
+
+// EncryptedCredentials holds the bundle's secrets, AES-256-GCM encrypted with a key
+// derived from the passphrase
+type EncryptedCredentials struct {
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// SettingsImportRequest selects what to import from a bundle
+type SettingsImportRequest struct {
+	Path       string `json:"path,omitempty"` // Desktop: the bundle file
+	Passphrase string `json:"passphrase"`     // Needed to import the credentials, if any
+	Profile    string `json:"profile"`        // Optional profile to apply over the bundle's settings
+}
+
+// SettingChange is one setting an import would change
+type SettingChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// ImportPreview describes what importing a bundle would do
+type ImportPreview struct {
+	App                string          `json:"app"`
+	ExportedAt         string          `json:"exportedAt"`
+	Profiles           []string        `json:"profiles"`
+	HasCredentials     bool            `json:"hasCredentials"`
+	CredentialsApplied bool            `json:"credentialsApplied"` // False without the passphrase, current secrets are kept
+	Changes            []SettingChange `json:"changes"`
+	Errors             []FieldError    `json:"errors"` // The import is refused while there are any
+}
+
+// newSettingsBundle exports settings, given as their JSON object. Secrets are removed
+// from the settings and, if a passphrase is given, encrypted into the credentials.
+func newSettingsBundle(app string, settings map[string]interface{}, passphrase string) (*SettingsBundle, error) {
+	secrets := make(map[string]string)
+	extractSecrets(settings, "", secrets)
+	delete(settings, "schema_version") // The importing app saves its own
+
+	config, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &SettingsBundle{
+		Format:     SettingsBundleFormat,
+		Version:    SettingsBundleVersion,
+		App:        app,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Config:     config,
+	}
+	if passphrase != "" && len(secrets) > 0 {
+		if bundle.Credentials, err = encryptCredentials(secrets, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return bundle, nil
+}
+
+// parseSettingsBundle reads a bundle file and checks its format
+func parseSettingsBundle(data []byte) (*SettingsBundle, error) {
+	var bundle SettingsBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("not a settings bundle: %w", err)
+	}
+	if bundle.Format != SettingsBundleFormat {
+		return nil, fmt.Errorf("not a settings bundle")
+	}
+	if bundle.Version > SettingsBundleVersion {
+		return nil, fmt.Errorf("settings bundle version %d is newer than this version of the app supports", bundle.Version)
+	}
+	if len(bundle.Config) == 0 {
+		return nil, fmt.Errorf("settings bundle has no settings")
+	}
+	return &bundle, nil
+}
+
+// importInto merges the bundle's settings, the chosen profile and, with the passphrase,
+// its credentials over current and decodes the result into config. Settings the bundle
+// doesn't mention keep their current value, as do secrets when no credentials are applied.
+// The preview lists the changes and, as Errors, why config is invalid.
+func (b *SettingsBundle) importInto(current map[string]interface{}, req SettingsImportRequest, config interface{ Validate() error }) (*ImportPreview, error) {
+	preview := &ImportPreview{App: b.App, ExportedAt: b.ExportedAt, Profiles: make([]string, 0), HasCredentials: b.Credentials != nil, Errors: make([]FieldError, 0)}
+	for name := range b.Profiles {
+		preview.Profiles = append(preview.Profiles, name)
+	}
+	sort.Strings(preview.Profiles)
+
+	merged := cloneTree(current)
+	layers := []json.RawMessage{b.Config}
+	if req.Profile != "" {
+		profile, ok := b.Profiles[req.Profile]
+		if !ok {
+			return nil, fmt.Errorf("settings bundle has no profile %q", req.Profile)
+		}
+		layers = append(layers, profile)
+	}
+	for _, layer := range layers {
+		var settings map[string]interface{}
+		if err := json.Unmarshal(layer, &settings); err != nil {
+			return nil, fmt.Errorf("invalid settings in bundle: %w", err)
+		}
+		// Secrets in plain text are ignored, they may only come from the credentials
+		extractSecrets(settings, "", make(map[string]string))
+		delete(settings, "schema_version")
+		mergeTree(merged, settings)
+	}
+
+	if b.Credentials != nil && req.Passphrase != "" {
+		secrets, err := decryptCredentials(b.Credentials, req.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		for pointer, value := range secrets {
+			setPointer(merged, pointer, value)
+		}
+		preview.CredentialsApplied = true
+	}
+
+	// Decoding drops settings this app doesn't have, such as web server settings on the desktop
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid settings in bundle: %w", err)
+	}
+	imported, err := settingsTree(config)
+	if err != nil {
+		return nil, err
+	}
+	preview.Changes = diffSettings(current, imported)
+
+	if err := config.Validate(); err != nil {
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) {
+			return nil, err
+		}
+		preview.Errors = invalid.Fields
+	}
+	return preview, nil
+}
+
+// extractSecrets moves the non-empty values of sensitive keys into secrets, keyed by
+// JSON pointer, and removes them from the tree
+func extractSecrets(v interface{}, pointer string, secrets map[string]string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			p := pointer + "/" + k
+			if s, ok := child.(string); ok && isSensitiveKey(k) {
+				if s != "" {
+					secrets[p] = s
+				}
+				delete(t, k)
+				continue
+			}
+			extractSecrets(child, p, secrets)
+		}
+	case []interface{}:
+		for i, child := range t {
+			extractSecrets(child, pointer+"/"+strconv.Itoa(i), secrets)
+		}
+	}
+}
+
+// setPointer sets the value at a JSON pointer produced by extractSecrets, if its parent exists
+func setPointer(tree map[string]interface{}, pointer, value string) {
+	parts := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	var node interface{} = tree
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch t := node.(type) {
+		case map[string]interface{}:
+			if last {
+				t[part] = value
+				return
+			}
+			if t[part] == nil {
+				t[part] = make(map[string]interface{})
+			}
+			node = t[part]
+		case []interface{}:
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 || n >= len(t) || last {
+				return
+			}
+			node = t[n]
+		default:
+			return
+		}
+	}
+}
+
+// mergeTree overlays src on dst. Objects are merged key by key, anything else replaced.
+func mergeTree(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sub, ok := v.(map[string]interface{}); ok {
+			if existing, ok := dst[k].(map[string]interface{}); ok {
+				mergeTree(existing, sub)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+func cloneTree(tree map[string]interface{}) map[string]interface{} {
+	data, _ := json.Marshal(tree)
+	var clone map[string]interface{}
+	json.Unmarshal(data, &clone)
+	return clone
+}
+
+// diffSettings lists the settings that differ, with secrets masked
+func diffSettings(from, to map[string]interface{}) []SettingChange {
+	before := make(map[string]string)
+	after := make(map[string]string)
+	flattenSettings(from, "", before)
+	flattenSettings(to, "", after)
+	delete(before, "schema_version") // Set when saving
+	delete(after, "schema_version")
+
+	changes := make([]SettingChange, 0)
+	for field, value := range after {
+		if before[field] != value {
+			changes = append(changes, SettingChange{Field: field, From: maskSetting(field, before[field]), To: maskSetting(field, value)})
+		}
+	}
+	for field, value := range before {
+		if _, ok := after[field]; !ok {
+			changes = append(changes, SettingChange{Field: field, From: maskSetting(field, value)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// flattenSettings maps dotted field paths to display values. Lists are shown as JSON.
+func flattenSettings(v interface{}, prefix string, out map[string]string) {
+	if m, ok := v.(map[string]interface{}); ok {
+		for k, child := range m {
+			field := k
+			if prefix != "" {
+				field = prefix + "." + k
+			}
+			flattenSettings(child, field, out)
+		}
+		return
+	}
+	switch t := v.(type) {
+	case nil:
+	case string:
+		out[prefix] = t
+	default:
+		data, _ := json.Marshal(v)
+		out[prefix] = string(data)
+	}
+}
+
+// maskSetting hides the value of a secret setting, and secrets inside lists
+func maskSetting(field, value string) string {
+	if value != "" && isSensitiveKey(field[strings.LastIndex(field, ".")+1:]) {
+		return redacted
+	}
+	if strings.HasPrefix(value, "[") {
+		var list interface{}
+		if json.Unmarshal([]byte(value), &list) == nil {
+			data, _ := json.Marshal(redactSecrets(list))
+			return string(data)
+		}
+	}
+	return value
+}
+
+func bundleKey(passphrase string, salt []byte, n, r, p int) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+}
+
+func encryptCredentials(secrets map[string]string, passphrase string) (*EncryptedCredentials, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	creds := &EncryptedCredentials{KDF: bundleKDF, N: bundleScryptN, R: bundleScryptR, P: bundleScryptP, Salt: make([]byte, bundleSaltSize)}
+	if _, err := rand.Read(creds.Salt); err != nil {
+		return nil, err
+	}
+	key, err := bundleKey(passphrase, creds.Salt, creds.N, creds.R, creds.P)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	creds.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(creds.Nonce); err != nil {
+		return nil, err
+	}
+	creds.Ciphertext = gcm.Seal(nil, creds.Nonce, plaintext, []byte(SettingsBundleFormat))
+	return creds, nil
+}
+
+func decryptCredentials(creds *EncryptedCredentials, passphrase string) (map[string]string, error) {
+	// Only the parameters of the export are accepted, others could make scrypt use
+	// any amount of memory and time
+	if creds.KDF != bundleKDF || creds.N != bundleScryptN || creds.R != bundleScryptR || creds.P != bundleScryptP {
+		return nil, fmt.Errorf("unsupported credentials encryption")
+	}
+	key, err := bundleKey(passphrase, creds.Salt, creds.N, creds.R, creds.P)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	plaintext, err := gcm.Open(nil, creds.Nonce, creds.Ciphertext, []byte(SettingsBundleFormat))
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or damaged credentials")
+	}
+	var secrets map[string]string
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid credentials: %w", err)
+	}
+	return secrets, nil
+}
+
+// settingsTree converts a config to its JSON object form
+func settingsTree(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -13,8 +15,25 @@ const (
 	configFileName = "config.json"
 )
 
+// configMigrations upgrade config files written by older versions, in order. The last
+// one's version is the current schema version.
+var configMigrations = []configMigration{
+	{To: 1, Description: "record the schema version, derive a missing auth type from the stored token", Migrate: func(raw map[string]json.RawMessage) error {
+		if rawString(raw, "auth_type") == "" {
+			authType := "basic"
+			if strings.HasPrefix(strings.ToLower(rawString(raw, "auth_token")), "bearer ") {
+				authType = "bearer"
+			}
+			setRawString(raw, "auth_type", authType)
+		}
+		return nil
+	}},
+}
+
 // Config holds the application configuration
 type Config struct {
+	SchemaVersion int `json:"schema_version"` // Set on save, used to migrate older files
+
 	BaseURL         string `json:"base_url"`
 	TenantName      string `json:"tenant_name"`
 	CategoryNo      int    `json:"category_no"`
@@ -25,58 +44,224 @@ type Config struct {
 	UserPassword    string `json:"user_password,omitempty"`  // Share only access
 	IsSetUp         bool   `json:"is_set_up"`
 	DefaultArchive  string `json:"default_archive"` // Default archive name for multiple files
+
+	// Email delivery of share links
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     int    `json:"smtp_port"`
+	SMTPSecurity string `json:"smtp_security"` // "none", "starttls" or "tls"
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+	SMTPFrom     string `json:"smtp_from"`
+
+	// Outgoing webhooks for share lifecycle events
+	Webhooks []WebhookTarget `json:"webhooks,omitempty"`
+
+	// Rate limits, size limits and upload quotas
+	Limits LimitsConfig `json:"limits"`
+
+	// Virus scanning of uploads through clamd, an empty action rejects infected uploads
+	VirusScan ScanConfig `json:"virus_scan"`
+
+	// Data-loss-prevention rules checked before files are shared
+	DLPRules []DLPRule `json:"dlp_rules,omitempty"`
+
+	// Category routing: rules pick the upload category, users may choose from the allowed list
+	RoutingRules      []RoutingRule `json:"routing_rules,omitempty"`
+	AllowedCategories []int         `json:"allowed_categories,omitempty"`
+
+	// Minutes the category tree is cached before it is refreshed, 0 = 10
+	CategoryCacheMinutes int `json:"category_cache_minutes,omitempty"`
+
+	// Password and expiry requirements for shared links, by category and role
+	SharePolicies []SharePolicy `json:"share_policies,omitempty"`
+
+	// Structured log level and format
+	Logging LogConfig `json:"logging"`
+
+	// OpenTelemetry trace export, off unless an endpoint is set
+	Tracing TracingConfig `json:"tracing"`
+
+	// Four-eyes approval: shares by non-admins to these categories wait for an admin
+	ApprovalCategories  []int    `json:"approval_categories,omitempty"`
+	ApprovalExpiryHours int      `json:"approval_expiry_hours"`    // Pending requests expire after this, default 72
+	ApprovalNotify      []string `json:"approval_notify,omitempty"` // Admin addresses emailed about new requests
+
+	// Seconds a shutdown waits for in-flight requests before cancelling uploads, 0 = 30
+	ShutdownTimeoutSeconds int `json:"shutdown_timeout_seconds,omitempty"`
+
+	// Bearer token required to scrape /metrics, empty = open
+	MetricsToken string `json:"metrics_token,omitempty"`
+
+	// Listen address, TLS, reverse proxies, base path, CORS and cookies, read at startup
+	Server ServerConfig `json:"server"`
 }
 
 // GetConfigPath returns the full path to the config file
 func GetConfigPath() string {
-	cwd, _ := os.Getwd()
-	dataDir := filepath.Join(cwd, "data")
+	dataDir := dataDirOverride
+	if dataDir == "" {
+		cwd, _ := os.Getwd()
+		dataDir = filepath.Join(cwd, "data")
+	}
 	
 	// Ensure data directory exists
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		fmt.Printf("ERROR: Failed to create data directory at %s: %v\n", dataDir, err)
+		slog.Error("Failed to create data directory", "path", dataDir, "error", err)
 	}
 	
 	path := filepath.Join(dataDir, configFileName)
 	return path
 }
 
-// LoadConfig loads the configuration from disk
+// configStore holds the config file in memory and serialises saves
+var configStore = NewConfigStore(GetConfigPath)
+
+// LoadConfig returns a copy of the configuration with the environment and flag overrides applied
 func LoadConfig() (*Config, error) {
-	configPath := GetConfigPath()
-	
-	data, err := os.ReadFile(configPath)
+	config, _, err := LoadConfigVersion()
+	return config, err
+}
+
+// LoadConfigVersion is LoadConfig that also returns the version of the config file
+func LoadConfigVersion() (*Config, string, error) {
+	config, version, err := configStore.Get()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return &Config{}, nil
-		}
-		return nil, fmt.Errorf("failed to read config at %s: %w", configPath, err)
+		return nil, "", err
+	}
+	if err := applyOverrides(config, configOverrides); err != nil {
+		return nil, "", err
+	}
+	return config, version, nil
+}
+
+// decodeConfig parses the config file, migrating it if needed. It reports whether the
+// file should be rewritten with the migrated config; a read-only config is only
+// migrated in memory.
+func decodeConfig(path string, data []byte) (*Config, bool, error) {
+	data, migrated, err := migrateConfig(path, data, configMigrations, !configReadOnly)
+	if err != nil {
+		return nil, false, err
 	}
 
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+		return nil, false, fmt.Errorf("failed to parse config: %w", err)
 	}
+	return &config, migrated && !configReadOnly, nil
+}
 
-	return &config, nil
+// currentSchemaVersion is the schema version configs are saved with
+func currentSchemaVersion() int {
+	return configMigrations[len(configMigrations)-1].To
 }
 
-// SaveConfig saves the configuration to disk
-func (c *Config) SaveConfig() error {
-	data, err := json.MarshalIndent(c, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+// Validate checks every field and returns a *ValidationError listing the invalid ones
+func (c *Config) Validate() error {
+	v := &ValidationError{}
+	v.URL("base_url", c.BaseURL, c.IsSetUp)
+	if c.IsSetUp {
+		v.OneOf("auth_type", c.AuthType, "basic", "bearer")
+		if c.CategoryNo <= 0 {
+			v.Add("category_no", "must be a positive category number")
+		}
+	} else {
+		v.OneOf("auth_type", c.AuthType, "", "basic", "bearer")
+		v.NotNegative("category_no", int64(c.CategoryNo))
 	}
+	validateSMTP(v, c.SMTPHost, c.SMTPPort, c.SMTPSecurity, c.SMTPFrom)
 
-	configPath := GetConfigPath()
-	fmt.Printf("Saving config to: %s\n", configPath)
-	
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
-		fmt.Printf("ERROR: Failed to write config to %s: %v\n", configPath, err)
-		return fmt.Errorf("failed to write config: %w", err)
+	for i, w := range c.Webhooks {
+		v.URL(fmt.Sprintf("webhooks[%d].url", i), w.URL, true)
+		for j, e := range w.Events {
+			v.OneOf(fmt.Sprintf("webhooks[%d].events[%d]", i, j), e, EventShareCreated, EventLinkRevoked, EventDocumentDeleted, EventLinkExpired,
+				EventApprovalRequested, EventApprovalApproved, EventApprovalRejected, EventApprovalExpired)
+		}
+	}
+
+	for field, limit := range map[string]RateLimit{"limits.login_per_ip": c.Limits.LoginPerIP, "limits.share_per_ip": c.Limits.SharePerIP, "limits.share_per_user": c.Limits.SharePerUser} {
+		v.NotNegative(field+".requests", int64(limit.Requests))
+		v.NotNegative(field+".window_seconds", int64(limit.WindowSeconds))
+	}
+	v.NotNegative("limits.max_request_bytes", c.Limits.MaxRequestBytes)
+	v.NotNegative("limits.max_file_bytes", c.Limits.MaxFileBytes)
+	for user, q := range c.Limits.Quotas {
+		v.NotNegative("limits.quotas."+user+".daily_bytes", q.DailyBytes)
+		v.NotNegative("limits.quotas."+user+".monthly_bytes", q.MonthlyBytes)
+	}
+
+	v.OneOf("virus_scan.action", c.VirusScan.Action, "", ScanActionReject, ScanActionQuarantine, ScanActionWarn)
+	if a := c.VirusScan.Address; a != "" && !strings.HasPrefix(a, "tcp://") && !strings.HasPrefix(a, "unix://") {
+		v.Add("virus_scan.address", `must start with "tcp://" or "unix://"`)
+	}
+	v.NotNegative("virus_scan.timeout_seconds", int64(c.VirusScan.TimeoutSeconds))
+
+	validateDLPRules(v, c.DLPRules)
+	validateRouting(v, c.RoutingRules, c.AllowedCategories)
+	v.NotNegative("category_cache_minutes", int64(c.CategoryCacheMinutes))
+	validateSharePolicies(v, c.SharePolicies)
+	validateObservability(v, c.Logging, c.Tracing)
+
+	for i, n := range c.ApprovalCategories {
+		if n <= 0 {
+			v.Add(fmt.Sprintf("approval_categories[%d]", i), "must be a positive category number")
+		}
+	}
+	v.NotNegative("approval_expiry_hours", int64(c.ApprovalExpiryHours))
+	for i, addr := range c.ApprovalNotify {
+		v.Email(fmt.Sprintf("approval_notify[%d]", i), addr)
 	}
+	v.NotNegative("shutdown_timeout_seconds", int64(c.ShutdownTimeoutSeconds))
 
-	return nil
+	if c.Server.TLSCert != "" && c.Server.TLSKey == "" || c.Server.TLSCert == "" && c.Server.TLSKey != "" {
+		v.Add("server.tls_key", "tls_cert and tls_key must be set together")
+	}
+	if _, err := NewProxyTrust(c.Server.TrustedProxies); err != nil {
+		v.Add("server.trusted_proxies", "%v", err)
+	}
+	for i, o := range c.Server.CORSOrigins {
+		v.URL(fmt.Sprintf("server.cors_origins[%d]", i), o, true)
+	}
+	v.OneOf("server.cookie_secure", c.Server.CookieSecure, "", CookieSecureAuto, CookieSecureAlways, CookieSecureNever)
+	v.OneOf("server.cookie_same_site", c.Server.CookieSameSite, "", "lax", "strict", "none")
+
+	// Map iteration order is random, keep the report stable
+	sort.Slice(v.Fields, func(i, j int) bool { return v.Fields[i].Field < v.Fields[j].Field })
+	return v.Err()
+}
+
+// SaveConfig validates the configuration and saves it to disk, or fails with ErrConfigReadOnly
+func (c *Config) SaveConfig() error {
+	_, err := UpdateConfig("", func(current *Config) error {
+		*current = *c
+		return nil
+	})
+	return err
+}
+
+// UpdateConfig applies fn to the current config and saves the result, with no other
+// update in between. With ifVersion set, it fails with ErrConfigChanged if the config
+// changed since that version was loaded. It returns the new version.
+func UpdateConfig(ifVersion string, fn func(*Config) error) (string, error) {
+	if configReadOnly {
+		return "", ErrConfigReadOnly
+	}
+	return configStore.Update(ifVersion, func(stored *Config) (*Config, error) {
+		config := cloneConfig(stored)
+		if err := applyOverrides(config, configOverrides); err != nil {
+			return nil, err
+		}
+		if err := fn(config); err != nil {
+			return nil, err
+		}
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+		config.SchemaVersion = currentSchemaVersion()
+
+		// Settings from the environment or flags keep their file value
+		keepFileValues(config, stored)
+		return config, nil
+	})
 }
 
 // GetAuthToken retrieves the authentication token from config
@@ -90,12 +275,11 @@ func GetAuthToken() (string, error) {
 
 // SetAuthToken stores the authentication token in config
 func SetAuthToken(token string) error {
-	config, err := LoadConfig()
-	if err != nil {
-		return err
-	}
-	config.AuthToken = token
-	return config.SaveConfig()
+	_, err := UpdateConfig("", func(config *Config) error {
+		config.AuthToken = token
+		return nil
+	})
+	return err
 }
 
 // CreateBasicAuthToken creates a Basic auth token from username and password
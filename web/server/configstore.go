@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const configWatchInterval = 2 * time.Second
+
+// ErrConfigChanged is returned when the config was changed since the version an update was based on
+var ErrConfigChanged = errors.New("the configuration was changed in the meantime, reload it and try again")
+
+// ConfigStore keeps the config in memory, so requests don't re-read the file, and
+// serialises changes so concurrent updates can't overwrite each other. The version
+// is a hash of the file contents and changes with every save or external edit.
+type ConfigStore struct {
+	path func() string
+
+	mu       sync.RWMutex
+	config   *Config // As stored in the file, never handed out
+	version  string
+	modTime  time.Time
+	size     int64
+	loaded   bool
+	onChange []func()
+}
+
+// NewConfigStore creates a store for the file at path(), which is loaded on first use
+func NewConfigStore(path func() string) *ConfigStore {
+	return &ConfigStore{path: path}
+}
+
+// Get returns a copy of the stored config and its version
+func (s *ConfigStore) Get() (*Config, string, error) {
+	s.mu.RLock()
+	if s.loaded {
+		defer s.mu.RUnlock()
+		return cloneConfig(s.config), s.version, nil
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, "", err
+	}
+	return cloneConfig(s.config), s.version, nil
+}
+
+// Update passes a copy of the stored config to fn and saves the config fn returns.
+// Updates run one at a time. With ifVersion set, it fails with ErrConfigChanged
+// unless the stored config still has that version. It returns the new version.
+func (s *ConfigStore) Update(ifVersion string, fn func(stored *Config) (*Config, error)) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return "", err
+	}
+	if ifVersion != "" && ifVersion != s.version {
+		return "", ErrConfigChanged
+	}
+
+	updated, err := fn(cloneConfig(s.config))
+	if err != nil {
+		return "", err
+	}
+	if err := s.writeLocked(updated); err != nil {
+		return "", err
+	}
+	return s.version, nil
+}
+
+// OnChange registers fn to run after the file was changed by something other than the store
+func (s *ConfigStore) OnChange(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = append(s.onChange, fn)
+}
+
+// Start watches the file for external edits and reloads it when it changes
+func (s *ConfigStore) Start() {
+	go func() {
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.reloadIfChanged()
+		}
+	}()
+}
+
+func (s *ConfigStore) reloadIfChanged() {
+	info, err := os.Stat(s.path())
+	s.mu.RLock()
+	unchanged := (err != nil && !s.loaded) || (err == nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size)
+	s.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	s.mu.Lock()
+	previous := s.version
+	wasLoaded := s.loaded
+	s.loaded = false
+	if err := s.loadLocked(); err != nil {
+		// Keep serving the last good config until the file is fixed
+		slog.Error("Config file changed but could not be loaded, keeping the previous config", "error", err)
+		s.loaded = wasLoaded
+		if info != nil {
+			s.modTime, s.size = info.ModTime(), info.Size()
+		}
+		s.mu.Unlock()
+		return
+	}
+	version := s.version
+	hooks := append([]func(){}, s.onChange...)
+	s.mu.Unlock()
+
+	if version != previous {
+		slog.Info("Config file changed on disk, reloaded", "version", version)
+		for _, fn := range hooks {
+			fn()
+		}
+	}
+}
+
+// loadLocked reads the file unless it is already loaded, the caller must hold s.mu
+func (s *ConfigStore) loadLocked() error {
+	if s.loaded {
+		return nil
+	}
+	path := s.path()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		s.config = &Config{SchemaVersion: currentSchemaVersion()}
+		s.version, s.modTime, s.size = contentVersion(nil), time.Time{}, 0
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config at %s: %w", path, err)
+	}
+
+	config, rewrite, err := decodeConfig(path, data)
+	if err != nil {
+		return err
+	}
+	if rewrite {
+		return s.writeLocked(config)
+	}
+
+	s.config = config
+	s.version = contentVersion(data)
+	if info, err := os.Stat(path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	s.loaded = true
+	return nil
+}
+
+// writeLocked saves config atomically and makes it the stored config, the caller must hold s.mu
+func (s *ConfigStore) writeLocked(config *Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	path := s.path()
+	slog.Debug("Saving config", "path", path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		slog.Error("Failed to write config", "path", path, "error", err)
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	s.config = cloneConfig(config)
+	s.version = contentVersion(data)
+	if info, err := os.Stat(path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	s.loaded = true
+	return nil
+}
+
+// cloneConfig deep copies a config, so callers can't change the stored one
+func cloneConfig(c *Config) *Config {
+	data, _ := json.Marshal(c)
+	var clone Config
+	json.Unmarshal(data, &clone)
+	return &clone
+}
+
+// contentVersion identifies a version of the config file by its contents
+func contentVersion(data []byte) string {
+	sum := sha256.Sum256(bytes.TrimSpace(data))
+	return hex.EncodeToString(sum[:8])
+}
+
+// writeFileAtomic replaces path with data so readers and crashes see either the old or
+// the new file, never a partial one: it writes a temp file in the same directory, syncs
+// it to disk, renames it over path and syncs the directory
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself, not supported on Windows
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Actions taken when a file matches a DLP rule
+const (
+	DLPActionBlock           = "block"
+	DLPActionRequireProtect  = "require_protection" // Password and short expiry required
+	DLPActionRequireApproval = "require_approval"
+)
+
+// Built-in detectors that validate checksums as well as the pattern
+const (
+	DetectorCreditCard = "credit_card"
+	DetectorIBAN       = "iban"
+)
+
+const (
+	defaultDLPMaxExpiryDays = 7
+	dlpMaxInspectBytes      = 50 << 20 // Files with more content than this can't be fully inspected
+)
+
+var (
+	creditCardPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	ibanPattern       = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`)
+)
+
+// DLPRule is an admin defined content rule checked before files are shared
+type DLPRule struct {
+	Name             string   `json:"name"`
+	Action           string   `json:"action"`            // "block", "require_protection" or "require_approval"
+	Patterns         []string `json:"patterns"`          // Regular expressions matched against file content
+	Detectors        []string `json:"detectors"`         // "credit_card" and/or "iban"
+	Extensions       []string `json:"extensions"`        // e.g. ".exe"
+	FilenamePatterns []string `json:"filename_patterns"` // Globs such as "*confidential*"
+	MaxFileBytes     int64    `json:"max_file_bytes"`
+	MaxExpiryDays    int      `json:"max_expiry_days"` // For require_protection, default 7
+}
+
+// DLPMatch records a file that matched a rule
+type DLPMatch struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// DLPResult is the outcome of inspecting a set of files
+type DLPResult struct {
+	Matches []DLPMatch `json:"matches"`
+
+	maxExpiryDays int
+}
+
+// first returns the first match with the given action
+func (r *DLPResult) first(action string) *DLPMatch {
+	if r == nil {
+		return nil
+	}
+	for i := range r.Matches {
+		if r.Matches[i].Action == action {
+			return &r.Matches[i]
+		}
+	}
+	return nil
+}
+
+// RequiresApproval returns the first match that needs an admin to approve the share
+func (r *DLPResult) RequiresApproval() *DLPMatch {
+	return r.first(DLPActionRequireApproval)
+}
+
+// CheckShare returns an error naming the rule if the share isn't allowed with the
+// given password and expiry. Approval requirements are left to the caller.
+func (r *DLPResult) CheckShare(password string, expiry *time.Time) error {
+	if m := r.first(DLPActionBlock); m != nil {
+		return fmt.Errorf("sharing blocked by rule %q: %s %s", m.Rule, m.File, m.Reason)
+	}
+	if m := r.first(DLPActionRequireProtect); m != nil {
+		limit := time.Now().AddDate(0, 0, r.maxExpiryDays)
+		if password == "" || expiry == nil || expiry.After(limit) {
+			return fmt.Errorf("rule %q requires a password and an expiry of at most %d days: %s %s", m.Rule, r.maxExpiryDays, m.File, m.Reason)
+		}
+	}
+	return nil
+}
+
+// InspectFiles checks files against DLP rules. An invalid rule is reported as an error.
+func InspectFiles(rules []DLPRule, filePaths []string) (*DLPResult, error) {
+	result := &DLPResult{Matches: []DLPMatch{}}
+	if len(rules) == 0 {
+		return result, nil
+	}
+
+	compiled := make([][]*regexp.Regexp, len(rules))
+	needContent := false
+	for i, rule := range rules {
+		switch rule.Action {
+		case DLPActionBlock, DLPActionRequireProtect, DLPActionRequireApproval:
+		default:
+			return nil, fmt.Errorf("DLP rule %q has unknown action %q", rule.Name, rule.Action)
+		}
+		for _, p := range rule.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("DLP rule %q has an invalid pattern: %w", rule.Name, err)
+			}
+			compiled[i] = append(compiled[i], re)
+		}
+		for _, d := range rule.Detectors {
+			if d != DetectorCreditCard && d != DetectorIBAN {
+				return nil, fmt.Errorf("DLP rule %q has unknown detector %q", rule.Name, d)
+			}
+		}
+		if len(rule.Patterns) > 0 || len(rule.Detectors) > 0 {
+			needContent = true
+		}
+	}
+
+	for _, path := range filePaths {
+		name := filepath.Base(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot access file %s: %w", path, err)
+		}
+
+		var content [][]byte
+		var uninspected string
+		if needContent {
+			content, uninspected, err = inspectableContent(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to inspect %s: %w", name, err)
+			}
+		}
+
+		for i, rule := range rules {
+			reason := matchRule(rule, compiled[i], name, info.Size(), content, uninspected)
+			if reason == "" {
+				continue
+			}
+			result.Matches = append(result.Matches, DLPMatch{Rule: rule.Name, Action: rule.Action, File: name, Reason: reason})
+
+			if rule.Action == DLPActionRequireProtect {
+				days := rule.MaxExpiryDays
+				if days <= 0 {
+					days = defaultDLPMaxExpiryDays
+				}
+				if result.maxExpiryDays == 0 || days < result.maxExpiryDays {
+					result.maxExpiryDays = days
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// matchRule returns why a file matches a rule, or "" if it doesn't. A file whose
+// content could only partly be inspected matches every content rule it didn't match
+// otherwise, so nothing gets through unchecked.
+func matchRule(rule DLPRule, patterns []*regexp.Regexp, name string, size int64, content [][]byte, uninspected string) string {
+	if rule.MaxFileBytes > 0 && size > rule.MaxFileBytes {
+		return fmt.Sprintf("is larger than %d bytes", rule.MaxFileBytes)
+	}
+	for _, ext := range rule.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if strings.EqualFold(filepath.Ext(name), ext) {
+			return fmt.Sprintf("has blocked extension %s", ext)
+		}
+	}
+	for _, glob := range rule.FilenamePatterns {
+		if ok, _ := filepath.Match(strings.ToLower(glob), strings.ToLower(name)); ok {
+			return fmt.Sprintf("matches filename pattern %s", glob)
+		}
+	}
+	for _, data := range content {
+		for _, re := range patterns {
+			if re.Match(data) {
+				return fmt.Sprintf("contains text matching %s", re.String())
+			}
+		}
+		for _, d := range rule.Detectors {
+			if d == DetectorCreditCard && containsCardNumber(data) {
+				return "contains a credit card number"
+			}
+			if d == DetectorIBAN && containsIBAN(data) {
+				return "contains an IBAN"
+			}
+		}
+	}
+	if uninspected != "" && (len(patterns) > 0 || len(rule.Detectors) > 0) {
+		return "could not be fully inspected: " + uninspected
+	}
+	return ""
+}
+
+// inspectableContent returns the text to inspect for a file. Zip based files,
+// including Office documents, are inspected entry by entry. When some of the content
+// can't be inspected, such as encrypted entries or content over dlpMaxInspectBytes,
+// the reason is returned with what could be read.
+func inspectableContent(path string) ([][]byte, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The central directory is at the end of a zip, so it's opened on the whole file
+	zr, zipErr := zip.NewReader(f, info.Size())
+	if zipErr == nil {
+		return zipContent(zr)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, dlpMaxInspectBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return [][]byte{data}, "damaged archive: " + zipErr.Error(), nil
+	}
+	if len(data) > dlpMaxInspectBytes {
+		return [][]byte{data[:dlpMaxInspectBytes]}, fmt.Sprintf("larger than %d bytes", dlpMaxInspectBytes), nil
+	}
+	// Not an archive, inspect the raw bytes
+	return [][]byte{data}, "", nil
+}
+
+// zipContent reads the entries of an archive, up to dlpMaxInspectBytes in total
+func zipContent(zr *zip.Reader) ([][]byte, string, error) {
+	var content [][]byte
+	var uninspected []string
+	remaining := int64(dlpMaxInspectBytes)
+	for _, entry := range zr.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		if entry.Flags&0x1 != 0 {
+			uninspected = append(uninspected, entry.Name+" is encrypted")
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			uninspected = append(uninspected, fmt.Sprintf("%s can't be read: %v", entry.Name, err))
+			continue
+		}
+		entryData, err := io.ReadAll(io.LimitReader(rc, remaining+1))
+		rc.Close()
+		if err != nil {
+			uninspected = append(uninspected, fmt.Sprintf("%s can't be read: %v", entry.Name, err))
+		}
+		if int64(len(entryData)) > remaining {
+			content = append(content, entryData[:remaining])
+			uninspected = append(uninspected, fmt.Sprintf("content beyond %d bytes", dlpMaxInspectBytes))
+			break
+		}
+		remaining -= int64(len(entryData))
+		content = append(content, entryData)
+	}
+	return content, strings.Join(uninspected, ", "), nil
+}
+
+// containsCardNumber reports whether data contains a digit run passing the Luhn check
+func containsCardNumber(data []byte) bool {
+	for _, m := range creditCardPattern.FindAll(data, -1) {
+		digits := make([]int, 0, len(m))
+		for _, b := range m {
+			if b >= '0' && b <= '9' {
+				digits = append(digits, int(b-'0'))
+			}
+		}
+		if len(digits) >= 13 && len(digits) <= 19 && luhnValid(digits) {
+			return true
+		}
+	}
+	return false
+}
+
+func luhnValid(digits []int) bool {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// containsIBAN reports whether data contains an IBAN passing the mod-97 check
+func containsIBAN(data []byte) bool {
+	for _, m := range ibanPattern.FindAll(data, -1) {
+		iban := strings.ReplaceAll(string(m), " ", "")
+		if len(iban) < 15 || len(iban) > 34 {
+			continue
+		}
+		rearranged := iban[4:] + iban[:4]
+		rem := 0
+		for _, c := range rearranged {
+			if c >= '0' && c <= '9' {
+				rem = (rem*10 + int(c-'0')) % 97
+			} else {
+				rem = (rem*100 + int(c-'A'+10)) % 97
+			}
+		}
+		if rem == 1 {
+			return true
+		}
+	}
+	return false
+}
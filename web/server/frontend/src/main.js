@@ -4,7 +4,8 @@ import appIconUrl from './appicon.png';
 
 let appElement;
 
-const API_BASE = '/api';
+// Relative to the <base> the server sets, so the portal also works under a base path
+const API_BASE = new URL('api', document.baseURI).pathname;
 
 const appState = {
     files: [],
@@ -46,15 +47,28 @@ const API = {
     async getConfig() {
         const resp = await fetch(`${API_BASE}/config`);
         if (resp.status === 401 || resp.status === 403) throw new Error('Unauthorized');
+        // Sent back when saving, so changes made by someone else in between aren't overwritten
+        appState.configETag = resp.headers.get('ETag');
         return await resp.json();
     },
     async saveConfig(data) {
+        const headers = { 'Content-Type': 'application/json' };
+        if (appState.configETag) headers['If-Match'] = appState.configETag;
         const resp = await fetch(`${API_BASE}/config`, {
             method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
+            headers,
             body: JSON.stringify(data)
         });
-        return await resp.json();
+        if (resp.status === 412) {
+            throw new Error('Settings were changed by someone else while you were editing. Reopen settings to see the current values.');
+        }
+        appState.configETag = resp.headers.get('ETag');
+        const result = await resp.json();
+        if (!resp.ok) {
+            const fields = (result.fields || []).map(f => `${f.field}: ${f.message}`);
+            throw new Error(fields.length ? 'Invalid settings:\n' + fields.join('\n') : result.error || 'Failed to save settings');
+        }
+        return result;
     },
     async setAuthCredentials(authType, username, password, token) {
         const resp = await fetch(`${API_BASE}/auth`, {
@@ -81,13 +95,19 @@ const API = {
         }
         return await resp.json();
     },
-    shareFiles(files, password, expiryDays, customExpiry, onProgress) {
+    shareFiles(files, password, expiryDays, customExpiry, email, onProgress) {
         return new Promise((resolve, reject) => {
             const formData = new FormData();
             files.forEach(f => formData.append('files', f));
             formData.append('password', password);
             formData.append('expiryDays', expiryDays);
             formData.append('customExpiry', customExpiry);
+            formData.append('recipients', email.recipients);
+            formData.append('message', email.message);
+            formData.append('sendPassword', email.sendPassword);
+            formData.append('notifyEmail', email.notifyEmail);
+            formData.append('categoryNo', email.categoryNo);
+            if (email.generatePassword) formData.append('generatePassword', JSON.stringify(email.generatePassword));
 
             const xhr = new XMLHttpRequest();
             xhr.open('POST', `${API_BASE}/share`, true);
@@ -104,7 +124,8 @@ const API = {
                     resolve(JSON.parse(xhr.responseText));
                 } else {
                     const err = JSON.parse(xhr.responseText || '{"error": "Unknown error"}');
-                    reject(new Error(err.error || 'Upload failed'));
+                    const fields = (err.fields || []).map(f => `${f.field}: ${f.message}`);
+                    reject(new Error(fields.length ? fields.join('\n') : err.error || 'Upload failed'));
                 }
             };
 
@@ -112,6 +133,192 @@ const API = {
             xhr.send(formData);
         });
     },
+    async sendTestEmail(to) {
+        const resp = await fetch(`${API_BASE}/email/test`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ to })
+        });
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to send test email');
+        }
+        return await resp.json();
+    },
+    async getApiKeys() {
+        const resp = await fetch(`${API_BASE}/keys`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to fetch API keys');
+        }
+        return await resp.json();
+    },
+    async createApiKey(req) {
+        const resp = await fetch(`${API_BASE}/keys`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(req)
+        });
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to create API key');
+        }
+        return await resp.json();
+    },
+    async deleteApiKey(id) {
+        const resp = await fetch(`${API_BASE}/keys/${id}`, { method: 'DELETE' });
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to delete API key');
+        }
+        return await resp.json();
+    },
+    async getUsage() {
+        const resp = await fetch(`${API_BASE}/usage`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to fetch usage');
+        }
+        return await resp.json();
+    },
+    async getWebhookDeliveries() {
+        const resp = await fetch(`${API_BASE}/webhooks/deliveries`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to fetch webhook deliveries');
+        }
+        return await resp.json();
+    },
+    async revokeLink(linkId) {
+        const resp = await fetch(`${API_BASE}/links/${encodeURIComponent(linkId)}/revoke`, { method: 'POST' });
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to revoke link');
+        }
+        return await resp.json();
+    },
+    async deleteDocument(docNo) {
+        const resp = await fetch(`${API_BASE}/documents/${docNo}`, { method: 'DELETE' });
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to delete document');
+        }
+        return await resp.json();
+    },
+    async verifyDocument(docNo) {
+        const resp = await fetch(`${API_BASE}/documents/${docNo}/verify`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to verify document');
+        }
+        return await resp.json();
+    },
+    async getCategoryChoices() {
+        const resp = await fetch(`${API_BASE}/categories/choices`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to fetch categories');
+        }
+        return await resp.json();
+    },
+    async getSharePolicy(categoryNo) {
+        const resp = await fetch(`${API_BASE}/share/policy?categoryNo=${categoryNo}`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to fetch the share policy');
+        }
+        return await resp.json();
+    },
+    async searchCategories(query) {
+        const resp = await fetch(`${API_BASE}/categories/search?q=${encodeURIComponent(query)}`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to search categories');
+        }
+        return await resp.json();
+    },
+    async getCategoryStatus() {
+        const resp = await fetch(`${API_BASE}/categories/status`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to check category');
+        }
+        return await resp.json();
+    },
+    async validateRouting() {
+        const resp = await fetch(`${API_BASE}/routing/validate`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to check routing rules');
+        }
+        return await resp.json();
+    },
+    async getOrphans() {
+        const resp = await fetch(`${API_BASE}/orphans`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to fetch orphaned uploads');
+        }
+        return await resp.json();
+    },
+    async dismissOrphan(id, deleteDocument) {
+        const resp = await fetch(`${API_BASE}/orphans/${id}?deleteDocument=${deleteDocument}`, { method: 'DELETE' });
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to clean up orphaned upload');
+        }
+        return await resp.json();
+    },
+    async getApprovals() {
+        const resp = await fetch(`${API_BASE}/approvals`);
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to fetch approval requests');
+        }
+        return await resp.json();
+    },
+    async decideApproval(id, decision, comment) {
+        const resp = await fetch(`${API_BASE}/approvals/${id}/${decision}`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ comment })
+        });
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || `Failed to ${decision} request`);
+        }
+        return await resp.json();
+    },
+    async exportSettings(passphrase) {
+        const resp = await fetch(`${API_BASE}/settings/export`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ passphrase })
+        });
+        if (!resp.ok) {
+            const err = await resp.json();
+            throw new Error(err.error || 'Failed to export settings');
+        }
+        return await resp.blob();
+    },
+    async importSettings(req, preview) {
+        const headers = { 'Content-Type': 'application/json' };
+        if (!preview && appState.configETag) headers['If-Match'] = appState.configETag;
+        const resp = await fetch(`${API_BASE}/settings/import${preview ? '/preview' : ''}`, {
+            method: 'POST',
+            headers,
+            body: JSON.stringify(req)
+        });
+        if (resp.status === 412) {
+            throw new Error('Settings were changed by someone else in the meantime. Preview the import again.');
+        }
+        const result = await resp.json();
+        if (!resp.ok) {
+            const fields = (result.fields || []).map(f => `${f.field}: ${f.message}`);
+            throw new Error(fields.length ? 'Invalid settings:\n' + fields.join('\n') : result.error || 'Failed to import settings');
+        }
+        return result;
+    },
     async getShareHistory() {
         const resp = await fetch(`${API_BASE}/history`);
         if (!resp.ok) {
@@ -200,11 +407,14 @@ function renderMain() {
                 </div>
                 <div class="header-buttons">
                     <button class="icon-btn" id="historyBtn" title="History"><i class="fas fa-history"></i></button>
+                    <button class="icon-btn" id="approvalsBtn" title="Approvals"><i class="fas fa-user-check"></i></button>
                     ${isAdmin ? '<button class="icon-btn" id="settingsBtn" title="Settings"><i class="fas fa-gear"></i></button>' : ''}
                     <button class="icon-btn" id="logoutBtn" title="Logout"><i class="fas fa-sign-out-alt"></i></button>
                 </div>
             </header>
 
+            <div id="categoryBanner" style="display: none; padding: 8px 12px; margin-bottom: 10px; border-radius: 6px; color: var(--accent-warning); border: 1px solid var(--accent-warning);"></div>
+
             <div class="content-area">
                 <div class="drop-zone" id="dropZone">
                     <i class="fas fa-cloud-upload-alt drop-icon"></i>
@@ -225,6 +435,11 @@ function renderMain() {
                     <div class="option-row">
                         <label><input type="checkbox" id="passwordCheck" disabled> Password:</label>
                         <input type="password" class="input" id="passwordInput" placeholder="Enter password" disabled style="flex: 1;">
+                        <select class="select" id="passwordModeSelect" title="Type a password or generate one" disabled>
+                            <option value="">Type</option>
+                            <option value="characters">Generate</option>
+                            <option value="words">Passphrase</option>
+                        </select>
                     </div>
                     <div class="option-row">
                         <label>Expiry:</label>
@@ -237,6 +452,22 @@ function renderMain() {
                         </select>
                         <input type="date" class="input" id="customDate" style="display: none;" disabled>
                     </div>
+                    <div class="option-row">
+                        <label>Email to:</label>
+                        <input type="text" class="input" id="recipientsInput" placeholder="Optional, comma separated" disabled style="flex: 1;">
+                    </div>
+                    <div class="option-row" id="emailOptionsRow" style="display: none;">
+                        <input type="text" class="input" id="messageInput" placeholder="Message (optional)" style="flex: 1;">
+                        <label><input type="checkbox" id="sendPasswordCheck"> Email password</label>
+                    </div>
+                    <div class="option-row" id="shareCategoryRow" style="display: none;">
+                        <label>Category:</label>
+                        <select class="select" id="shareCategorySelect" style="flex: 1;"><option value="0">Automatic</option></select>
+                    </div>
+                    ${isAdmin ? '' : `<div class="option-row">
+                        <label>Notify me:</label>
+                        <input type="text" class="input" id="notifyInput" placeholder="Your email, if the share needs approval" style="flex: 1;">
+                    </div>`}
                 </div>
 
                 <button class="btn btn-primary share-btn" id="shareBtn" disabled>
@@ -254,14 +485,85 @@ function renderMain() {
 
     setupEventListeners();
     setupFileDrawer();
+    loadShareCategories();
+    applyShareRestrictions();
+    if (isAdmin) checkCategoryStatus();
+}
+
+// Limit the share options to the share policy of the chosen category, and preselect its default expiry
+async function applyShareRestrictions() {
+    const categoryNo = parseInt(document.getElementById('shareCategorySelect')?.value) || 0;
+    try {
+        appState.sharePolicy = await API.getSharePolicy(categoryNo);
+    } catch (err) { console.error(err); return; }
+    const policy = appState.sharePolicy;
+    const maxDays = policy.max_expiry_days || 0;
+    const days = [7, 30, 90];
+    if (policy.default_expiry_days && !days.includes(policy.default_expiry_days)) {
+        days.push(policy.default_expiry_days);
+        days.sort((a, b) => a - b);
+    }
+
+    const expirySelect = document.getElementById('expirySelect');
+    if (!expirySelect) return;
+    const previous = expirySelect.value;
+    expirySelect.innerHTML = `
+        ${policy.require_expiry ? '' : '<option value="never">Never</option>'}
+        ${days.filter(d => !maxDays || d <= maxDays).map(d => `<option value="${d}">${d} days</option>`).join('')}
+        <option value="custom">Custom</option>
+    `;
+    if (policy.default_expiry_days) {
+        expirySelect.value = String(policy.default_expiry_days);
+    } else if ([...expirySelect.options].some(o => o.value === previous)) {
+        expirySelect.value = previous;
+    }
+    expirySelect.dispatchEvent(new Event('change'));
+
+    const customDate = document.getElementById('customDate');
+    customDate.min = new Date().toISOString().slice(0, 10);
+    if (maxDays > 0) {
+        const latest = new Date();
+        latest.setDate(latest.getDate() + maxDays);
+        customDate.max = latest.toISOString().slice(0, 10);
+    } else {
+        customDate.removeAttribute('max');
+    }
+    updateFileList();
+}
+
+// Warn admins when the configured category was deleted or renamed in Therefore
+async function checkCategoryStatus() {
+    try {
+        const { status } = await API.getCategoryStatus();
+        const banner = document.getElementById('categoryBanner');
+        if (!banner || !status.categoryNo || (status.exists && !status.renamed)) return;
+        banner.innerHTML = `<i class="fas fa-triangle-exclamation"></i> ${status.message}`;
+        banner.style.display = 'block';
+    } catch (err) { console.error(err); }
+}
+
+// Offer the categories users may choose when sharing, if any are configured
+async function loadShareCategories() {
+    try {
+        const categories = await API.getCategoryChoices();
+        const select = document.getElementById('shareCategorySelect');
+        if (!categories.length || !select) return;
+        select.innerHTML += categories.map(c => `<option value="${c.objNo}">${c.caption}</option>`).join('');
+        document.getElementById('shareCategoryRow').style.display = 'flex';
+    } catch (err) { console.error(err); }
 }
 
 // ==================== Settings Screen ====================
 async function openSettings() {
     let config = null;
+    let status = {};
     try {
-        config = await API.getConfig();
+        [config, status] = await Promise.all([API.getConfig(), API.getStatus()]);
     } catch (err) { alert(err.message); renderMain(); return; }
+    const overridden = status.overriddenSettings || [];
+    const configNotice = status.configReadOnly
+        ? 'The configuration is read-only. It is managed through the environment or the config file.'
+        : overridden.length ? `Set by the environment or command line, changes here have no effect: ${overridden.join(', ')}` : '';
     
     appElement.innerHTML = `
         <div class="main-container">
@@ -271,6 +573,7 @@ async function openSettings() {
             </header>
             
             <div class="settings-form">
+                ${configNotice ? `<div style="padding: 8px 12px; margin-bottom: 10px; border-radius: 6px; color: var(--accent-warning); border: 1px solid var(--accent-warning);"><i class="fas fa-lock"></i> ${configNotice}</div>` : ''}
                 <div class="form-group">
                     <label>Change Admin Password</label>
                     <input type="password" class="input" id="newAdminPassword" placeholder="Leave blank to keep current">
@@ -304,9 +607,79 @@ async function openSettings() {
                         <select class="select" id="categorySelect" style="flex: 1;"><option value="${config.category_no || ''}">${config.category_name || 'Select...'}</option></select>
                         <button class="btn btn-secondary" id="loadCategoriesBtn">Load</button>
                     </div>
+                    <input type="text" class="input" id="categorySearch" placeholder="Search categories..." style="margin-top: 5px;">
                 </div>
 
-                <button class="btn btn-primary" id="saveSettingsBtn" style="width: 100%;">Save All Settings</button>
+                <hr style="margin: 20px 0; opacity: 0.2;">
+                <div class="form-group">
+                    <label>Email (SMTP) Server</label>
+                    <div class="category-row">
+                        <input type="text" class="input" id="smtpHost" placeholder="smtp.example.com" value="${config.smtp_host || ''}" style="flex: 1;">
+                        <input type="number" class="input" id="smtpPort" placeholder="587" value="${config.smtp_port || ''}" style="width: 80px;">
+                    </div>
+                    <select class="select" id="smtpSecurity" style="margin-top: 5px;">
+                        <option value="starttls" ${(config.smtp_security || 'starttls') === 'starttls' ? 'selected' : ''}>STARTTLS</option>
+                        <option value="tls" ${config.smtp_security === 'tls' ? 'selected' : ''}>TLS</option>
+                        <option value="none" ${config.smtp_security === 'none' ? 'selected' : ''}>None</option>
+                    </select>
+                    <input type="text" class="input" id="smtpFrom" placeholder="Sender address" value="${config.smtp_from || ''}" style="margin-top: 5px;">
+                    <input type="text" class="input" id="smtpUsername" placeholder="SMTP username (optional)" value="${config.smtp_username || ''}" style="margin-top: 5px;">
+                    <input type="password" class="input" id="smtpPassword" placeholder="SMTP password (leave blank to keep current)" style="margin-top: 5px;">
+                    <button class="btn btn-secondary" id="testEmailBtn" style="width: 100%; margin-top: 5px;">Send Test Email</button>
+                </div>
+
+                <hr style="margin: 20px 0; opacity: 0.2;">
+                <div class="form-group">
+                    <label>Webhooks</label>
+                    <textarea class="input" id="webhooks" rows="4" placeholder='[{"url": "https://example.com/hook", "secret": "...", "events": ["share.created"], "enabled": true}]'>${config.webhooks ? JSON.stringify(config.webhooks, null, 2) : ''}</textarea>
+                    <button class="btn btn-secondary" id="webhookLogBtn" style="width: 100%; margin-top: 5px;">View Webhook Deliveries</button>
+                </div>
+                <div class="form-group">
+                    <label>Rate Limits &amp; Quotas</label>
+                    <textarea class="input" id="limits" rows="4" placeholder='{"share_per_user": {"requests": 20, "window_seconds": 3600}, "max_file_bytes": 104857600, "quotas": {"*": {"daily_bytes": 1073741824}}}'>${config.limits ? JSON.stringify(config.limits, null, 2) : ''}</textarea>
+                    <button class="btn btn-secondary" id="usageBtn" style="width: 100%; margin-top: 5px;">View Current Usage</button>
+                    <button class="btn btn-secondary" id="orphansBtn" style="width: 100%; margin-top: 5px;">View Orphaned Uploads</button>
+                </div>
+                <div class="form-group">
+                    <label>Data-Loss-Prevention Rules</label>
+                    <textarea class="input" id="dlpRules" rows="4" placeholder='[{"name": "Card numbers", "action": "block", "detectors": ["credit_card"]}, {"name": "Confidential", "action": "require_protection", "filename_patterns": ["*confidential*"], "max_expiry_days": 7}]'>${config.dlp_rules ? JSON.stringify(config.dlp_rules, null, 2) : ''}</textarea>
+                </div>
+                <div class="form-group">
+                    <label>Share Policies</label>
+                    <textarea class="input" id="sharePolicies" rows="4" placeholder='[{"name": "Finance", "categories": [12], "require_password": true, "min_password_length": 12, "min_password_classes": 3, "max_expiry_days": 30, "default_expiry_days": 7}, {"name": "Partners", "roles": ["api:partner-sync"], "require_expiry": true}]'>${config.share_policies ? JSON.stringify(config.share_policies, null, 2) : ''}</textarea>
+                </div>
+                <div class="form-group">
+                    <label>Category Routing Rules</label>
+                    <textarea class="input" id="routingRules" rows="4" placeholder='[{"name": "Invoices", "category_no": 12, "extensions": [".pdf"]}, {"name": "Partners", "category_no": 14, "users": ["api:partner-sync"]}]'>${config.routing_rules ? JSON.stringify(config.routing_rules, null, 2) : ''}</textarea>
+                    <input type="text" class="input" id="allowedCategories" placeholder="Categories users may choose, comma separated numbers" value="${(config.allowed_categories || []).join(', ')}" style="margin-top: 5px;">
+                    <button class="btn btn-secondary" id="checkRoutingBtn" style="width: 100%; margin-top: 5px;">Check Routing Categories</button>
+                </div>
+                <div class="form-group">
+                    <label>Share Approval</label>
+                    <input type="text" class="input" id="approvalCategories" placeholder="Category numbers requiring approval, comma separated" value="${(config.approval_categories || []).join(', ')}">
+                    <div class="category-row" style="margin-top: 5px;">
+                        <input type="text" class="input" id="approvalNotify" placeholder="Admin emails to notify" value="${(config.approval_notify || []).join(', ')}" style="flex: 1;">
+                        <input type="number" class="input" id="approvalExpiry" placeholder="Expire (h)" value="${config.approval_expiry_hours || ''}" style="width: 100px;">
+                    </div>
+                </div>
+                <div class="form-group">
+                    <label>Virus Scanning (ClamAV)</label>
+                    <div class="category-row">
+                        <input type="text" class="input" id="scanAddress" placeholder="tcp://localhost:3310 or unix:///run/clamd.sock" value="${config.virus_scan?.address || ''}" style="flex: 1;">
+                        <select class="select" id="scanAction" style="width: 120px;">
+                            <option value="">Off</option>
+                            <option value="reject" ${config.virus_scan?.enabled && (config.virus_scan.action || 'reject') === 'reject' ? 'selected' : ''}>Reject</option>
+                            <option value="quarantine" ${config.virus_scan?.enabled && config.virus_scan.action === 'quarantine' ? 'selected' : ''}>Quarantine</option>
+                            <option value="warn" ${config.virus_scan?.enabled && config.virus_scan.action === 'warn' ? 'selected' : ''}>Warn</option>
+                        </select>
+                    </div>
+                </div>
+                <div class="form-group">
+                    <button class="btn btn-secondary" id="apiKeysBtn" style="width: 100%;">Manage API Keys</button>
+                    <button class="btn btn-secondary" id="settingsBundleBtn" style="width: 100%; margin-top: 5px;">Export / Import Settings</button>
+                </div>
+
+                <button class="btn btn-primary" id="saveSettingsBtn" style="width: 100%;" ${status.configReadOnly ? 'disabled' : ''}>Save All Settings</button>
             </div>
         </div>
     `;
@@ -337,12 +710,46 @@ async function openSettings() {
         } catch (err) { alert(err.message); }
     });
 
+    let searchTimer;
+    document.getElementById('categorySearch').addEventListener('input', (e) => {
+        clearTimeout(searchTimer);
+        searchTimer = setTimeout(async () => {
+            try {
+                const { results } = await API.searchCategories(e.target.value);
+                const select = document.getElementById('categorySelect');
+                select.innerHTML = results.map(c => `<option value="${c.objNo}">${c.caption}</option>`).join('');
+            } catch (err) { console.error(err); }
+        }, 250);
+    });
+
+    document.getElementById('testEmailBtn').addEventListener('click', async () => {
+        const to = document.getElementById('smtpFrom').value;
+        try {
+            await API.sendTestEmail(to);
+            alert(`Test email sent to ${to}`);
+        } catch (err) { alert(err.message); }
+    });
+
+    document.getElementById('checkRoutingBtn').addEventListener('click', async () => {
+        try {
+            const { problems } = await API.validateRouting();
+            alert(problems.length ? problems.join('\n') : 'All routing categories exist.');
+        } catch (err) { alert(err.message); }
+    });
+
+    document.getElementById('webhookLogBtn').addEventListener('click', renderWebhookDeliveries);
+    document.getElementById('apiKeysBtn').addEventListener('click', renderApiKeys);
+    document.getElementById('settingsBundleBtn').addEventListener('click', () => renderSettingsBundle(status.configReadOnly));
+    document.getElementById('usageBtn').addEventListener('click', renderUsage);
+    document.getElementById('orphansBtn').addEventListener('click', renderOrphans);
+
     document.getElementById('saveSettingsBtn').addEventListener('click', async () => {
         const authType = document.querySelector('.auth-tab.active').dataset.type;
         const catSelect = document.getElementById('categorySelect');
         const newAdminPwd = document.getElementById('newAdminPassword').value;
 
         const payload = {
+            ...config,
             base_url: document.getElementById('baseURL').value,
             tenant_name: document.getElementById('tenantName').value,
             auth_type: authType,
@@ -350,13 +757,69 @@ async function openSettings() {
             category_name: catSelect.options[catSelect.selectedIndex]?.text || '',
             user_password: document.getElementById('userPassword').value,
             is_set_up: true,
-            default_archive: 'Archive'
+            default_archive: config.default_archive || 'Archive',
+            smtp_host: document.getElementById('smtpHost').value,
+            smtp_port: parseInt(document.getElementById('smtpPort').value) || 0,
+            smtp_security: document.getElementById('smtpSecurity').value,
+            smtp_username: document.getElementById('smtpUsername').value,
+            smtp_password: document.getElementById('smtpPassword').value,
+            smtp_from: document.getElementById('smtpFrom').value,
+            allowed_categories: document.getElementById('allowedCategories').value.split(',').map(v => parseInt(v)).filter(n => n > 0),
+            approval_categories: document.getElementById('approvalCategories').value.split(',').map(v => parseInt(v)).filter(n => n > 0),
+            approval_notify: document.getElementById('approvalNotify').value.split(',').map(v => v.trim()).filter(Boolean),
+            approval_expiry_hours: parseInt(document.getElementById('approvalExpiry').value) || 0,
+            virus_scan: {
+                ...config.virus_scan,
+                enabled: document.getElementById('scanAction').value !== '',
+                address: document.getElementById('scanAddress').value,
+                action: document.getElementById('scanAction').value || config.virus_scan?.action || ''
+            }
         };
 
         if (newAdminPwd) {
             payload.new_admin_password = newAdminPwd;
         }
 
+        const limitsText = document.getElementById('limits').value.trim();
+        try {
+            payload.limits = limitsText ? JSON.parse(limitsText) : {};
+        } catch (err) {
+            alert('Rate limits must be valid JSON: ' + err.message);
+            return;
+        }
+
+        const routingText = document.getElementById('routingRules').value.trim();
+        try {
+            payload.routing_rules = routingText ? JSON.parse(routingText) : [];
+        } catch (err) {
+            alert('Routing rules must be valid JSON: ' + err.message);
+            return;
+        }
+
+        const dlpText = document.getElementById('dlpRules').value.trim();
+        try {
+            payload.dlp_rules = dlpText ? JSON.parse(dlpText) : [];
+        } catch (err) {
+            alert('DLP rules must be valid JSON: ' + err.message);
+            return;
+        }
+
+        const sharePoliciesText = document.getElementById('sharePolicies').value.trim();
+        try {
+            payload.share_policies = sharePoliciesText ? JSON.parse(sharePoliciesText) : [];
+        } catch (err) {
+            alert('Share policies must be valid JSON: ' + err.message);
+            return;
+        }
+
+        const webhooksText = document.getElementById('webhooks').value.trim();
+        try {
+            payload.webhooks = webhooksText ? JSON.parse(webhooksText) : [];
+        } catch (err) {
+            alert('Webhooks must be valid JSON: ' + err.message);
+            return;
+        }
+
         try {
             await API.saveConfig(payload);
             const username = document.getElementById('username').value;
@@ -371,6 +834,184 @@ async function openSettings() {
     });
 }
 
+// ==================== Webhook Deliveries Screen ====================
+async function renderWebhookDeliveries() {
+    appElement.innerHTML = `<div class="main-container"><header class="app-header"><h1>Webhook Deliveries</h1><button class="icon-btn" id="backBtn"><i class="fas fa-arrow-left"></i></button></header><div class="history-list" id="deliveryList">Loading...</div></div>`;
+    document.getElementById('backBtn').addEventListener('click', openSettings);
+    const list = document.getElementById('deliveryList');
+    try {
+        const { log, pending } = await API.getWebhookDeliveries();
+        const pendingHtml = pending.map(d => `<div class="history-item"><div><strong>${d.event}</strong> <small>pending</small><br><small>${d.url} • attempt ${d.attempts + 1} at ${new Date(d.nextAttempt).toLocaleString()}</small></div></div>`).join('');
+        const logHtml = log.map(e => `<div class="history-item"><div><strong>${e.event}</strong> <small>${e.success ? 'delivered' : (e.gaveUp ? 'gave up' : 'failed')}</small><br><small>${e.url} • attempt ${e.attempt} • ${new Date(e.time).toLocaleString()}${e.error ? ' • ' + e.error : ''}</small></div></div>`).join('');
+        list.innerHTML = pendingHtml + logHtml || '<p>No webhook deliveries yet.</p>';
+    } catch (err) { list.innerHTML = `<p>${err.message}</p>`; }
+}
+
+// ==================== Usage Screen ====================
+async function renderUsage() {
+    appElement.innerHTML = `<div class="main-container"><header class="app-header"><h1>Usage</h1><button class="icon-btn" id="backBtn"><i class="fas fa-arrow-left"></i></button></header><div class="history-list" id="usageList">Loading...</div></div>`;
+    document.getElementById('backBtn').addEventListener('click', openSettings);
+    const list = document.getElementById('usageList');
+    const quotaText = (used, limit) => limit ? `${formatFileSize(used)} / ${formatFileSize(limit)}` : formatFileSize(used);
+    try {
+        const { uploads, rateLimits } = await API.getUsage();
+        const uploadHtml = Object.entries(uploads).map(([user, u]) => `<div class="history-item"><div><strong>${user}</strong><br><small>Today: ${quotaText(u.dayBytes, u.quota.daily_bytes)} • This month: ${quotaText(u.monthBytes, u.quota.monthly_bytes)}</small></div></div>`).join('');
+        const rateHtml = Object.entries(rateLimits).map(([name, counts]) => Object.entries(counts).map(([key, n]) => `<div class="history-item"><div><strong>${key}</strong><br><small>${name}: ${n} in current window</small></div></div>`).join('')).join('');
+        list.innerHTML = (uploadHtml + rateHtml) || '<p>No usage recorded yet.</p>';
+    } catch (err) { list.innerHTML = `<p>${err.message}</p>`; }
+}
+
+// ==================== Orphaned Uploads Screen ====================
+async function renderOrphans() {
+    appElement.innerHTML = `<div class="main-container"><header class="app-header"><h1>Orphaned Uploads</h1><button class="icon-btn" id="backBtn"><i class="fas fa-arrow-left"></i></button></header><div class="history-list" id="orphanList">Loading...</div></div>`;
+    document.getElementById('backBtn').addEventListener('click', openSettings);
+    const list = document.getElementById('orphanList');
+    try {
+        const { orphans } = await API.getOrphans();
+        list.innerHTML = orphans.map(o => {
+            const doc = o.docNo ? `Document ${o.docNo}` : 'Document number unknown';
+            const deleteBtn = o.docNo ? `<button class="btn btn-small btn-danger" onclick="window.dismissOrphan('${o.id}', true)" title="Delete document"><i class="fas fa-trash"></i></button>` : '';
+            return `<div class="history-item"><div><strong>${o.filename}</strong> <small>${doc}</small><br><small>${o.sharedBy} • ${new Date(o.startedAt).toLocaleString()} • ${o.reason}</small></div><div>${deleteBtn}<button class="btn btn-small" onclick="window.dismissOrphan('${o.id}', false)" title="Dismiss"><i class="fas fa-check"></i></button></div></div>`;
+        }).join('') || '<p>No orphaned uploads.</p>';
+    } catch (err) { list.innerHTML = `<p>${err.message}</p>`; }
+}
+
+window.dismissOrphan = async (id, deleteDocument) => {
+    if (deleteDocument && !confirm('Delete this document from Therefore?')) return;
+    try { await API.dismissOrphan(id, deleteDocument); renderOrphans(); } catch (err) { alert(err.message); }
+};
+
+// ==================== API Keys Screen ====================
+async function renderApiKeys() {
+    appElement.innerHTML = `
+        <div class="main-container">
+            <header class="app-header"><h1>API Keys</h1><button class="icon-btn" id="backBtn"><i class="fas fa-arrow-left"></i></button></header>
+            <div class="settings-form">
+                <div class="form-group">
+                    <label>New Key</label>
+                    <input type="text" class="input" id="keyName" placeholder="Name, e.g. CI pipeline">
+                    <div style="margin: 5px 0;">
+                        ${['share', 'history', 'revoke', 'admin'].map(s => `<label style="margin-right: 10px;"><input type="checkbox" class="key-scope" value="${s}"> ${s}</label>`).join('')}
+                    </div>
+                    <input type="number" class="input" id="keyCategory" placeholder="Restrict to category number (optional)" style="margin-bottom: 5px;">
+                    <input type="date" class="input" id="keyExpiry" style="margin-bottom: 5px;">
+                    <button class="btn btn-primary" id="createKeyBtn" style="width: 100%;">Create Key</button>
+                </div>
+            </div>
+            <div class="history-list" id="keyList">Loading...</div>
+        </div>
+    `;
+    document.getElementById('backBtn').addEventListener('click', openSettings);
+    document.getElementById('createKeyBtn').addEventListener('click', async () => {
+        const expiry = document.getElementById('keyExpiry').value;
+        try {
+            const resp = await API.createApiKey({
+                name: document.getElementById('keyName').value,
+                scopes: [...document.querySelectorAll('.key-scope:checked')].map(cb => cb.value),
+                categoryNo: parseInt(document.getElementById('keyCategory').value) || 0,
+                expiresAt: expiry ? new Date(expiry).toISOString().replace(/\.\d{3}Z$/, 'Z') : ''
+            });
+            prompt('Copy this key now - it will not be shown again:', resp.key);
+            renderApiKeys();
+        } catch (err) { alert(err.message); }
+    });
+
+    const list = document.getElementById('keyList');
+    try {
+        const keys = await API.getApiKeys();
+        list.innerHTML = keys.map(k => `<div class="history-item"><div><strong>${k.name}</strong> <small>…${k.hint}</small><br><small>${k.scopes.join(', ')}${k.categoryNo ? ' • category ' + k.categoryNo : ''}${k.expiresAt ? ' • expires ' + new Date(k.expiresAt).toLocaleDateString() : ''} • last used ${k.lastUsedAt ? new Date(k.lastUsedAt).toLocaleString() : 'never'}</small></div><button class="btn btn-small btn-danger" onclick="window.deleteApiKey('${k.id}')"><i class="fas fa-trash"></i></button></div>`).join('') || '<p>No API keys.</p>';
+    } catch (err) { list.innerHTML = `<p>${err.message}</p>`; }
+}
+
+window.deleteApiKey = async (id) => {
+    if (!confirm('Delete this API key? Clients using it will stop working.')) return;
+    try { await API.deleteApiKey(id); renderApiKeys(); } catch (err) { alert(err.message); }
+};
+
+// ==================== Settings Bundle Screen ====================
+function renderSettingsBundle(readOnly) {
+    const escape = (s) => String(s ?? '').replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' })[c]);
+    appElement.innerHTML = `
+        <div class="main-container">
+            <header class="app-header"><h1>Settings Bundle</h1><button class="icon-btn" id="backBtn"><i class="fas fa-arrow-left"></i></button></header>
+            <div class="settings-form">
+                <div class="form-group">
+                    <label>Passphrase</label>
+                    <input type="password" class="input" id="bundlePassphrase" placeholder="Protects the credentials, leave blank to leave them out">
+                    <button class="btn btn-primary" id="exportBtn" style="width: 100%; margin-top: 5px;">Export Settings</button>
+                </div>
+                <hr style="margin: 20px 0; opacity: 0.2;">
+                <div class="form-group">
+                    <label>Import</label>
+                    <input type="file" class="input" id="bundleFile" accept=".json,application/json">
+                    <select class="select" id="bundleProfile" style="margin-top: 5px; display: none;"></select>
+                    <button class="btn btn-secondary" id="previewBtn" style="width: 100%; margin-top: 5px;">Preview Import</button>
+                </div>
+            </div>
+            <div class="history-list" id="importPreview"></div>
+        </div>
+    `;
+    document.getElementById('backBtn').addEventListener('click', openSettings);
+
+    document.getElementById('exportBtn').addEventListener('click', async () => {
+        try {
+            const blob = await API.exportSettings(document.getElementById('bundlePassphrase').value);
+            const link = document.createElement('a');
+            link.href = URL.createObjectURL(blob);
+            link.download = 'ThereforeSharer-settings.json';
+            link.click();
+            URL.revokeObjectURL(link.href);
+        } catch (err) { alert(err.message); }
+    });
+
+    const importRequest = async () => {
+        const file = document.getElementById('bundleFile').files[0];
+        if (!file) throw new Error('Choose a settings bundle first');
+        let bundle;
+        try {
+            bundle = JSON.parse(await file.text());
+        } catch (err) {
+            throw new Error('The file is not a settings bundle: ' + err.message);
+        }
+        return {
+            bundle,
+            passphrase: document.getElementById('bundlePassphrase').value,
+            profile: document.getElementById('bundleProfile').value
+        };
+    };
+
+    const preview = async () => {
+        const target = document.getElementById('importPreview');
+        try {
+            const req = await importRequest();
+            const result = await API.importSettings(req, true);
+            const profiles = document.getElementById('bundleProfile');
+            if (result.profiles.length) {
+                profiles.innerHTML = `<option value="">No profile</option>` + result.profiles.map(p => `<option value="${escape(p)}" ${p === req.profile ? 'selected' : ''}>${escape(p)}</option>`).join('');
+                profiles.style.display = '';
+            }
+            target.innerHTML = `
+                <p>Exported from the ${escape(result.app)} app${result.exportedAt ? ' on ' + new Date(result.exportedAt).toLocaleString() : ''}.</p>
+                ${result.hasCredentials && !result.credentialsApplied ? '<p>The bundle contains credentials. Enter its passphrase to import them, otherwise the current credentials are kept.</p>' : ''}
+                ${result.changes.map(c => `<div class="history-item"><div><strong>${escape(c.field)}</strong><br><small>${escape(c.from) || '<em>empty</em>'} &rarr; ${escape(c.to) || '<em>empty</em>'}</small></div></div>`).join('') || '<p>Nothing would change.</p>'}
+                ${result.errors.map(e => `<p style="color: var(--accent-danger);">${escape(e.field)}: ${escape(e.message)}</p>`).join('')}
+                <button class="btn btn-primary" id="importBtn" style="width: 100%;" ${readOnly || result.errors.length || !result.changes.length ? 'disabled' : ''}>Import</button>
+            `;
+            document.getElementById('importBtn').addEventListener('click', async () => {
+                if (!confirm(`Apply ${result.changes.length} change(s) to the settings?`)) return;
+                try {
+                    await API.importSettings(req, false);
+                    alert('Settings imported!');
+                    location.reload();
+                } catch (err) { alert(err.message); }
+            });
+        } catch (err) { target.innerHTML = `<p>${escape(err.message)}</p>`; }
+    };
+
+    document.getElementById('previewBtn').addEventListener('click', preview);
+    document.getElementById('bundleProfile').addEventListener('change', preview);
+}
+
 // ==================== History Screen ====================
 async function renderHistory() {
     appElement.innerHTML = `<div class="main-container"><header class="app-header"><h1>History</h1><button class="icon-btn" id="backBtn"><i class="fas fa-arrow-left"></i></button></header><div class="history-list" id="historyList">Loading...</div></div>`;
@@ -380,15 +1021,107 @@ async function renderHistory() {
         const entries = await API.getShareHistory();
         list.innerHTML = entries.map(e => {
             const link = e.SharedLink || e;
-            return `<div class="history-item"><div><strong>${link.Filename}</strong><br><small>${e.CategoryName || 'Doc #'+link.DocNo}</small></div><button class="btn btn-small" onclick="navigator.clipboard.writeText('${link.LinkUrl}'); alert('Copied!')"><i class="fas fa-copy"></i></button></div>`;
+            const downloadBtn = appState.role === 'admin' ? `<a class="btn btn-small" href="${API_BASE}/documents/${link.DocNo}/download" title="Download"><i class="fas fa-download"></i></a><button class="btn btn-small" onclick="window.verifyDocument(${link.DocNo})" title="Verify"><i class="fas fa-shield-alt"></i></button><button class="btn btn-small" onclick="window.revokeLink('${link.LinkId}')" title="Revoke Link"><i class="fas fa-ban"></i></button><button class="btn btn-small btn-danger" onclick="window.deleteDocument(${link.DocNo})" title="Delete Document"><i class="fas fa-trash"></i></button>` : '';
+            const lock = link.IsPasswordProtected ? `<i class="fas fa-lock" title="${e.passwordGenerated ? 'Generated password' : 'Password protected'}"></i> ` : '';
+            return `<div class="history-item"><div><strong>${lock}${link.Filename}</strong><br><small>${e.CategoryName || 'Doc #'+link.DocNo}</small></div><div><button class="btn btn-small" onclick="navigator.clipboard.writeText('${link.LinkUrl}'); alert('Copied!')"><i class="fas fa-copy"></i></button><button class="btn btn-small" onclick="window.showQRCode('${link.LinkId}')" title="QR Code"><i class="fas fa-qrcode"></i></button>${downloadBtn}</div></div>`;
         }).join('');
     } catch (err) { list.innerHTML = `<p>${err.message}</p>`; }
 }
 
+// Shows a shared link as a QR code, for handing it over in person or printing it
+window.showQRCode = (linkId) => {
+    const qrURL = (format, level, download) => `${API_BASE}/links/${encodeURIComponent(linkId)}/qr?format=${format}&size=512&level=${level}${download ? '&download=true' : ''}`;
+    const dialog = document.createElement('div');
+    dialog.className = 'share-dialog';
+    dialog.innerHTML = `
+        <div class="dialog-content">
+            <h3><i class="fas fa-qrcode"></i> QR Code</h3>
+            <img id="qrImage" alt="QR code of the shared link" style="width: 256px; height: 256px; margin: 10px auto; display: block; background: #fff;">
+            <div class="option-row" style="justify-content: center;">
+                <label>Error correction:</label>
+                <select class="select" id="qrLevelSelect" title="Higher levels still scan when the code is damaged or partly covered">
+                    <option value="L">Low</option>
+                    <option value="M" selected>Medium</option>
+                    <option value="Q">Quartile</option>
+                    <option value="H">High</option>
+                </select>
+            </div>
+            <div style="display: flex; gap: 10px; margin-top: 10px;">
+                <a class="btn btn-secondary" id="qrPngLink" style="flex: 1;"><i class="fas fa-download"></i> PNG</a>
+                <a class="btn btn-secondary" id="qrSvgLink" style="flex: 1;"><i class="fas fa-download"></i> SVG</a>
+                <button class="btn btn-primary" id="qrCloseBtn" style="flex: 1;">Close</button>
+            </div>
+        </div>
+    `;
+    document.body.appendChild(dialog);
+
+    const levelSelect = dialog.querySelector('#qrLevelSelect');
+    const update = () => {
+        const image = dialog.querySelector('#qrImage');
+        image.onerror = () => { dialog.remove(); alert('The QR code could not be created for this link.'); };
+        image.src = qrURL('svg', levelSelect.value, false);
+        dialog.querySelector('#qrPngLink').href = qrURL('png', levelSelect.value, true);
+        dialog.querySelector('#qrSvgLink').href = qrURL('svg', levelSelect.value, true);
+    };
+    levelSelect.addEventListener('change', update);
+    dialog.querySelector('#qrCloseBtn').addEventListener('click', () => dialog.remove());
+    dialog.addEventListener('click', (e) => { if (e.target === dialog) dialog.remove(); });
+    update();
+};
+
+window.revokeLink = async (linkId) => {
+    if (!confirm('Are you sure you want to revoke this shared link?')) return;
+    try { await API.revokeLink(linkId); renderHistory(); } catch (err) { alert(err.message); }
+};
+
+window.deleteDocument = async (docNo) => {
+    if (!confirm('Are you sure you want to delete this document? This cannot be undone.')) return;
+    try { await API.deleteDocument(docNo); renderHistory(); } catch (err) { alert(err.message); }
+};
+
+window.verifyDocument = async (docNo) => {
+    try {
+        const result = await API.verifyDocument(docNo);
+        if (!result.hasRecord) alert('No hash was recorded for this document - it cannot be verified.');
+        else if (result.verified) alert(`Verified: content matches what was shared.\nSHA-256: ${result.sha256}`);
+        else alert(`WARNING: content has changed since it was shared.\nRecorded: ${result.recordedSha256}\nCurrent: ${result.sha256}`);
+    } catch (err) { alert(err.message); }
+};
+
+// ==================== Approvals Screen ====================
+async function renderApprovals() {
+    const isAdmin = appState.role === 'admin';
+    appElement.innerHTML = `<div class="main-container"><header class="app-header"><h1>${isAdmin ? 'Approvals' : 'My Requests'}</h1><button class="icon-btn" id="backBtn"><i class="fas fa-arrow-left"></i></button></header><div class="history-list" id="approvalList">Loading...</div></div>`;
+    document.getElementById('backBtn').addEventListener('click', renderMain);
+    const list = document.getElementById('approvalList');
+    try {
+        const requests = await API.getApprovals();
+        list.innerHTML = requests.map(a => {
+            let detail = `${a.sharedBy} • ${a.reason}`;
+            if (a.status === 'pending') detail += ` • expires ${new Date(a.staleAt).toLocaleString()}`;
+            if (a.comment) detail += ` • ${a.decidedBy}: ${a.comment}`;
+            let actions = '';
+            if (a.status === 'pending' && isAdmin) {
+                actions = `<button class="btn btn-small" onclick="window.decideApproval('${a.id}', 'approve')" title="Approve"><i class="fas fa-check"></i></button><button class="btn btn-small btn-danger" onclick="window.decideApproval('${a.id}', 'reject')" title="Reject"><i class="fas fa-times"></i></button>`;
+            } else if (a.url) {
+                actions = `<button class="btn btn-small" onclick="navigator.clipboard.writeText('${a.url}'); alert('Copied!')"><i class="fas fa-copy"></i></button>`;
+            }
+            return `<div class="history-item"><div><strong>${a.filename}</strong> <small>${a.status}</small><br><small>${detail}</small></div><div>${actions}</div></div>`;
+        }).join('') || '<p>No approval requests.</p>';
+    } catch (err) { list.innerHTML = `<p>${err.message}</p>`; }
+}
+
+window.decideApproval = async (id, decision) => {
+    const comment = prompt(decision === 'approve' ? 'Comment (optional):' : 'Reason for rejection:');
+    if (comment === null) return;
+    try { await API.decideApproval(id, decision, comment); renderApprovals(); } catch (err) { alert(err.message); }
+};
+
 // ==================== Shared Helpers ====================
 function setupEventListeners() {
     const fileInput = document.getElementById('fileInput');
     document.getElementById('historyBtn').addEventListener('click', renderHistory);
+    document.getElementById('approvalsBtn').addEventListener('click', renderApprovals);
     document.getElementById('logoutBtn').addEventListener('click', () => API.logout());
     if (document.getElementById('settingsBtn')) document.getElementById('settingsBtn').addEventListener('click', openSettings);
     
@@ -400,25 +1133,60 @@ function setupEventListeners() {
     dropZone.addEventListener('dragleave', () => dropZone.classList.remove('drag-over'));
     dropZone.addEventListener('drop', (e) => { e.preventDefault(); dropZone.classList.remove('drag-over'); handleFiles(e.dataTransfer.files); });
 
-    document.getElementById('passwordCheck').addEventListener('change', (e) => document.getElementById('passwordInput').disabled = !e.target.checked);
+    document.getElementById('passwordCheck').addEventListener('change', syncPasswordInputs);
+    document.getElementById('passwordModeSelect').addEventListener('change', syncPasswordInputs);
+    document.getElementById('shareCategorySelect').addEventListener('change', applyShareRestrictions);
     document.getElementById('expirySelect').addEventListener('change', (e) => {
         document.getElementById('customDate').style.display = e.target.value === 'custom' ? 'inline-block' : 'none';
         document.getElementById('customDate').disabled = e.target.value !== 'custom';
     });
+    document.getElementById('recipientsInput').addEventListener('input', (e) => {
+        document.getElementById('emailOptionsRow').style.display = e.target.value.trim() ? 'flex' : 'none';
+    });
     document.getElementById('clearFilesBtn').addEventListener('click', () => { appState.files = []; updateFileList(); });
     document.getElementById('shareBtn').addEventListener('click', async () => {
-        const password = document.getElementById('passwordCheck').checked ? document.getElementById('passwordInput').value : '';
+        const hasPassword = document.getElementById('passwordCheck').checked;
+        const passwordMode = document.getElementById('passwordModeSelect').value;
+        const password = hasPassword && !passwordMode ? document.getElementById('passwordInput').value : '';
         const expirySelect = document.getElementById('expirySelect');
         const expiryDays = expirySelect.value === 'custom' ? -1 : (expirySelect.value === 'never' ? 0 : parseInt(expirySelect.value));
-        const customExpiry = expiryDays === -1 ? new Date(document.getElementById('customDate').value).toISOString() : '';
+        // The date as picked, the server ends the link at the end of that day
+        const customExpiry = expiryDays === -1 ? document.getElementById('customDate').value : '';
         
+        const email = {
+            recipients: document.getElementById('recipientsInput').value,
+            message: document.getElementById('messageInput').value,
+            sendPassword: document.getElementById('sendPasswordCheck').checked,
+            notifyEmail: document.getElementById('notifyInput')?.value || '',
+            categoryNo: parseInt(document.getElementById('shareCategorySelect').value) || 0,
+            generatePassword: hasPassword && passwordMode ? { mode: passwordMode } : null
+        };
+
         const overlay = showUploadOverlay();
         try {
-            const resp = await API.shareFiles(appState.files, password, expiryDays, customExpiry, (percent, loaded, total) => {
+            const resp = await API.shareFiles(appState.files, password, expiryDays, customExpiry, email, (percent, loaded, total) => {
                 updateUploadOverlay(percent, loaded, total);
             });
             overlay.remove();
-            showShareDialog(resp.url);
+            if (resp.status === 'pending') {
+                alert(`This share needs admin approval (${resp.approval.reason}). The link will be created once it is approved - check Approvals for the outcome.`
+                    + (resp.generatedPassword ? `\n\nThe generated link password is shown only this once, keep it for the recipients:\n${resp.generatedPassword}` : ''));
+                return;
+            }
+            showShareDialog(resp.url, resp.generatedPassword, resp.linkId);
+            if (resp.category && resp.category.rule !== 'default category') {
+                alert(`Filed in category ${resp.category.categoryNo} by ${resp.category.rule}`);
+            }
+            if (resp.email && resp.email.status !== 'sent') {
+                alert(`The link was created but could not be emailed: ${resp.email.error}`);
+            }
+            if (resp.dlp && resp.dlp.length) {
+                alert(`Shared under DLP rule ${[...new Set(resp.dlp.map(m => m.rule))].join(', ')}`);
+            }
+            const flagged = (resp.scan || []).filter(r => !r.clean);
+            if (flagged.length) {
+                alert(`Warning: the virus scan flagged ${flagged.map(r => `${r.file} (${r.signature || r.error})`).join(', ')}`);
+            }
         } catch (err) { 
             overlay.remove();
             alert(err.message); 
@@ -436,6 +1204,20 @@ function formatFileSize(bytes) {
     return parseFloat((bytes / Math.pow(k, i)).toFixed(1)) + ' ' + sizes[i];
 }
 
+// The password can be typed only when it is switched on and not generated
+function syncPasswordInputs() {
+    const passwordCheck = document.getElementById('passwordCheck');
+    const passwordInput = document.getElementById('passwordInput');
+    const passwordModeSelect = document.getElementById('passwordModeSelect');
+    if (!passwordCheck || !passwordInput || !passwordModeSelect) return;
+    const enabled = passwordCheck.checked && appState.files.length > 0;
+    const generated = passwordModeSelect.value !== '';
+    passwordModeSelect.disabled = !enabled;
+    passwordInput.disabled = !enabled || generated;
+    passwordInput.placeholder = generated ? 'Generated when shared' : 'Enter password';
+    if (generated) passwordInput.value = '';
+}
+
 function updateFileList() {
     const count = appState.files.length;
     const badge = document.getElementById('fileBadge');
@@ -447,10 +1229,11 @@ function updateFileList() {
     if (count === 0) {
         if (badge) badge.style.visibility = 'hidden';
         if (shareBtn) shareBtn.disabled = true;
-        ['passwordCheck', 'expirySelect'].forEach(id => {
+        ['passwordCheck', 'expirySelect', 'recipientsInput'].forEach(id => {
             const el = document.getElementById(id);
             if (el) el.disabled = true;
         });
+        syncPasswordInputs();
         return;
     }
 
@@ -458,10 +1241,17 @@ function updateFileList() {
     if (badgeCount) badgeCount.textContent = count;
     if (badgeText) badgeText.textContent = `${count} file${count !== 1 ? 's' : ''} selected`;
     if (shareBtn) shareBtn.disabled = false;
-    ['passwordCheck', 'expirySelect'].forEach(id => {
+    ['passwordCheck', 'expirySelect', 'recipientsInput'].forEach(id => {
         const el = document.getElementById(id);
         if (el) el.disabled = false;
     });
+    // A required password can't be switched off
+    const passwordCheck = document.getElementById('passwordCheck');
+    if (passwordCheck && appState.sharePolicy?.require_password) {
+        passwordCheck.checked = true;
+        passwordCheck.disabled = true;
+    }
+    syncPasswordInputs();
 
     if (container) {
         container.innerHTML = appState.files.map((f, i) => `
@@ -505,9 +1295,10 @@ function updateUploadOverlay(percent, loaded, total) {
     if (subtitle && percent === 100) subtitle.textContent = 'Processing at Therefore™...';
 }
 
-function showShareDialog(url) {
+function showShareDialog(url, generatedPassword, linkId) {
     const dialog = document.createElement('div');
     dialog.className = 'share-dialog';
+    // A generated password is shown once, hidden until revealed
     dialog.innerHTML = `
         <div class="dialog-content">
             <div style="color: var(--accent-primary); font-size: 48px; margin-bottom: 16px;">
@@ -520,7 +1311,15 @@ function showShareDialog(url) {
                 <button class="btn btn-secondary" id="copyUrlBtn" style="padding: 0 15px; min-width: 80px;">
                     <i class="fas fa-copy"></i> Copy
                 </button>
+                ${linkId ? `<button class="btn btn-secondary" onclick="window.showQRCode('${linkId}')" title="QR code" style="padding: 0 15px;"><i class="fas fa-qrcode"></i></button>` : ''}
             </div>
+            ${generatedPassword ? `
+            <p>The link password is shown only this once. Send it through a different channel than the link, such as a phone call or a text message:</p>
+            <div class="url-box">
+                <input type="password" id="generatedPassword" readonly>
+                <button class="btn btn-secondary" id="revealPasswordBtn" title="Show password" style="padding: 0 15px;"><i class="fas fa-eye"></i></button>
+                <button class="btn btn-secondary" id="copyPasswordBtn" style="padding: 0 15px; min-width: 80px;"><i class="fas fa-copy"></i> Copy</button>
+            </div>` : ''}
             <button class="btn btn-primary" style="width: 100%; margin-top: 10px;" onclick="location.reload()">
                 Done
             </button>
@@ -535,6 +1334,23 @@ function showShareDialog(url) {
         copyBtn.innerHTML = '<i class="fas fa-check"></i> Copied!';
         setTimeout(() => copyBtn.innerHTML = originalHtml, 2000);
     });
+
+    if (generatedPassword) {
+        const passwordField = document.getElementById('generatedPassword');
+        passwordField.value = generatedPassword;
+        document.getElementById('revealPasswordBtn').addEventListener('click', (e) => {
+            const hidden = passwordField.type === 'password';
+            passwordField.type = hidden ? 'text' : 'password';
+            e.currentTarget.innerHTML = `<i class="fas fa-eye${hidden ? '-slash' : ''}"></i>`;
+        });
+        const copyPasswordBtn = document.getElementById('copyPasswordBtn');
+        copyPasswordBtn.addEventListener('click', () => {
+            navigator.clipboard.writeText(generatedPassword);
+            const originalHtml = copyPasswordBtn.innerHTML;
+            copyPasswordBtn.innerHTML = '<i class="fas fa-check"></i> Copied!';
+            setTimeout(() => copyPasswordBtn.innerHTML = originalHtml, 2000);
+        });
+    }
 }
 
 function setupFileDrawer() {
@@ -1,6 +1,8 @@
 import { defineConfig } from 'vite';
 
 export default defineConfig({
+  // Relative asset URLs, so the build can be served under a base path
+  base: './',
   server: {
     proxy: {
       '/api': {
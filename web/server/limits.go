@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	uploadUsageFileName = "upload_usage.json"
+	defaultQuotaKey     = "*"
+
+	defaultLoginAttempts   = 10
+	defaultLoginWindow     = 15 * 60 // seconds
+	defaultMaxRequestBytes = 2 << 30 // 2 GiB
+
+	rateLimitSweepInterval = 5 * time.Minute
+)
+
+// RateLimit allows a number of requests within a sliding window
+type RateLimit struct {
+	Requests      int `json:"requests"`       // 0 = unlimited
+	WindowSeconds int `json:"window_seconds"` // Length of the window
+}
+
+func (l RateLimit) window() time.Duration {
+	return time.Duration(l.WindowSeconds) * time.Second
+}
+
+// UploadQuota limits the bytes a user or role may upload, 0 = unlimited
+type UploadQuota struct {
+	DailyBytes   int64 `json:"daily_bytes"`
+	MonthlyBytes int64 `json:"monthly_bytes"`
+}
+
+// LimitsConfig holds the rate limits, size limits and upload quotas for the web server
+type LimitsConfig struct {
+	LoginPerIP      RateLimit `json:"login_per_ip"`   // Failed login attempts
+	SharePerIP      RateLimit `json:"share_per_ip"`   // Share requests per client IP
+	SharePerUser    RateLimit `json:"share_per_user"` // Share requests per role or API key
+	MaxRequestBytes int64     `json:"max_request_bytes"`
+	MaxFileBytes    int64     `json:"max_file_bytes"`
+	// Quotas are keyed by user ("admin", "user" or "api:<key name>"), "*" applies to everyone else
+	Quotas map[string]UploadQuota `json:"quotas,omitempty"`
+}
+
+// WithDefaults returns the limits with brute-force protection and a body size cap
+// applied when they haven't been configured
+func (l LimitsConfig) WithDefaults() LimitsConfig {
+	if l.LoginPerIP.Requests == 0 {
+		l.LoginPerIP = RateLimit{Requests: defaultLoginAttempts, WindowSeconds: defaultLoginWindow}
+	}
+	if l.MaxRequestBytes == 0 {
+		l.MaxRequestBytes = defaultMaxRequestBytes
+	}
+	return l
+}
+
+// longestWindow returns the longest window of the rate limits, events older than that
+// no longer count for any of them
+func (l LimitsConfig) longestWindow() time.Duration {
+	return max(l.LoginPerIP.window(), l.SharePerIP.window(), l.SharePerUser.window())
+}
+
+// QuotaFor returns the quota that applies to a user
+func (l LimitsConfig) QuotaFor(user string) UploadQuota {
+	if q, ok := l.Quotas[user]; ok {
+		return q
+	}
+	return l.Quotas[defaultQuotaKey]
+}
+
+// RateLimiter counts events per key in a sliding window
+type RateLimiter struct {
+	mu     sync.Mutex
+	events map[string][]time.Time
+}
+
+// NewRateLimiter creates an empty rate limiter
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{events: make(map[string][]time.Time)}
+}
+
+// Check reports whether another event is allowed for key, and if not how long until it will be
+func (r *RateLimiter) Check(key string, limit RateLimit) (bool, time.Duration) {
+	if limit.Requests <= 0 || limit.WindowSeconds <= 0 {
+		return true, 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := r.prune(key, limit.window())
+	if len(events) < limit.Requests {
+		return true, 0
+	}
+	return false, time.Until(events[0].Add(limit.window()))
+}
+
+// Add records an event for key
+func (r *RateLimiter) Add(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[key] = append(r.events[key], time.Now())
+}
+
+// Allow checks and records an event in one step
+func (r *RateLimiter) Allow(key string, limit RateLimit) (bool, time.Duration) {
+	ok, retry := r.Check(key, limit)
+	if ok && limit.Requests > 0 {
+		r.Add(key)
+	}
+	return ok, retry
+}
+
+// Reset clears the events for key
+func (r *RateLimiter) Reset(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.events, key)
+}
+
+// StartSweeper drops expired events in the background, so the keys of clients that
+// don't come back don't pile up. window returns the longest window in use.
+func (r *RateLimiter) StartSweeper(window func() time.Duration) {
+	go func() {
+		ticker := time.NewTicker(rateLimitSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.Sweep(window())
+		}
+	}()
+}
+
+// Sweep drops the events older than window for every key
+func (r *RateLimiter) Sweep(window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.events {
+		r.prune(key, window)
+	}
+}
+
+// Counts returns the number of events within the window for every key with the given prefix
+func (r *RateLimiter) Counts(prefix string, window time.Duration) map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int)
+	cutoff := time.Now().Add(-window)
+	for key, events := range r.events {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		n := 0
+		for _, t := range events {
+			if !t.Before(cutoff) {
+				n++
+			}
+		}
+		if n > 0 {
+			counts[strings.TrimPrefix(key, prefix)] = n
+		}
+	}
+	return counts
+}
+
+// prune drops events older than window, the caller must hold r.mu
+func (r *RateLimiter) prune(key string, window time.Duration) []time.Time {
+	events := r.events[key]
+	cutoff := time.Now().Add(-window)
+	i := 0
+	for i < len(events) && events[i].Before(cutoff) {
+		i++
+	}
+	events = events[i:]
+	if len(events) == 0 {
+		delete(r.events, key)
+	} else {
+		r.events[key] = events
+	}
+	return events
+}
+
+// UploadUsage is the bytes uploaded by one user in the current day and month
+type UploadUsage struct {
+	Day          string `json:"day"` // 2006-01-02
+	DayBytes     int64  `json:"dayBytes"`
+	Month        string `json:"month"` // 2006-01
+	MonthBytes   int64  `json:"monthBytes"`
+	LastUploadAt string `json:"lastUploadAt,omitempty"`
+}
+
+// current returns the usage rolled over to the current day and month
+func (u UploadUsage) current(now time.Time) UploadUsage {
+	if day := now.Format("2006-01-02"); u.Day != day {
+		u.Day = day
+		u.DayBytes = 0
+	}
+	if month := now.Format("2006-01"); u.Month != month {
+		u.Month = month
+		u.MonthBytes = 0
+	}
+	return u
+}
+
+// UsageTracker persists upload byte counts per user. Uploads in progress hold a
+// reservation of their bytes, so parallel uploads can't together exceed a quota.
+type UsageTracker struct {
+	mu       sync.Mutex
+	usage    map[string]UploadUsage
+	reserved map[string]int64
+}
+
+// NewUsageTracker loads upload usage from disk
+func NewUsageTracker() *UsageTracker {
+	t := &UsageTracker{usage: make(map[string]UploadUsage), reserved: make(map[string]int64)}
+	if err := readJSONFile(filepath.Join(filepath.Dir(GetConfigPath()), uploadUsageFileName), &t.usage); err != nil {
+		slog.Error("Failed to load upload usage", "error", err)
+	}
+	return t
+}
+
+// QuotaError describes an exceeded upload quota
+type QuotaError struct {
+	Period     string // "daily" or "monthly"
+	Limit      int64
+	Used       int64
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s upload quota exceeded: %d of %d bytes used", e.Period, e.Used, e.Limit)
+}
+
+// QuotaReservation holds the bytes of an upload in progress against a user's quota
+// until the upload is recorded or released
+type QuotaReservation struct {
+	t    *UsageTracker
+	user string
+	size int64
+	done bool
+}
+
+// Reserve reserves size bytes of the user's quota for an upload, or returns a
+// *QuotaError if they would exceed it together with the uploads in progress
+func (t *UsageTracker) Reserve(user string, size int64, quota UploadQuota) (*QuotaReservation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	usage := t.usage[user].current(now)
+	used := t.reserved[user]
+
+	if quota.DailyBytes > 0 && usage.DayBytes+used+size > quota.DailyBytes {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		return nil, &QuotaError{Period: "daily", Limit: quota.DailyBytes, Used: usage.DayBytes + used, RetryAfter: tomorrow.Sub(now)}
+	}
+	if quota.MonthlyBytes > 0 && usage.MonthBytes+used+size > quota.MonthlyBytes {
+		nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+		return nil, &QuotaError{Period: "monthly", Limit: quota.MonthlyBytes, Used: usage.MonthBytes + used, RetryAfter: nextMonth.Sub(now)}
+	}
+	t.reserved[user] += size
+	return &QuotaReservation{t: t, user: user, size: size}, nil
+}
+
+// Record adds the reserved bytes to the user's usage
+func (r *QuotaReservation) Record() {
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	r.t.unreserveLocked(r.user, r.size)
+
+	now := time.Now()
+	usage := r.t.usage[r.user].current(now)
+	usage.DayBytes += r.size
+	usage.MonthBytes += r.size
+	usage.LastUploadAt = now.Format(time.RFC3339)
+	r.t.usage[r.user] = usage
+
+	if err := writeJSONFile(filepath.Join(filepath.Dir(GetConfigPath()), uploadUsageFileName), r.t.usage); err != nil {
+		slog.Error("Failed to save upload usage", "error", err)
+	}
+}
+
+// Release gives the reserved bytes back when the upload failed. It does nothing once
+// the upload has been recorded.
+func (r *QuotaReservation) Release() {
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	r.t.unreserveLocked(r.user, r.size)
+}
+
+// unreserveLocked drops a reservation, the caller must hold t.mu
+func (t *UsageTracker) unreserveLocked(user string, size int64) {
+	if t.reserved[user] -= size; t.reserved[user] <= 0 {
+		delete(t.reserved, user)
+	}
+}
+
+// Snapshot returns the current usage of every user
+func (t *UsageTracker) Snapshot() map[string]UploadUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	result := make(map[string]UploadUsage, len(t.usage))
+	for user, usage := range t.usage {
+		result[user] = usage.current(now)
+	}
+	return result
+}
+
+// retryAfterSeconds rounds a retry delay up to whole seconds for the Retry-After header
+func retryAfterSeconds(d time.Duration) int {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
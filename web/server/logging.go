@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// RequestIDHeader carries the request ID to and from HTTP peers
+const RequestIDHeader = "X-Request-ID"
+
+const redacted = "[REDACTED]"
+
+// Attribute keys whose values are never logged, matched case-insensitively as substrings
+var sensitiveLogKeys = []string{"authorization", "password", "token", "secret", "api_key", "apikey"}
+
+// LogConfig configures structured logging
+type LogConfig struct {
+	Level  string `json:"level"`  // "debug", "info", "warn" or "error", default info
+	Format string `json:"format"` // "text" or "json", default text
+}
+
+// logLevel is shared by every logger SetupLogging creates so the level can change at runtime
+var logLevel = new(slog.LevelVar)
+
+// SetupLogging makes a redacting, request ID aware logger writing to w the default
+func SetupLogging(config LogConfig, w io.Writer) {
+	SetLogLevel(config.Level)
+
+	opts := &slog.HandlerOptions{Level: logLevel, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	if strings.EqualFold(config.Format, LogFormatJSON) {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// SetLogLevel changes the level of the default logger, unknown levels mean info
+func SetLogLevel(level string) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		l = slog.LevelInfo
+	}
+	logLevel.Set(l)
+}
+
+// redactAttr hides secrets by attribute key, and credentials passed as values
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Value.Kind() == slog.KindString {
+		v := a.Value.String()
+		if strings.HasPrefix(v, "Basic ") || strings.HasPrefix(v, "Bearer ") {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	return a
+}
+
+// isSensitiveKey reports whether values stored under key are secrets
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveLogKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecrets replaces non-empty values of sensitive keys in a decoded JSON tree
+func redactSecrets(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if s, ok := child.(string); ok && s != "" && isSensitiveKey(k) {
+				t[k] = redacted
+			} else {
+				t[k] = redactSecrets(child)
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redactSecrets(t[i])
+		}
+	}
+	return v
+}
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random ID for correlating the log lines of one request
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a context carrying a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID carried by a context, or ""
+func RequestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID of the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFrom(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
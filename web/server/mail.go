@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// SMTP security modes
+const (
+	SMTPSecurityNone     = "none"
+	SMTPSecurityStartTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+)
+
+const smtpDialTimeout = 30 * time.Second
+
+// Mailer sends emails through an SMTP server
+type Mailer struct {
+	Host     string
+	Port     int
+	Security string
+	Username string
+	Password string
+	From     string
+}
+
+// ShareEmail holds the details of a share to be delivered by email
+type ShareEmail struct {
+	Recipients []string
+	Message    string
+	URL        string
+	Filename   string
+	ExpiresAt  string
+	Password   string
+	// SendPassword sends the password in a second, separate email
+	SendPassword bool
+}
+
+// EmailDelivery records the outcome of emailing a share link
+type EmailDelivery struct {
+	Recipients   []string `json:"recipients"`
+	Status       string   `json:"status"` // "sent" or "failed"
+	Error        string   `json:"error,omitempty"`
+	PasswordSent bool     `json:"passwordSent"`
+	SentAt       string   `json:"sentAt"`
+}
+
+// NewMailer creates a mailer from the SMTP settings in the config
+func NewMailer(config *Config, password string) (*Mailer, error) {
+	if config.SMTPHost == "" {
+		return nil, fmt.Errorf("email is not configured - please set the SMTP server in settings")
+	}
+	if config.SMTPFrom == "" {
+		return nil, fmt.Errorf("no sender address configured for email")
+	}
+
+	security := strings.ToLower(config.SMTPSecurity)
+	if security == "" {
+		security = SMTPSecurityStartTLS
+	}
+
+	port := config.SMTPPort
+	if port == 0 {
+		switch security {
+		case SMTPSecurityTLS:
+			port = 465
+		case SMTPSecurityStartTLS:
+			port = 587
+		default:
+			port = 25
+		}
+	}
+
+	return &Mailer{
+		Host:     config.SMTPHost,
+		Port:     port,
+		Security: security,
+		Username: config.SMTPUsername,
+		Password: password,
+		From:     config.SMTPFrom,
+	}, nil
+}
+
+// ParseRecipients parses a comma separated list of email addresses
+func ParseRecipients(list string) ([]string, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return nil, nil
+	}
+
+	addrs, err := mail.ParseAddressList(list)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient list: %w", err)
+	}
+
+	var recipients []string
+	for _, addr := range addrs {
+		recipients = append(recipients, addr.Address)
+	}
+	return recipients, nil
+}
+
+var shareTextTemplate = texttemplate.Must(texttemplate.New("share").Parse(`A file has been shared with you: {{.Filename}}
+{{if .Message}}
+{{.Message}}
+{{end}}
+Download link: {{.URL}}
+{{if .ExpiresAt}}This link expires on {{.ExpiresAt}}.{{else}}This link does not expire.{{end}}
+{{if .Password}}The link is password protected. The password will be sent in a separate email.{{end}}
+`))
+
+var shareHTMLTemplate = htmltemplate.Must(htmltemplate.New("share").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<p>A file has been shared with you: <strong>{{.Filename}}</strong></p>
+{{if .Message}}<p style="white-space: pre-line;">{{.Message}}</p>{{end}}
+<p><a href="{{.URL}}">Download {{.Filename}}</a></p>
+<p>{{if .ExpiresAt}}This link expires on {{.ExpiresAt}}.{{else}}This link does not expire.{{end}}</p>
+{{if .Password}}<p>The link is password protected. The password will be sent in a separate email.</p>{{end}}
+</body>
+</html>
+`))
+
+var passwordTextTemplate = texttemplate.Must(texttemplate.New("password").Parse(`The password for the file {{.Filename}} shared with you is:
+
+{{.Password}}
+`))
+
+var passwordHTMLTemplate = htmltemplate.Must(htmltemplate.New("password").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<p>The password for the file <strong>{{.Filename}}</strong> shared with you is:</p>
+<p style="font-family: monospace; font-size: 1.2em;">{{.Password}}</p>
+</body>
+</html>
+`))
+
+// SendShare emails a share link to its recipients, followed by the password in
+// a second email when requested
+func (m *Mailer) SendShare(email ShareEmail) error {
+	if len(email.Recipients) == 0 {
+		return fmt.Errorf("no recipients provided")
+	}
+
+	data := struct {
+		Filename  string
+		Message   string
+		URL       string
+		ExpiresAt string
+		Password  bool
+	}{
+		Filename:  email.Filename,
+		Message:   email.Message,
+		URL:       email.URL,
+		ExpiresAt: formatEmailDate(email.ExpiresAt),
+		Password:  email.SendPassword && email.Password != "",
+	}
+
+	var text, html bytes.Buffer
+	if err := shareTextTemplate.Execute(&text, data); err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+	if err := shareHTMLTemplate.Execute(&html, data); err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	subject := "File shared with you: " + email.Filename
+	if err := m.Send(email.Recipients, subject, text.String(), html.String()); err != nil {
+		return err
+	}
+
+	if !data.Password {
+		return nil
+	}
+
+	text.Reset()
+	html.Reset()
+	if err := passwordTextTemplate.Execute(&text, email); err != nil {
+		return fmt.Errorf("failed to render password email: %w", err)
+	}
+	if err := passwordHTMLTemplate.Execute(&html, email); err != nil {
+		return fmt.Errorf("failed to render password email: %w", err)
+	}
+
+	subject = "Password for " + email.Filename
+	if err := m.Send(email.Recipients, subject, text.String(), html.String()); err != nil {
+		return fmt.Errorf("link was sent but the password email failed: %w", err)
+	}
+
+	return nil
+}
+
+// formatEmailDate formats an RFC 3339 date for display, passing other values through
+func formatEmailDate(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.Format("2 January 2006")
+}
+
+// Send delivers a multipart text/HTML email to the given recipients
+func (m *Mailer) Send(to []string, subject, textBody, htmlBody string) error {
+	msg, err := m.buildMessage(to, subject, textBody, htmlBody)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("SMTP server does not support authentication")
+		}
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP server rejected sender: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP server rejected recipient %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// dial connects to the SMTP server using the configured security mode
+func (m *Mailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	tlsConfig := &tls.Config{ServerName: m.Host}
+
+	var conn net.Conn
+	var err error
+	if m.Security == SMTPSecurityTLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpDialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpDialTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+
+	if m.Security == SMTPSecurityStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// buildMessage renders the headers and multipart/alternative body of an email
+func (m *Mailer) buildMessage(to []string, subject, textBody, htmlBody string) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", textBody},
+		{"text/html; charset=utf-8", htmlBody},
+	}
+	for _, part := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build message: %w", err)
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to build message: %w", err)
+		}
+		qp.Close()
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build message: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// deliverShareEmail sends a share email and returns the delivery record
+func deliverShareEmail(mailer *Mailer, email ShareEmail) *EmailDelivery {
+	delivery := &EmailDelivery{
+		Recipients:   email.Recipients,
+		Status:       "sent",
+		PasswordSent: email.SendPassword && email.Password != "",
+		SentAt:       time.Now().Format(time.RFC3339),
+	}
+	if err := mailer.SendShare(email); err != nil {
+		delivery.Status = "failed"
+		delivery.Error = err.Error()
+		delivery.PasswordSent = false
+	}
+	return delivery
+}
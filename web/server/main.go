@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 //go:embed all:frontend/dist
@@ -26,21 +37,270 @@ const (
 	userSessionVal  = "user-session-secret"
 )
 
+// apiKeyContextKey is the gin context key holding the authenticated *APIKey
+const apiKeyContextKey = "apiKey"
+
+// requestAPIKey returns the API key the request was authenticated with, or nil for sessions
+func requestAPIKey(c *gin.Context) *APIKey {
+	if v, ok := c.Get(apiKeyContextKey); ok {
+		return v.(*APIKey)
+	}
+	return nil
+}
+
+// currentRole returns the portal role of the request's session, "api:<name>" for
+// API key requests, or "" if not logged in
+func currentRole(c *gin.Context) string {
+	if key := requestAPIKey(c); key != nil {
+		return "api:" + key.Name
+	}
+	session, _ := c.Cookie(sessionCookieName)
+	switch session {
+	case adminSessionVal:
+		return "admin"
+	case userSessionVal:
+		return "user"
+	}
+	return ""
+}
+
+// isAdmin reports whether the request has an admin session or an admin scoped API key
+func isAdmin(c *gin.Context) bool {
+	if key := requestAPIKey(c); key != nil {
+		return key.HasScope(ScopeAdmin)
+	}
+	return currentRole(c) == "admin"
+}
+
+// sameServer reports whether a base URL and tenant are the configured ones
+func sameServer(baseURL, tenantName string, config *Config) bool {
+	normalize := func(u string) string { return strings.ToLower(strings.TrimRight(strings.TrimSpace(u), "/")) }
+	return config.BaseURL != "" && normalize(baseURL) == normalize(config.BaseURL) &&
+		strings.EqualFold(strings.TrimSpace(tenantName), strings.TrimSpace(config.TenantName))
+}
+
+// abortTooManyRequests rejects a request with 429 and a Retry-After hint
+func abortTooManyRequests(c *gin.Context, message string, retry time.Duration) {
+	secs := retryAfterSeconds(retry)
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message, "retryAfter": secs})
+	c.Abort()
+}
+
+// validRequestID accepts request IDs passed in by proxies, rejecting ones unsafe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestLogger gives every request an ID, available to handlers through requestContext,
+// and logs the request once it is finished
+func requestLogger(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = NewRequestID()
+	}
+	c.Header(RequestIDHeader, id)
+	c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+
+	start := time.Now()
+	c.Next()
+
+	level := slog.LevelInfo
+	if c.Writer.Status() >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	slog.Log(c.Request.Context(), level, "HTTP request",
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"status", c.Writer.Status(),
+		"duration", time.Since(start),
+		"client_ip", c.ClientIP(),
+		"role", currentRole(c),
+	)
+}
+
+// configSaveFailed reports a failed config save, with the invalid fields of a config
+// that did not validate
+func configSaveFailed(c *gin.Context, err error) {
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": invalid.Fields})
+		return
+	}
+	if errors.Is(err, ErrConfigChanged) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrConfigReadOnly) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "configuration is read-only, it is managed through the environment or the config file"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// shareRequestInvalid reports a share request that failed validation, with the invalid
+// fields when there are any
+func shareRequestInvalid(c *gin.Context, err error) {
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": invalid.Fields})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// ifMatchVersion returns the config version from an If-Match header, or "" to save unconditionally
+func ifMatchVersion(c *gin.Context) string {
+	v := strings.TrimPrefix(strings.TrimSpace(c.GetHeader("If-Match")), "W/")
+	if v == "*" {
+		return ""
+	}
+	return strings.Trim(v, `"`)
+}
+
+// requestContext returns the request's context without its cancellation, so work
+// started by the request, such as a category cache refresh, can outlive it
+func requestContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
+
 func main() {
-	r := gin.Default()
+	printConfig, err := ParseConfigOptions(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	startConfig, err := LoadConfig()
+	if printConfig {
+		if err == nil {
+			err = PrintConfig(startConfig)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		startConfig = &Config{}
+	}
+	SetupLogging(startConfig.Logging, os.Stdout)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+	}
+	for _, o := range configOverrides {
+		slog.Info("Config setting overridden", "setting", o.Setting.Key, "source", o.Source)
+	}
+	if configReadOnly {
+		slog.Info("Config is read-only, changes through the API are rejected")
+	}
+	serverConfig := startConfig.Server
+	basePath := serverConfig.NormalizedBasePath()
+
+	// Forwarded client IPs, schemes and prefixes are only believed from trusted proxies
+	proxies, err := NewProxyTrust(serverConfig.TrustedProxies)
+	if err != nil {
+		slog.Error("Invalid server config", "error", err)
+		os.Exit(1)
+	}
+
+	// Traces are only exported when an OTLP endpoint is configured
+	shutdownTracing, err := SetupTracing(startConfig.Tracing, "ThereforeSharerWeb")
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+	} else {
+		defer shutdownTracing(context.Background())
+	}
+
+	r := gin.New()
+	if err := r.SetTrustedProxies(serverConfig.TrustedProxies); err != nil {
+		slog.Error("Invalid server config", "error", err)
+		os.Exit(1)
+	}
+	r.Use(gin.Recovery(), requestLogger, otelgin.Middleware("ThereforeSharerWeb", otelgin.WithFilter(func(req *http.Request) bool {
+		// Probes and scrapes would drown out the interesting traces
+		return req.URL.Path != "/healthz" && req.URL.Path != "/readyz" && req.URL.Path != "/metrics"
+	})))
+
+	InstrumentTherefore()
+
+	webhooks := NewWebhookDispatcher()
+	webhooks.Start()
+
+	apiKeys := NewAPIKeyStore()
+	apiKeys.StartFlusher()
+
+	limiter := NewRateLimiter()
+	limiter.StartSweeper(func() time.Duration {
+		config, err := LoadConfig()
+		if err != nil {
+			return 0
+		}
+		return config.Limits.WithDefaults().longestWindow()
+	})
+	uploadUsage := NewUsageTracker()
+
+	approvals := NewApprovalService(NewApprovalStore(), webhooks)
+	approvals.Start()
+
+	categoryCache := NewCategoryCache(time.Duration(startConfig.CategoryCacheMinutes) * time.Minute)
+	categoryCache.Start()
+
+	// Pick up edits made to config.json while the server is running
+	configStore.OnChange(func() {
+		if config, err := LoadConfig(); err == nil {
+			categoryCache.SetTTL(time.Duration(config.CategoryCacheMinutes) * time.Minute)
+			SetLogLevel(config.Logging.Level)
+		}
+	})
+	configStore.Start()
 
-	// Enable CORS for frontend development
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173", "http://127.0.0.1:5173"},
+	// Report documents a previous run left without a link, and cancel uploads still
+	// running when a shutdown's drain timeout runs out
+	removeStaleUploadDirs()
+	uploads := NewUploadJournal()
+	uploadsCtx, cancelUploads := context.WithCancel(context.Background())
+
+	// CORS for browser clients on other origins, by default the frontend dev server
+	corsConfig := cors.Config{
+		AllowOrigins:     serverConfig.AllowedOrigins(),
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "If-Match"},
+		ExposeHeaders:    []string{"ETag"},
 		AllowCredentials: true,
-	}))
+	}
+	if err := corsConfig.Validate(); err != nil {
+		slog.Error("Invalid server config", "error", err)
+		os.Exit(1)
+	}
+	r.Use(cors.New(corsConfig))
 
 	// ==================== Auth Middlewares ====================
-	
-	// Middleware to check if ANY valid session exists
+
+	// Middleware to check if ANY valid session or API key exists
 	authRequired := func(c *gin.Context) {
+		if plain, ok := bearerAPIKey(c.GetHeader("Authorization")); ok {
+			key, err := apiKeys.Authenticate(plain)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+			c.Set(apiKeyContextKey, key)
+			c.Next()
+			apiKeys.RecordUsage(APIKeyUsage{
+				KeyID:  key.ID,
+				Method: c.Request.Method,
+				Path:   c.Request.URL.Path,
+				Status: c.Writer.Status(),
+				IP:     c.ClientIP(),
+				Time:   time.Now().Format(time.RFC3339),
+			})
+			return
+		}
+
 		config, _ := LoadConfig()
 		if config.AdminPassword == "" {
 			c.Next()
@@ -56,8 +316,16 @@ func main() {
 		c.Next()
 	}
 
-	// Middleware to check if specifically ADMIN session exists
+	// Middleware to check if specifically ADMIN session or admin scoped API key exists
 	adminOnly := func(c *gin.Context) {
+		if key := requestAPIKey(c); key != nil {
+			if !key.HasScope(ScopeAdmin) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "API key is not scoped for admin access"})
+				c.Abort()
+			}
+			return
+		}
+
 		session, err := c.Cookie(sessionCookieName)
 		if err != nil || session != adminSessionVal {
 			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
@@ -67,25 +335,94 @@ func main() {
 		c.Next()
 	}
 
+	// Middleware to check that an API key carries a scope. Sessions are checked by
+	// authRequired/adminOnly instead.
+	requireScope := func(scope string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			if key := requestAPIKey(c); key != nil && !key.HasScope(scope) {
+				c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key is not scoped for %s access", scope)})
+				c.Abort()
+			}
+		}
+	}
+
+	// Middleware applying share rate limits and the request body size limit
+	shareLimits := func(c *gin.Context) {
+		config, _ := LoadConfig()
+		limits := config.Limits.WithDefaults()
+
+		if c.Request.ContentLength > limits.MaxRequestBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("upload exceeds the maximum request size of %d bytes", limits.MaxRequestBytes)})
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxRequestBytes)
+
+		if ok, retry := limiter.Allow("share-ip:"+c.ClientIP(), limits.SharePerIP); !ok {
+			abortTooManyRequests(c, "too many share requests from this address - please try again later", retry)
+			return
+		}
+		if ok, retry := limiter.Allow("share-user:"+currentRole(c), limits.SharePerUser); !ok {
+			abortTooManyRequests(c, "too many share requests - please try again later", retry)
+			return
+		}
+	}
+
+	// Middleware allowing link revocation by admins or revoke scoped API keys
+	revokeAllowed := func(c *gin.Context) {
+		if key := requestAPIKey(c); key != nil {
+			requireScope(ScopeRevoke)(c)
+			return
+		}
+		adminOnly(c)
+	}
+
 	// ==================== Public Endpoints ====================
 
-	r.GET("/api/status", func(c *gin.Context) {
+	// Liveness, readiness and metrics for container orchestration and monitoring
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// The reason the server isn't ready can name the Therefore server, only admins see it
+	r.GET("/readyz", func(c *gin.Context) {
+		if err := CheckReadyCached(); err != nil {
+			if isAdmin(c) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	metricsHandler := promhttp.Handler()
+	r.GET("/metrics", func(c *gin.Context) {
 		config, _ := LoadConfig()
-		session, _ := c.Cookie(sessionCookieName)
-		
-		role := ""
-		if session == adminSessionVal {
-			role = "admin"
-		} else if session == userSessionVal {
-			role = "user"
+		if config.MetricsToken != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+config.MetricsToken)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
 		}
+		metricsHandler.ServeHTTP(c.Writer, c.Request)
+	})
 
-		c.JSON(http.StatusOK, gin.H{
-			"isFirstRun":   config.AdminPassword == "",
-			"isLoggedIn":   role != "",
-			"role":         role,
-			"isConfigured": config.IsSetUp,
-		})
+	r.GET("/api/status", func(c *gin.Context) {
+		config, _ := LoadConfig()
+		role := currentRole(c)
+
+		status := gin.H{
+			"isFirstRun":     config.AdminPassword == "",
+			"isLoggedIn":     role != "",
+			"role":           role,
+			"isConfigured":   config.IsSetUp,
+			"configReadOnly": configReadOnly,
+		}
+		if role == "admin" {
+			// Changes to these are saved but the environment or flag value stays in effect
+			status["overriddenSettings"] = OverriddenSettings()
+		}
+		c.JSON(http.StatusOK, status)
 	})
 
 	r.POST("/api/login", func(c *gin.Context) {
@@ -99,33 +436,54 @@ func main() {
 
 		config, _ := LoadConfig()
 
+		// Brute-force protection: failed attempts are limited per client IP
+		loginKey := "login:" + c.ClientIP()
+		if ok, retry := limiter.Check(loginKey, config.Limits.WithDefaults().LoginPerIP); !ok {
+			abortTooManyRequests(c, "too many failed login attempts - please try again later", retry)
+			return
+		}
+
 		// Case 1: First run - set the admin password
 		if config.AdminPassword == "" {
 			if len(req.Password) < 4 {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "password must be at least 4 characters"})
 				return
 			}
-			config.AdminPassword = req.Password
-			config.SaveConfig()
-			c.SetCookie(sessionCookieName, adminSessionVal, 86400, "/", "", false, true)
+			_, err := UpdateConfig("", func(config *Config) error {
+				// Another first-run login may have set it in the meantime
+				if config.AdminPassword != "" {
+					return ErrConfigChanged
+				}
+				config.AdminPassword = req.Password
+				return nil
+			})
+			if err != nil {
+				configSaveFailed(c, err)
+				return
+			}
+			setSessionCookie(c, serverConfig, proxies, adminSessionVal, 86400)
 			c.JSON(http.StatusOK, gin.H{"status": "ok", "role": "admin"})
 			return
 		}
 
 		// Case 2: Standard login check
 		if req.Password == config.AdminPassword {
-			c.SetCookie(sessionCookieName, adminSessionVal, 86400, "/", "", false, true)
+			limiter.Reset(loginKey)
+			setSessionCookie(c, serverConfig, proxies, adminSessionVal, 86400)
 			c.JSON(http.StatusOK, gin.H{"status": "ok", "role": "admin"})
 		} else if config.UserPassword != "" && req.Password == config.UserPassword {
-			c.SetCookie(sessionCookieName, userSessionVal, 86400, "/", "", false, true)
+			limiter.Reset(loginKey)
+			setSessionCookie(c, serverConfig, proxies, userSessionVal, 86400)
 			c.JSON(http.StatusOK, gin.H{"status": "ok", "role": "user"})
 		} else {
+			limiter.Add(loginKey)
+			loginFailures.Inc()
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "incorrect password"})
 		}
 	})
 
 	r.POST("/api/logout", func(c *gin.Context) {
-		c.SetCookie(sessionCookieName, "", -1, "/", "", false, true)
+		setSessionCookie(c, serverConfig, proxies, "", -1)
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
@@ -135,14 +493,20 @@ func main() {
 
 	// Admin Only Configuration
 	api.GET("/config", adminOnly, func(c *gin.Context) {
-		config, err := LoadConfig()
+		config, version, err := LoadConfigVersion()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		config.AuthToken = ""
 		config.AdminPassword = ""
+		config.SMTPPassword = ""
+		config.MetricsToken = ""
+		for i := range config.Webhooks {
+			config.Webhooks[i].Secret = ""
+		}
 		// UserPassword is okay to show/edit by admin
+		c.Header("ETag", `"`+version+`"`)
 		c.JSON(http.StatusOK, config)
 	})
 
@@ -156,12 +520,13 @@ func main() {
 			return
 		}
 
-		existing, _ := LoadConfig()
 		newConfig := req.Config
-		
-		if existing != nil {
+
+		// Secrets the client never sees are merged in under the store's lock, and an
+		// If-Match header rejects the save if someone else changed the config since
+		version, err := UpdateConfig(ifMatchVersion(c), func(existing *Config) error {
 			newConfig.AuthToken = existing.AuthToken
-			
+
 			// Update Admin Password if provided
 			if req.NewAdminPassword != "" {
 				newConfig.AdminPassword = req.NewAdminPassword
@@ -173,13 +538,137 @@ func main() {
 			if newConfig.UserPassword == "" {
 				newConfig.UserPassword = existing.UserPassword
 			}
+
+			if newConfig.SMTPPassword == "" {
+				newConfig.SMTPPassword = existing.SMTPPassword
+			}
+			if newConfig.MetricsToken == "" {
+				newConfig.MetricsToken = existing.MetricsToken
+			}
+
+			// Secrets are never sent to the client, a target sent without one keeps its own
+			prepareWebhookTargets(newConfig.Webhooks, existing.Webhooks)
+			*existing = newConfig
+			return nil
+		})
+		if err != nil {
+			configSaveFailed(c, err)
+			return
 		}
+		categoryCache.SetTTL(time.Duration(newConfig.CategoryCacheMinutes) * time.Minute)
+		SetLogLevel(newConfig.Logging.Level)
+		c.Header("ETag", `"`+version+`"`)
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
 
-		if err := newConfig.SaveConfig(); err != nil {
+	// Settings bundles: the config file's settings, with the secrets only included,
+	// encrypted, when a passphrase is given
+	api.POST("/settings/export", adminOnly, func(c *gin.Context) {
+		var req struct {
+			Passphrase string `json:"passphrase"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		config, _, err := configStore.Get()
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		tree, err := settingsTree(config)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		bundle, err := newSettingsBundle("web", tree, req.Passphrase)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		slog.Info("Exported settings", "credentials", bundle.Credentials != nil, "client_ip", c.ClientIP())
+		c.Header("Content-Disposition", `attachment; filename="ThereforeSharer-settings.json"`)
+		c.JSON(http.StatusOK, bundle)
+	})
+
+	type settingsImportRequest struct {
+		SettingsImportRequest
+		Bundle json.RawMessage `json:"bundle"`
+	}
+	// importSettings applies a bundle over current, the preview's Errors say why the result is invalid
+	importSettings := func(req settingsImportRequest, current *Config) (*Config, *ImportPreview, error) {
+		bundle, err := parseSettingsBundle(req.Bundle)
+		if err != nil {
+			return nil, nil, err
+		}
+		tree, err := settingsTree(current)
+		if err != nil {
+			return nil, nil, err
+		}
+		imported := &Config{}
+		preview, err := bundle.importInto(tree, req.SettingsImportRequest, imported)
+		if err != nil {
+			return nil, nil, err
+		}
+		return imported, preview, nil
+	}
+
+	api.POST("/settings/import/preview", adminOnly, func(c *gin.Context) {
+		var req settingsImportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		current, err := LoadConfig()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		_, preview, err := importSettings(req, current)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, preview)
+	})
+
+	api.POST("/settings/import", adminOnly, func(c *gin.Context) {
+		var req settingsImportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var preview *ImportPreview
+		var bundleErr error
+		version, err := UpdateConfig(ifMatchVersion(c), func(existing *Config) error {
+			var imported *Config
+			imported, preview, bundleErr = importSettings(req, existing)
+			if bundleErr != nil {
+				return bundleErr
+			}
+			if len(preview.Errors) > 0 {
+				return &ValidationError{Fields: preview.Errors}
+			}
+			prepareWebhookTargets(imported.Webhooks, existing.Webhooks)
+			*existing = *imported
+			return nil
+		})
+		if bundleErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bundleErr.Error()})
+			return
+		}
+		if err != nil {
+			configSaveFailed(c, err)
+			return
+		}
+		if config, err := LoadConfig(); err == nil {
+			categoryCache.SetTTL(time.Duration(config.CategoryCacheMinutes) * time.Minute)
+			SetLogLevel(config.Logging.Level)
+		}
+		slog.Info("Imported settings", "profile", req.Profile, "changes", len(preview.Changes), "client_ip", c.ClientIP())
+		c.Header("ETag", `"`+version+`"`)
+		c.JSON(http.StatusOK, preview)
 	})
 
 	api.POST("/auth", adminOnly, func(c *gin.Context) {
@@ -204,7 +693,39 @@ func main() {
 		}
 
 		if err := SetAuthToken(authToken); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			configSaveFailed(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	api.POST("/email/test", adminOnly, func(c *gin.Context) {
+		var req struct {
+			To string `json:"to"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		recipients, err := ParseRecipients(req.To)
+		if err != nil || len(recipients) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a valid recipient address is required"})
+			return
+		}
+
+		config, _ := LoadConfig()
+		mailer, err := NewMailer(config, config.SMTPPassword)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = mailer.Send(recipients, "ThereforeSharer test email",
+			"Your ThereforeSharer email settings are working.\n",
+			"<p>Your ThereforeSharer email settings are working.</p>\n")
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -216,8 +737,8 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"hasStoredCredentials": token != ""})
 	})
 
-	api.POST("/categories", func(c *gin.Context) {
-		// Category loading should still be restricted to admins or at least checked
+	// Loads the category tree for the settings screen, with the credentials being set up
+	api.POST("/categories", adminOnly, func(c *gin.Context) {
 		var req struct {
 			BaseURL    string `json:"baseURL"`
 			TenantName string `json:"tenantName"`
@@ -240,94 +761,771 @@ func main() {
 			authToken = req.Token
 		}
 
+		// The stored credentials are only ever sent to the configured server
 		if authToken == "" {
+			config, err := LoadConfig()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if !sameServer(req.BaseURL, req.TenantName, config) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "credentials are required for a server or tenant other than the configured one"})
+				return
+			}
 			storedToken, _ := GetAuthToken()
 			authToken = storedToken
 		}
 
-		client := NewThereforeAPIClient(req.BaseURL, req.TenantName, authToken)
-		treeViews, err := client.GetCategoriesTree()
+		client := NewThereforeAPIClient(req.BaseURL, req.TenantName, authToken).WithContext(requestContext(c))
+		// Loading categories from settings always fetches the current tree
+		index, err := categoryCache.Get(client, true)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		categories := FindCategoriesWithPath(treeViews, "")
 		var result []gin.H
-		for _, cat := range categories {
+		for _, cat := range index.Categories {
 			result = append(result, gin.H{"objNo": cat.ItemNo, "caption": cat.Path})
 		}
 		c.JSON(http.StatusOK, result)
 	})
 
-	api.POST("/share", func(c *gin.Context) {
-		form, err := c.MultipartForm()
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Categories a user may choose when sharing, empty when no choice is configured
+	api.GET("/categories/choices", requireScope(ScopeShare), func(c *gin.Context) {
+		config, _ := LoadConfig()
+		if len(config.AllowedCategories) == 0 {
+			c.JSON(http.StatusOK, []gin.H{})
 			return
 		}
 
-		files := form.File["files"]
-		password := c.PostForm("password")
-		expiryDays, _ := strconv.Atoi(c.PostForm("expiryDays"))
-		customExpiry := c.PostForm("customExpiry")
-
-		config, _ := LoadConfig()
 		token, _ := GetAuthToken()
-		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token)
-
-		tempDir, _ := os.MkdirTemp("", "therefore-*")
-		defer os.RemoveAll(tempDir)
-
-		var tempPaths []string
-		for _, f := range files {
-			p := filepath.Join(tempDir, f.Filename)
-			c.SaveUploadedFile(f, p)
-			tempPaths = append(tempPaths, p)
-		}
-
-		var fileData []byte
-		if len(tempPaths) == 1 && strings.EqualFold(filepath.Ext(tempPaths[0]), ".zip") {
-			fileData, _ = os.ReadFile(tempPaths[0])
-		} else {
-			fileData, _ = CreateZipArchive(tempPaths)
-		}
-
-		fileName := GetFileNameForUpload(tempPaths, config.DefaultArchive)
-		docResp, err := client.CreateDocument(config.CategoryNo, fileName, fileData, []IndexDataItem{})
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+		index, err := categoryCache.Get(client, false)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		var expiryTime *time.Time
-		if expiryDays > 0 {
-			t := time.Now().AddDate(0, 0, expiryDays)
-			expiryTime = &t
-		} else if expiryDays == -1 {
-			t, _ := time.Parse(time.RFC3339, customExpiry)
-			expiryTime = &t
+		result := []gin.H{}
+		for _, cat := range AllowedCategoryChoices(config, index.Categories) {
+			result = append(result, gin.H{"objNo": cat.ItemNo, "caption": cat.Path})
 		}
+		c.JSON(http.StatusOK, result)
+	})
 
-		linkResp, err := client.CreateSharedLink(docResp.DocNo, password, expiryTime, fileName)
+	// Searches category paths, best matches first
+	api.GET("/categories/search", requireScope(ScopeShare), func(c *gin.Context) {
+		config, _ := LoadConfig()
+		token, _ := GetAuthToken()
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+		index, err := categoryCache.Get(client, false)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"url": linkResp.URL, "docNo": docResp.DocNo})
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		result := []gin.H{}
+		for _, cat := range SearchCategories(index.Categories, c.Query("q"), limit) {
+			result = append(result, gin.H{"objNo": cat.ItemNo, "caption": cat.Path})
+		}
+		c.JSON(http.StatusOK, gin.H{"results": result, "version": index.Version, "fetchedAt": index.FetchedAt, "stale": index.Stale})
 	})
 
-	api.GET("/history", func(c *gin.Context) {
+	// Reports whether the configured category was deleted or renamed
+	api.GET("/categories/status", adminOnly, func(c *gin.Context) {
 		config, _ := LoadConfig()
 		token, _ := GetAuthToken()
-		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token)
-		entries, err := client.GetSharedLinksSharedByMe()
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+		index, err := categoryCache.Get(client, false)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, entries)
+
+		status := CheckConfiguredCategory(config, index.Categories)
+		if status.Message != "" && config.CategoryNo != 0 {
+			slog.WarnContext(c.Request.Context(), "Configured category changed", "category_no", status.CategoryNo, "message", status.Message)
+		}
+		c.JSON(http.StatusOK, gin.H{"status": status, "version": index.Version, "fetchedAt": index.FetchedAt, "stale": index.Stale, "error": index.Error})
+	})
+
+	// Checks that every category used by the routing rules still exists
+	api.GET("/routing/validate", adminOnly, func(c *gin.Context) {
+		config, _ := LoadConfig()
+		token, _ := GetAuthToken()
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+		index, err := categoryCache.Get(client, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		problems := ValidateRoutingTargets(config, index.Categories)
+		if problems == nil {
+			problems = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{"problems": problems})
+	})
+
+	// The share policy for a category and the caller's role, 0 = the default category
+	api.GET("/share/policy", requireScope(ScopeShare), func(c *gin.Context) {
+		config, _ := LoadConfig()
+		categoryNo, err := strconv.Atoi(c.DefaultQuery("categoryNo", "0"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid categoryNo"})
+			return
+		}
+		if categoryNo == 0 {
+			categoryNo = config.CategoryNo
+		}
+		c.JSON(http.StatusOK, EffectiveSharePolicy(config.SharePolicies, categoryNo, currentRole(c)))
+	})
+
+	// Generates a password that meets the share policy of a category, 0 = the default category
+	api.POST("/password/generate", requireScope(ScopeShare), func(c *gin.Context) {
+		var options PasswordOptions
+		if err := c.ShouldBindJSON(&options); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		config, _ := LoadConfig()
+		categoryNo, err := strconv.Atoi(c.DefaultQuery("categoryNo", "0"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid categoryNo"})
+			return
+		}
+		if categoryNo == 0 {
+			categoryNo = config.CategoryNo
+		}
+		password, err := GenerateSharePassword(options, EffectiveSharePolicy(config.SharePolicies, categoryNo, currentRole(c)))
+		if err != nil {
+			shareRequestInvalid(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"password": password})
+	})
+
+	api.POST("/share", requireScope(ScopeShare), shareLimits, func(c *gin.Context) {
+		activeUploads.Inc()
+		defer activeUploads.Dec()
+
+		// Each stage of the share is traced as a child of the request span
+		ctx := requestContext(c)
+
+		_, span := StartSpan(ctx, "receive upload", attribute.Int64("http.request.body.size", c.Request.ContentLength))
+		form, err := c.MultipartForm()
+		EndSpan(span, err)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("upload exceeds the maximum request size of %d bytes", maxErr.Limit)})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		files := form.File["files"]
+
+		config, _ := LoadConfig()
+		limits := config.Limits.WithDefaults()
+		user := currentRole(c)
+
+		var totalSize int64
+		for _, f := range files {
+			if limits.MaxFileBytes > 0 && f.Size > limits.MaxFileBytes {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("%s exceeds the maximum file size of %d bytes", f.Filename, limits.MaxFileBytes)})
+				return
+			}
+			totalSize += f.Size
+		}
+
+		reservation, err := uploadUsage.Reserve(user, totalSize, limits.QuotaFor(user))
+		if err != nil {
+			var quotaErr *QuotaError
+			if errors.As(err, &quotaErr) {
+				abortTooManyRequests(c, err.Error(), quotaErr.RetryAfter)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer reservation.Release() // Unless recorded below
+
+		password := c.PostForm("password")
+		// A password is generated instead with the options given as JSON, or "true" for the defaults
+		var generatePassword *PasswordOptions
+		if value := strings.TrimSpace(c.PostForm("generatePassword")); value != "" && value != "false" {
+			generatePassword = &PasswordOptions{}
+			if value != "true" {
+				if err := json.Unmarshal([]byte(value), generatePassword); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid generatePassword options: " + err.Error()})
+					return
+				}
+			}
+		}
+		// Without an expiry the share policy's default applies, once the category is known
+		expiryValue := strings.TrimSpace(c.PostForm("expiryDays"))
+		expiryDays, err := strconv.Atoi(expiryValue)
+		if err != nil && expiryValue != "" {
+			shareRequestInvalid(c, &ValidationError{Subject: "share", Fields: []FieldError{{Field: "expiryDays", Message: fmt.Sprintf("%q is not a number", expiryValue)}}})
+			return
+		}
+		customExpiry := c.PostForm("customExpiry")
+		message := c.PostForm("message")
+		sendPassword := c.PostForm("sendPassword") == "true"
+
+		// Check email settings before uploading so a bad address doesn't leave an unsent link
+		recipients, err := ParseRecipients(c.PostForm("recipients"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		notifyEmail := strings.TrimSpace(c.PostForm("notifyEmail"))
+		if notifyEmail != "" {
+			if _, err := ParseRecipients(notifyEmail); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		var mailer *Mailer
+		if len(recipients) > 0 {
+			mailer, err = NewMailer(config, config.SMTPPassword)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		token, _ := GetAuthToken()
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(ctx)
+
+		tempDir, err := newUploadTempDir()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer os.RemoveAll(tempDir)
+
+		_, span = StartSpan(ctx, "write temp files", attribute.Int("files.count", len(files)), attribute.Int64("files.size", totalSize))
+		var tempPaths []string
+		var fileNames []string
+		for _, f := range files {
+			p := filepath.Join(tempDir, f.Filename)
+			c.SaveUploadedFile(f, p)
+			tempPaths = append(tempPaths, p)
+			fileNames = append(fileNames, f.Filename)
+		}
+		span.End()
+
+		_, span = StartSpan(ctx, "virus scan")
+		scanResults, err := ScanUploads(config.VirusScan, tempPaths)
+		EndSpan(span, err)
+		if err != nil {
+			var scanErr *ScanError
+			if errors.As(err, &scanErr) {
+				slog.ErrorContext(c.Request.Context(), "Share blocked by virus scan", "user", user, "error", err)
+				status := http.StatusServiceUnavailable
+				if scanErr.Infected {
+					status = http.StatusUnprocessableEntity
+				}
+				c.JSON(status, gin.H{"error": err.Error(), "scan": scanResults, "quarantined": len(scanErr.Quarantined) > 0})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, span = StartSpan(ctx, "dlp inspect")
+		dlp, err := ValidateFiles(tempPaths, config.DLPRules)
+		EndSpan(span, err)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Pick the category through the routing rules. An API key restricted to a category
+		// shares into that category only, and is refused any other.
+		requestedCategory, _ := strconv.Atoi(c.PostForm("categoryNo"))
+		if key := requestAPIKey(c); key != nil && key.CategoryNo != 0 {
+			if requestedCategory != 0 && requestedCategory != key.CategoryNo {
+				c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key %q may only share to category %d", key.Name, key.CategoryNo)})
+				return
+			}
+			requestedCategory = key.CategoryNo
+		}
+		route, err := ResolveCategory(config, RouteInput{FilePaths: tempPaths, User: user, RequestedCategory: requestedCategory})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if route.Rule != RouteDefault {
+			index, err := categoryCache.Get(client, false)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if err := route.Verify(index.Categories); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		categoryNo := route.CategoryNo
+
+		// The share policies of the category and role decide the password and expiry rules
+		policy := EffectiveSharePolicy(config.SharePolicies, categoryNo, user)
+		if expiryValue == "" {
+			expiryDays = policy.DefaultExpiryDays
+		}
+		expiryTime, err := ParseShareExpiry(expiryDays, customExpiry, time.Local)
+		if err != nil {
+			shareRequestInvalid(c, err)
+			return
+		}
+		if generatePassword != nil {
+			if password, err = GenerateSharePassword(*generatePassword, policy); err != nil {
+				shareRequestInvalid(c, err)
+				return
+			}
+		}
+		if err := policy.Check(password, expiryTime); err != nil {
+			shareRequestInvalid(c, err)
+			return
+		}
+		if err := dlp.CheckShare(password, expiryTime); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "dlp": dlp.Matches})
+			return
+		}
+
+		_, span = StartSpan(ctx, "zip")
+		var fileData []byte
+		if len(tempPaths) == 1 && strings.EqualFold(filepath.Ext(tempPaths[0]), ".zip") {
+			fileData, _ = os.ReadFile(tempPaths[0])
+		} else {
+			fileData, _ = CreateZipArchive(tempPaths)
+		}
+		span.SetAttributes(attribute.Int("zip.size", len(fileData)))
+		span.End()
+
+		fileName := GetFileNameForUpload(tempPaths, config.DefaultArchive)
+
+		// Shares by non-admins wait for approval when a DLP rule or the category requires it
+		var approvalReason string
+		if !isAdmin(c) {
+			if m := dlp.RequiresApproval(); m != nil {
+				approvalReason = fmt.Sprintf("rule %q: %s %s", m.Rule, m.File, m.Reason)
+			}
+			for _, no := range config.ApprovalCategories {
+				if no == categoryNo && approvalReason == "" {
+					approvalReason = fmt.Sprintf("category %d requires approval", categoryNo)
+				}
+			}
+		}
+
+		// The upload is journaled until it has a link, and cancelled if the server
+		// is stopped before it finishes
+		uploadID := uploads.Begin(fileName, user)
+		uploadCtx, cancelUpload := context.WithCancel(ctx)
+		defer context.AfterFunc(uploadsCtx, cancelUpload)()
+		defer cancelUpload()
+
+		uploadStart := time.Now()
+		docCtx, span := StartSpan(uploadCtx, "CreateDocument", attribute.Int("therefore.category_no", categoryNo))
+		docResp, err := client.WithContext(docCtx).CreateDocument(categoryNo, fileName, fileData, []IndexDataItem{})
+		EndSpan(span, err)
+		if err != nil {
+			if uploadCtx.Err() != nil {
+				uploads.Orphan(uploadID, "upload cancelled by server shutdown, the document may have been created")
+			} else {
+				uploads.Finish(uploadID)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		uploads.SetDocument(uploadID, docResp.DocNo)
+		uploadDuration.Observe(time.Since(uploadStart).Seconds())
+		uploadedBytes.Add(float64(len(fileData)))
+
+		share := UploadedShare{
+			DocNo:        docResp.DocNo,
+			CategoryNo:   categoryNo,
+			Filename:     fileName,
+			Files:        fileNames,
+			SHA256:       HashFileData(fileData),
+			Size:         int64(len(fileData)),
+			Password:     password,
+			Recipients:   recipients,
+			Message:      message,
+			SendPassword: sendPassword,
+			SharedBy:     user,
+
+			PasswordGenerated: generatePassword != nil,
+			Scan:              scanResults,
+			DLP:               dlp.Matches,
+		}
+		if expiryTime != nil {
+			share.ExpiresAt = expiryTime.Format(time.RFC3339)
+		}
+		// A generated password is returned this once, it is never recorded
+		var generatedPassword string
+		if generatePassword != nil {
+			generatedPassword = password
+		}
+
+		if approvalReason != "" {
+			approval, err := approvals.Request(share, approvalReason, notifyEmail)
+			if err != nil {
+				uploads.Orphan(uploadID, "failed to queue approval request: "+err.Error())
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			uploads.Finish(uploadID)
+			reservation.Record()
+			c.JSON(http.StatusAccepted, gin.H{"status": ApprovalPending, "approval": approval, "docNo": docResp.DocNo, "scan": scanResults, "dlp": dlp.Matches, "category": route, "generatedPassword": generatedPassword})
+			return
+		}
+
+		linkCtx, span := StartSpan(ctx, "CreateSharedLink", attribute.Int64("therefore.doc_no", docResp.DocNo))
+		record, err := share.Publish(client.WithContext(linkCtx), mailer)
+		EndSpan(span, err)
+		if err != nil {
+			uploads.Orphan(uploadID, err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		uploads.Finish(uploadID)
+		webhooks.Emit(EventShareCreated, record.EventData())
+		sharesCreated.WithLabelValues("direct").Inc()
+		reservation.Record()
+
+		c.JSON(http.StatusOK, gin.H{"url": record.URL, "linkId": record.LinkID, "docNo": docResp.DocNo, "email": record.Email, "scan": scanResults, "dlp": dlp.Matches, "category": route, "generatedPassword": generatedPassword})
+	})
+
+	// Approval workflow. Admins see every request, everyone else only their own.
+	api.GET("/approvals", requireScope(ScopeShare), func(c *gin.Context) {
+		requestedBy := currentRole(c)
+		if isAdmin(c) {
+			requestedBy = ""
+		}
+		c.JSON(http.StatusOK, approvals.store.List(requestedBy, c.Query("status")))
+	})
+
+	api.GET("/approvals/:id", requireScope(ScopeShare), func(c *gin.Context) {
+		approval, err := approvals.store.Get(c.Param("id"))
+		if err != nil || (!isAdmin(c) && approval.SharedBy != currentRole(c)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "approval request not found"})
+			return
+		}
+		c.JSON(http.StatusOK, approval)
+	})
+
+	api.POST("/approvals/:id/approve", adminOnly, func(c *gin.Context) {
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		c.ShouldBindJSON(&req)
+
+		approval, err := approvals.Approve(c.Param("id"), currentRole(c), req.Comment)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, approval)
+	})
+
+	api.POST("/approvals/:id/reject", adminOnly, func(c *gin.Context) {
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		c.ShouldBindJSON(&req)
+
+		approval, err := approvals.Reject(c.Param("id"), currentRole(c), req.Comment)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, approval)
+	})
+
+	api.GET("/history", requireScope(ScopeHistory), func(c *gin.Context) {
+		config, _ := LoadConfig()
+		token, _ := GetAuthToken()
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+		entries, err := client.GetSharedLinksSharedByMe()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Whether a password was generated is only known from the local share records
+		generated := make(map[string]bool)
+		if records, err := LoadShareRecords(); err == nil {
+			for _, r := range records {
+				generated[r.LinkID] = r.PasswordGenerated
+			}
+		}
+		type historyEntry struct {
+			SharedLinkViewEntry
+			PasswordGenerated bool `json:"passwordGenerated"`
+		}
+		result := make([]historyEntry, 0, len(entries))
+		for _, entry := range entries {
+			result = append(result, historyEntry{entry, generated[entry.SharedLink.LinkID]})
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	// QR code of a shared link, for handing it over in person or printing it
+	api.GET("/links/:linkId/qr", requireScope(ScopeHistory), func(c *gin.Context) {
+		linkID := c.Param("linkId")
+		size, err := strconv.Atoi(c.DefaultQuery("size", "0"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid size"})
+			return
+		}
+		options := QROptions{Format: c.Query("format"), Size: size, Level: c.Query("level")}
+		if err := options.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": err.(*ValidationError).Fields})
+			return
+		}
+
+		// Links shared through this server are recorded, others are looked up in Therefore
+		var url string
+		if record, _ := FindShareRecordByLink(linkID); record != nil {
+			url = record.URL
+		} else {
+			config, _ := LoadConfig()
+			token, _ := GetAuthToken()
+			client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+			entries, err := client.GetSharedLinksSharedByMe()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			for _, entry := range entries {
+				if entry.SharedLink.LinkID == linkID {
+					url = entry.SharedLink.LinkURL
+				}
+			}
+		}
+		if url == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "shared link not found"})
+			return
+		}
+
+		data, contentType, err := RenderQRCode(url, options)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if c.Query("download") == "true" {
+			ext := QRFormatPNG
+			if contentType == "image/svg+xml" {
+				ext = QRFormatSVG
+			}
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "share-link-"+linkID+"."+ext))
+		}
+		c.Header("Cache-Control", "private, max-age=3600")
+		c.Data(http.StatusOK, contentType, data)
+	})
+
+	// Admin Only Link Management
+	api.POST("/links/:linkId/revoke", revokeAllowed, func(c *gin.Context) {
+		linkID := c.Param("linkId")
+
+		config, _ := LoadConfig()
+		token, _ := GetAuthToken()
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+		if err := client.RevokeSharedLink(linkID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		data := WebhookEventData{LinkID: linkID, User: currentRole(c)}
+		if record, _ := FindShareRecordByLink(linkID); record != nil {
+			data = record.EventData()
+			data.User = currentRole(c)
+		}
+		webhooks.Emit(EventLinkRevoked, data)
+
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	api.DELETE("/documents/:docNo", adminOnly, func(c *gin.Context) {
+		docNo, err := strconv.ParseInt(c.Param("docNo"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document number"})
+			return
+		}
+
+		config, _ := LoadConfig()
+		token, _ := GetAuthToken()
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+		if err := client.DeleteDocument(docNo); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		data := WebhookEventData{DocNo: docNo, User: currentRole(c)}
+		if record, _ := FindShareRecord(docNo); record != nil {
+			data = record.EventData()
+			data.User = currentRole(c)
+		}
+		webhooks.Emit(EventDocumentDeleted, data)
+
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// Documents uploaded without a shared link, after a restart or a failed link creation
+	api.GET("/orphans", adminOnly, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"orphans": uploads.Orphans()})
+	})
+
+	// Dismisses an orphan, deleting its document from Therefore when deleteDocument=true
+	api.DELETE("/orphans/:id", adminOnly, func(c *gin.Context) {
+		var orphan *InFlightUpload
+		for _, u := range uploads.Orphans() {
+			if u.ID == c.Param("id") {
+				orphan = &u
+				break
+			}
+		}
+		if orphan == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "orphaned upload not found"})
+			return
+		}
+
+		if c.Query("deleteDocument") == "true" && orphan.DocNo != 0 {
+			config, _ := LoadConfig()
+			token, _ := GetAuthToken()
+			client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+			if err := client.DeleteDocument(orphan.DocNo); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			webhooks.Emit(EventDocumentDeleted, WebhookEventData{DocNo: orphan.DocNo, Filename: orphan.Filename, User: currentRole(c)})
+		}
+
+		if _, err := uploads.Dismiss(orphan.ID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// Admin Only API Key Management
+	api.GET("/keys", adminOnly, func(c *gin.Context) {
+		c.JSON(http.StatusOK, apiKeys.List())
+	})
+
+	api.POST("/keys", adminOnly, func(c *gin.Context) {
+		var req struct {
+			Name       string   `json:"name"`
+			Scopes     []string `json:"scopes"`
+			CategoryNo int      `json:"categoryNo"`
+			ExpiresAt  string   `json:"expiresAt"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		key, plain, err := apiKeys.Create(req.Name, req.Scopes, req.CategoryNo, req.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// The plaintext key is only ever returned here
+		c.JSON(http.StatusOK, gin.H{"key": plain, "apiKey": key})
+	})
+
+	api.DELETE("/keys/:id", adminOnly, func(c *gin.Context) {
+		if err := apiKeys.Delete(c.Param("id")); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	api.GET("/keys/:id/usage", adminOnly, func(c *gin.Context) {
+		c.JSON(http.StatusOK, apiKeys.Usage(c.Param("id")))
+	})
+
+	// Admin Only Usage and Limits
+	api.GET("/usage", adminOnly, func(c *gin.Context) {
+		config, _ := LoadConfig()
+		limits := config.Limits.WithDefaults()
+
+		type userUsage struct {
+			UploadUsage
+			Quota UploadQuota `json:"quota"`
+		}
+		users := make(map[string]userUsage)
+		for user, usage := range uploadUsage.Snapshot() {
+			users[user] = userUsage{UploadUsage: usage, Quota: limits.QuotaFor(user)}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"limits":  limits,
+			"uploads": users,
+			"rateLimits": gin.H{
+				"failedLoginsByIP": limiter.Counts("login:", limits.LoginPerIP.window()),
+				"sharesByIP":       limiter.Counts("share-ip:", limits.SharePerIP.window()),
+				"sharesByUser":     limiter.Counts("share-user:", limits.SharePerUser.window()),
+			},
+		})
+	})
+
+	api.GET("/webhooks/deliveries", adminOnly, func(c *gin.Context) {
+		log, pending := webhooks.Deliveries()
+		c.JSON(http.StatusOK, gin.H{"log": log, "pending": pending})
+	})
+
+	// Admin Only Document Verification
+	api.GET("/documents/:docNo/verify", adminOnly, func(c *gin.Context) {
+		docNo, err := strconv.ParseInt(c.Param("docNo"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document number"})
+			return
+		}
+
+		config, _ := LoadConfig()
+		token, _ := GetAuthToken()
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+		result, _, err := FetchAndVerifyDocument(client, docNo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	api.GET("/documents/:docNo/download", adminOnly, func(c *gin.Context) {
+		docNo, err := strconv.ParseInt(c.Param("docNo"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document number"})
+			return
+		}
+
+		config, _ := LoadConfig()
+		token, _ := GetAuthToken()
+		client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token).WithContext(requestContext(c))
+		result, data, err := FetchAndVerifyDocument(client, docNo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		verified := "unknown"
+		if result.HasRecord {
+			verified = strconv.FormatBool(result.Verified)
+		}
+		c.Header("X-Content-SHA256", result.SHA256)
+		c.Header("X-Content-Verified", verified)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", result.Filename))
+		c.Data(http.StatusOK, "application/octet-stream", data)
 	})
 
 	// Serve static files from embedded FS
@@ -349,10 +1547,27 @@ func main() {
 			return
 		}
 
-		// Fallback to index.html for SPA
-		c.FileFromFS("/", http.FS(staticFS))
+		// Fallback to index.html for SPA, with the base path the browser resolves URLs against
+		index, err := fs.ReadFile(staticFS, "index.html")
+		if err != nil {
+			c.String(http.StatusNotFound, "frontend not built")
+			return
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", withBaseHref(index, proxies.BasePath(c.Request, basePath)))
 	})
 
-	fmt.Println("Web Server (Single Binary) running on http://localhost:8080")
-	r.Run(":8080")
+	srv := &http.Server{Addr: serverConfig.ListenAddress(), Handler: withBasePath(basePath, r)}
+	listen, scheme, err := configureTLS(srv, serverConfig)
+	if err != nil {
+		slog.Error("Failed to configure TLS", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Web Server (Single Binary) running", "address", srv.Addr, "scheme", scheme, "base_path", basePath)
+	err = serveUntilSignal(srv, listen, time.Duration(startConfig.ShutdownTimeoutSeconds)*time.Second, cancelUploads, uploads)
+	apiKeys.Flush()
+	if err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	metricsNamespace   = "thereforesharer"
+	readyCheckTimeout  = 5 * time.Second
+	readyCacheDuration = 10 * time.Second // Probes within this reuse the last readiness check
+)
+
+var (
+	sharesCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "shares_created_total",
+		Help:      "Shared links created, by how the share was published.",
+	}, []string{"via"})
+
+	uploadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "uploaded_bytes_total",
+		Help:      "Bytes uploaded to Therefore.",
+	})
+
+	uploadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upload_duration_seconds",
+		Help:      "Time taken to upload a document to Therefore.",
+		Buckets:   []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+
+	activeUploads = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_uploads",
+		Help:      "Share requests currently being processed.",
+	})
+
+	loginFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "login_failures_total",
+		Help:      "Portal logins rejected because of a wrong password.",
+	})
+
+	apiRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "therefore_api_request_duration_seconds",
+		Help:      "Latency of Therefore API calls by endpoint and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "status"})
+
+	apiErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "therefore_api_errors_total",
+		Help:      "Therefore API calls that failed or returned a non-2xx status, by endpoint and status.",
+	}, []string{"endpoint", "status"})
+)
+
+// instrumentedTransport records latency and errors of Therefore API calls. Other
+// requests, such as webhook deliveries, pass through unrecorded.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+// InstrumentTherefore wraps the default transport, which every ThereforeAPIClient uses
+func InstrumentTherefore() {
+	http.DefaultTransport = &instrumentedTransport{next: http.DefaultTransport}
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint, ok := thereforeEndpoint(req.URL.Path)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	apiRequestDuration.WithLabelValues(endpoint, status).Observe(time.Since(start).Seconds())
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErrors.WithLabelValues(endpoint, status).Inc()
+	}
+	return resp, err
+}
+
+// thereforeEndpoint returns the operation name of a Therefore REST API path
+func thereforeEndpoint(path string) (string, bool) {
+	i := strings.Index(path, "/restun/")
+	if i < 0 {
+		return "", false
+	}
+	op := path[i+len("/restun/"):]
+	return op[strings.LastIndex(op, "/")+1:], true
+}
+
+// readiness is the last readiness check, so that frequent probes don't each call Therefore
+var readiness struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// CheckReadyCached returns the result of CheckReady, checking again once the last
+// result is older than readyCacheDuration. Concurrent probes share one check.
+func CheckReadyCached() error {
+	readiness.mu.Lock()
+	defer readiness.mu.Unlock()
+	if !readiness.checkedAt.IsZero() && time.Since(readiness.checkedAt) < readyCacheDuration {
+		return readiness.err
+	}
+	readiness.err = CheckReady()
+	readiness.checkedAt = time.Now()
+	return readiness.err
+}
+
+// CheckReady reports why the server can't serve shares yet, nil when it can
+func CheckReady() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if !config.IsSetUp {
+		return fmt.Errorf("server is not configured yet")
+	}
+
+	token, _ := GetAuthToken()
+	client := NewThereforeAPIClient(config.BaseURL, config.TenantName, token)
+	client.HTTPClient = &http.Client{Timeout: readyCheckTimeout}
+	return client.TestConnection()
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigEnvPrefix starts the environment variables that override config fields
+const ConfigEnvPrefix = "THEREFORE_SHARER_"
+
+// ErrConfigReadOnly is returned when saving the config in read-only mode
+var ErrConfigReadOnly = errors.New("configuration is read-only")
+
+// Short flag names kept for the settings that had them before every field got a flag
+var configFlagAliases = map[string]string{
+	"listen":    "server.listen",
+	"tls-cert":  "server.tls_cert",
+	"tls-key":   "server.tls_key",
+	"auto-tls":  "server.auto_tls",
+	"base-path": "server.base_path",
+}
+
+// configSetting is a config field that can be set outside the config file
+type configSetting struct {
+	Key    string // JSON path, e.g. "limits.login_per_ip.requests"
+	Env    string // e.g. THEREFORE_SHARER_LIMITS_LOGIN_PER_IP_REQUESTS
+	Flag   string // e.g. limits-login-per-ip-requests
+	Secret bool
+	index  []int
+	kind   reflect.Kind
+}
+
+// configOverride is a value for a setting from the environment or the command line
+type configOverride struct {
+	Setting configSetting
+	Value   string
+	Source  string // e.g. "env THEREFORE_SHARER_BASE_URL" or "flag --base-url"
+}
+
+// Startup options, set once by ParseConfigOptions before anything reads the config
+var (
+	configOverrides []configOverride
+	configReadOnly  bool
+	dataDirOverride string
+)
+
+// configSettings lists every leaf field of Config. Nested structs such as limits or
+// server are flattened; slices, maps and lists of rules are single settings.
+func configSettings() []configSetting {
+	var settings []configSetting
+	var walk func(t reflect.Type, index []int, keys []string)
+	walk = func(t reflect.Type, index []int, keys []string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" || name == "-" || name == "schema_version" || !f.IsExported() {
+				continue
+			}
+			path := append(append([]string{}, keys...), name)
+			idx := append(append([]int{}, index...), i)
+			if f.Type.Kind() == reflect.Struct {
+				walk(f.Type, idx, path)
+				continue
+			}
+			settings = append(settings, configSetting{
+				Key:    strings.Join(path, "."),
+				Env:    ConfigEnvPrefix + strings.ToUpper(strings.Join(path, "_")),
+				Flag:   strings.ReplaceAll(strings.Join(path, "-"), "_", "-"),
+				Secret: isSensitiveKey(name),
+				index:  idx,
+				kind:   f.Type.Kind(),
+			})
+		}
+	}
+	walk(reflect.TypeOf(Config{}), nil, nil)
+	return settings
+}
+
+// ParseConfigOptions reads config overrides from the environment and the command line.
+// Precedence, highest first: flags, environment variables, the config file, defaults.
+// Every variable can also be given as <NAME>_FILE naming a file that holds the value,
+// which suits Docker and Kubernetes secrets. It reports whether --print-config was given.
+func ParseConfigOptions(args []string) (bool, error) {
+	settings := configSettings()
+	var envOverrides, flagOverrides []configOverride
+
+	for _, s := range settings {
+		value, source, err := lookupEnv(s.Env)
+		if err != nil {
+			return false, err
+		}
+		if source != "" {
+			envOverrides = append(envOverrides, configOverride{Setting: s, Value: value, Source: source})
+		}
+	}
+
+	// The Therefore credentials can be given instead of a ready-made auth_token
+	username, _, err := lookupEnv(ConfigEnvPrefix + "THEREFORE_USERNAME")
+	if err != nil {
+		return false, err
+	}
+	password, _, err := lookupEnv(ConfigEnvPrefix + "THEREFORE_PASSWORD")
+	if err != nil {
+		return false, err
+	}
+	dataDirOverride, _, err = lookupEnv(ConfigEnvPrefix + "DATA_DIR")
+	if err != nil {
+		return false, err
+	}
+	readOnly, _, err := lookupEnv(ConfigEnvPrefix + "READ_ONLY_CONFIG")
+	if err != nil {
+		return false, err
+	}
+	configReadOnly, _ = strconv.ParseBool(readOnly)
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	register := func(name string, s configSetting) {
+		set := func(v string) error {
+			flagOverrides = append(flagOverrides, configOverride{Setting: s, Value: v, Source: "flag --" + name})
+			return nil
+		}
+		if s.kind == reflect.Bool {
+			fs.BoolFunc(name, "sets "+s.Key, set)
+		} else {
+			fs.Func(name, "sets "+s.Key, set)
+		}
+		if s.Secret {
+			fs.Func(name+"-file", "sets "+s.Key+" from a file", func(path string) error {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				return set(strings.TrimSpace(string(data)))
+			})
+		}
+	}
+	byKey := make(map[string]configSetting)
+	for _, s := range settings {
+		register(s.Flag, s)
+		byKey[s.Key] = s
+	}
+	for alias, key := range configFlagAliases {
+		register(alias, byKey[key])
+	}
+	fs.StringVar(&username, "therefore-username", username, "Therefore user, sets auth_token with --therefore-password")
+	fs.StringVar(&password, "therefore-password", password, "Therefore password")
+	fs.StringVar(&dataDirOverride, "data-dir", dataDirOverride, "directory holding config.json and the server state, default ./data")
+	fs.BoolVar(&configReadOnly, "read-only-config", configReadOnly, "reject config changes through the API")
+	printConfig := fs.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	if err := fs.Parse(args); err != nil {
+		return false, err
+	}
+
+	overrides := append(envOverrides, flagOverrides...)
+	if username != "" || password != "" {
+		if username == "" || password == "" {
+			return false, fmt.Errorf("the Therefore username and password must be given together")
+		}
+		overrides = append(overrides,
+			configOverride{Setting: byKey["auth_type"], Value: "basic", Source: "Therefore credentials"},
+			configOverride{Setting: byKey["auth_token"], Value: CreateBasicAuthToken(username, password), Source: "Therefore credentials"},
+		)
+	}
+
+	// Reject bad values now rather than on the first request
+	if err := applyOverrides(&Config{}, overrides); err != nil {
+		return false, err
+	}
+	configOverrides = overrides
+	return *printConfig, nil
+}
+
+// lookupEnv returns the value of name, or the contents of the file named by name_FILE,
+// and which of the two it came from
+func lookupEnv(name string) (string, string, error) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, "env " + name, nil
+	}
+	if path, ok := os.LookupEnv(name + "_FILE"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimSpace(string(data)), "env " + name + "_FILE", nil
+	}
+	return "", "", nil
+}
+
+// applyOverrides sets the overridden fields of config, later overrides win
+func applyOverrides(config *Config, overrides []configOverride) error {
+	v := reflect.ValueOf(config).Elem()
+	for _, o := range overrides {
+		if err := setFromString(v.FieldByIndex(o.Setting.index), o.Value); err != nil {
+			return fmt.Errorf("%s: invalid value for %s: %w", o.Source, o.Setting.Key, err)
+		}
+	}
+	return nil
+}
+
+// keepFileValues copies the overridden fields from the config file into config, so
+// saving never writes environment or flag values into the file
+func keepFileValues(config, file *Config) {
+	dst := reflect.ValueOf(config).Elem()
+	src := reflect.ValueOf(file).Elem()
+	for _, o := range configOverrides {
+		dst.FieldByIndex(o.Setting.index).Set(src.FieldByIndex(o.Setting.index))
+	}
+}
+
+// OverriddenSettings returns the keys of the settings given outside the config file
+func OverriddenSettings() []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for _, o := range configOverrides {
+		if !seen[o.Setting.Key] {
+			seen[o.Setting.Key] = true
+			keys = append(keys, o.Setting.Key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setFromString parses s into v. Lists of strings or numbers may be comma separated and
+// string maps written as k=v,k2=v2; anything else, such as webhooks or rules, is JSON.
+func setFromString(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch {
+	case v.Kind() == reflect.Slice && !strings.HasPrefix(trimmed, "[") && isScalarKind(v.Type().Elem().Kind()):
+		parts := strings.Split(trimmed, ",")
+		list := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setFromString(list.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(list)
+		return nil
+	case v.Kind() == reflect.Map && !strings.HasPrefix(trimmed, "{") && v.Type().Key().Kind() == reflect.String && v.Type().Elem().Kind() == reflect.String:
+		m := reflect.MakeMap(v.Type())
+		for _, pair := range strings.Split(trimmed, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", pair)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), reflect.ValueOf(strings.TrimSpace(value)))
+		}
+		v.Set(m)
+		return nil
+	}
+
+	target := reflect.New(v.Type())
+	if err := json.Unmarshal([]byte(trimmed), target.Interface()); err != nil {
+		return err
+	}
+	v.Set(target.Elem())
+	return nil
+}
+
+func isScalarKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64, reflect.Bool:
+		return true
+	}
+	return false
+}
+
+// PrintConfig writes the effective config as JSON with secrets redacted, and lists
+// where overridden settings came from on stderr
+func PrintConfig(config *Config) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(redactSecrets(tree), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	fmt.Fprintf(os.Stderr, "config file: %s (read-only: %t)\n", GetConfigPath(), configReadOnly)
+	for _, o := range configOverrides {
+		fmt.Fprintf(os.Stderr, "%s from %s\n", o.Setting.Key, o.Source)
+	}
+	return nil
+}
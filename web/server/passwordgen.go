@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Password generator modes
+const (
+	PasswordModeCharacters = "characters"
+	PasswordModeWords      = "words"
+)
+
+const (
+	defaultPasswordLength = 20
+	defaultPasswordWords  = 6
+	minPasswordLength     = 8
+	maxPasswordLength     = 128
+	minPasswordWords      = 3
+	maxPasswordWords      = 20
+)
+
+// Character sets of generated passwords. Look-alikes such as l, 1, I, O and 0 are left
+// out so a password read out over the phone or copied from paper comes through intact.
+const (
+	passwordLowercase = "abcdefghijkmnopqrstuvwxyz"
+	passwordUppercase = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	passwordDigits    = "23456789"
+	passwordSymbols   = "!#$%&*+-=?@^_~"
+)
+
+//go:embed wordlist.txt
+var wordlistData string
+
+// passwordWords is the word list of diceware-style passwords, about 11 bits per word
+var passwordWords = strings.Fields(wordlistData)
+
+// PasswordOptions configures a generated password
+type PasswordOptions struct {
+	Mode string `json:"mode,omitempty"` // "characters" (default) or "words"
+
+	// Characters mode. Without any class selected all four are used, and the password
+	// has at least one character of each selected class.
+	Length    int  `json:"length,omitempty"` // Default 20
+	Lowercase bool `json:"lowercase,omitempty"`
+	Uppercase bool `json:"uppercase,omitempty"`
+	Digits    bool `json:"digits,omitempty"`
+	Symbols   bool `json:"symbols,omitempty"`
+
+	// Words mode
+	Words      int    `json:"words,omitempty"`      // Default 6
+	Separator  string `json:"separator,omitempty"`  // Default "-"
+	Capitalize bool   `json:"capitalize,omitempty"` // Capitalize each word
+	Number     bool   `json:"number,omitempty"`     // Append a random digit
+}
+
+// Validate checks the options, zero values mean the defaults
+func (o PasswordOptions) Validate() error {
+	v := &ValidationError{Subject: "password options"}
+	v.OneOf("mode", o.Mode, "", PasswordModeCharacters, PasswordModeWords)
+	if o.Length != 0 {
+		v.Range("length", int64(o.Length), minPasswordLength, maxPasswordLength)
+	}
+	if o.Words != 0 {
+		v.Range("words", int64(o.Words), minPasswordWords, maxPasswordWords)
+	}
+	if len(o.Separator) > 3 {
+		v.Add("separator", "must be at most 3 characters")
+	}
+	return v.Err()
+}
+
+// GeneratePassword returns a random password from a cryptographic source
+func GeneratePassword(o PasswordOptions) (string, error) {
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+	if strings.EqualFold(o.Mode, PasswordModeWords) {
+		return generatePassphrase(o)
+	}
+
+	length := o.Length
+	if length == 0 {
+		length = defaultPasswordLength
+	}
+	var classes []string
+	for _, c := range []struct {
+		on  bool
+		set string
+	}{{o.Lowercase, passwordLowercase}, {o.Uppercase, passwordUppercase}, {o.Digits, passwordDigits}, {o.Symbols, passwordSymbols}} {
+		if c.on {
+			classes = append(classes, c.set)
+		}
+	}
+	if len(classes) == 0 {
+		classes = []string{passwordLowercase, passwordUppercase, passwordDigits, passwordSymbols}
+	}
+
+	// One character of each class, the rest from all of them, then shuffled
+	all := strings.Join(classes, "")
+	password := make([]byte, 0, length)
+	for _, set := range classes {
+		b, err := randomChar(set)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, b)
+	}
+	for len(password) < length {
+		b, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, b)
+	}
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
+
+// generatePassphrase picks words from the embedded word list
+func generatePassphrase(o PasswordOptions) (string, error) {
+	count := o.Words
+	if count == 0 {
+		count = defaultPasswordWords
+	}
+	separator := o.Separator
+	if separator == "" {
+		separator = "-"
+	}
+
+	words := make([]string, count)
+	for i := range words {
+		n, err := randomIndex(len(passwordWords))
+		if err != nil {
+			return "", err
+		}
+		words[i] = passwordWords[n]
+		if o.Capitalize {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+	password := strings.Join(words, separator)
+	if o.Number {
+		b, err := randomChar(passwordDigits)
+		if err != nil {
+			return "", err
+		}
+		password += string(b)
+	}
+	return password, nil
+}
+
+// GenerateSharePassword generates a password that meets the share policy, raising the
+// length and the character classes of the options where the policy asks for more
+func GenerateSharePassword(o PasswordOptions, policy SharePolicy) (string, error) {
+	words := strings.EqualFold(o.Mode, PasswordModeWords)
+	if words {
+		if policy.MinPasswordClasses >= 3 {
+			o.Capitalize = true
+		}
+		if policy.MinPasswordClasses >= 4 {
+			o.Number = true
+		}
+	} else {
+		if o.Length == 0 {
+			o.Length = defaultPasswordLength
+		}
+		o.Length = min(max(o.Length, policy.MinPasswordLength), maxPasswordLength)
+		selected := 0
+		for _, on := range []bool{o.Lowercase, o.Uppercase, o.Digits, o.Symbols} {
+			if on {
+				selected++
+			}
+		}
+		if selected > 0 && selected < policy.MinPasswordClasses {
+			o.Lowercase, o.Uppercase, o.Digits, o.Symbols = true, true, true, true
+		}
+	}
+
+	// Passphrases get more words until they are long enough
+	passwordRules := SharePolicy{MinPasswordLength: policy.MinPasswordLength, MinPasswordClasses: policy.MinPasswordClasses}
+	for {
+		password, err := GeneratePassword(o)
+		if err != nil {
+			return "", err
+		}
+		if err := passwordRules.Check(password, nil); err == nil || !words || o.Words >= maxPasswordWords {
+			return password, nil
+		}
+		o.Words = max(o.Words, defaultPasswordWords) + 1
+	}
+}
+
+// randomChar returns a random byte of set
+func randomChar(set string) (byte, error) {
+	n, err := randomIndex(len(set))
+	if err != nil {
+		return 0, err
+	}
+	return set[n], nil
+}
+
+// randomIndex returns a uniformly random number in [0, n)
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate password: %w", err)
+	}
+	return int(i.Int64()), nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const recordsFileName = "shares.json"
+
+// recordsMu serialises access to the local share records file
+var recordsMu sync.Mutex
+
+// ShareRecord is the locally recorded state of a completed share
+type ShareRecord struct {
+	DocNo     int64    `json:"docNo"`
+	LinkID    string   `json:"linkId"`
+	URL       string   `json:"url"`
+	Filename  string   `json:"filename"`
+	SHA256    string   `json:"sha256"`
+	Size      int64    `json:"size"`
+	CreatedAt string   `json:"createdAt"`
+	ExpiresAt string   `json:"expiresAt,omitempty"`
+	Files     []string `json:"files,omitempty"`    // Original names of the uploaded files
+	SharedBy  string   `json:"sharedBy,omitempty"` // Portal role that created the share
+
+	Email *EmailDelivery `json:"email,omitempty"`
+
+	// DLP holds the data-loss-prevention rules the shared files matched
+	DLP []DLPMatch `json:"dlp,omitempty"`
+
+	// PasswordGenerated is set when the link password was generated. The password itself
+	// is never recorded.
+	PasswordGenerated bool `json:"passwordGenerated,omitempty"`
+
+	// Scan holds the virus scan result of each uploaded file, when scanning is enabled
+	Scan []ScanResult `json:"scan,omitempty"`
+
+	// ExpiryNotified is set once the link.expired webhook has been emitted
+	ExpiryNotified bool `json:"expiryNotified,omitempty"`
+}
+
+// EventData returns the webhook event data describing this share
+func (r ShareRecord) EventData() WebhookEventData {
+	return WebhookEventData{
+		DocNo:     r.DocNo,
+		LinkID:    r.LinkID,
+		URL:       r.URL,
+		Filename:  r.Filename,
+		Files:     r.Files,
+		User:      r.SharedBy,
+		ExpiresAt: r.ExpiresAt,
+	}
+}
+
+// GetRecordsPath returns the full path to the share records file, stored next to the config
+func GetRecordsPath() string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), recordsFileName)
+}
+
+// HashFileData returns the hex encoded SHA-256 of the given data
+func HashFileData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadShareRecords loads all share records from disk
+func LoadShareRecords() ([]ShareRecord, error) {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+	return loadShareRecords()
+}
+
+// loadShareRecords reads the records file, the caller must hold recordsMu
+func loadShareRecords() ([]ShareRecord, error) {
+	data, err := os.ReadFile(GetRecordsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ShareRecord{}, nil
+		}
+		return nil, fmt.Errorf("failed to read share records: %w", err)
+	}
+
+	var records []ShareRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse share records: %w", err)
+	}
+
+	return records, nil
+}
+
+// SaveShareRecord adds a record, replacing any existing record for the same document
+func SaveShareRecord(record ShareRecord) error {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+
+	records, err := loadShareRecords()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range records {
+		if records[i].DocNo == record.DocNo {
+			records[i] = record
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		records = append(records, record)
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal share records: %w", err)
+	}
+
+	if err := writeFileAtomic(GetRecordsPath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to write share records: %w", err)
+	}
+
+	return nil
+}
+
+// FindShareRecordByLink returns the record for a shared link, or nil if none was recorded
+func FindShareRecordByLink(linkID string) (*ShareRecord, error) {
+	records, err := LoadShareRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		if records[i].LinkID == linkID {
+			return &records[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// FindShareRecord returns the record for a document, or nil if none was recorded
+func FindShareRecord(docNo int64) (*ShareRecord, error) {
+	records, err := LoadShareRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		if records[i].DocNo == docNo {
+			return &records[i], nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rule names reported when no routing rule picked the category
+const (
+	RouteDefault    = "default category"
+	RouteUserChoice = "user choice"
+)
+
+// RoutingRule picks the upload category from the files being shared and who is sharing them.
+// Every condition that is set must match.
+type RoutingRule struct {
+	Name          string   `json:"name"`
+	CategoryNo    int      `json:"category_no"`
+	Extensions    []string `json:"extensions"` // Every file must have one of these
+	MinTotalBytes int64    `json:"min_total_bytes"`
+	MaxTotalBytes int64    `json:"max_total_bytes"`
+	Users         []string `json:"users"` // Web portal roles or "api:<key name>"
+}
+
+// RouteInput describes an upload for category routing
+type RouteInput struct {
+	FilePaths         []string
+	User              string // Empty in the desktop app
+	RequestedCategory int    // Explicit choice, must be in the allowed list
+}
+
+// CategoryRoute is the category an upload goes to and the rule that chose it
+type CategoryRoute struct {
+	CategoryNo int    `json:"categoryNo"`
+	Rule       string `json:"rule"`
+}
+
+// ResolveCategory picks the category for an upload. An explicit choice wins if it
+// is allowed, then the first matching rule, then the configured default category.
+func ResolveCategory(config *Config, input RouteInput) (*CategoryRoute, error) {
+	if input.RequestedCategory != 0 {
+		if input.RequestedCategory == config.CategoryNo {
+			return &CategoryRoute{CategoryNo: config.CategoryNo, Rule: RouteDefault}, nil
+		}
+		for _, no := range config.AllowedCategories {
+			if no == input.RequestedCategory {
+				return &CategoryRoute{CategoryNo: no, Rule: RouteUserChoice}, nil
+			}
+		}
+		return nil, fmt.Errorf("category %d is not one of the categories you may choose", input.RequestedCategory)
+	}
+
+	var totalSize int64
+	for _, path := range input.FilePaths {
+		if info, err := os.Stat(path); err == nil {
+			totalSize += info.Size()
+		}
+	}
+
+	for _, rule := range config.RoutingRules {
+		if rule.matches(input, totalSize) {
+			return &CategoryRoute{CategoryNo: rule.CategoryNo, Rule: rule.Name}, nil
+		}
+	}
+
+	return &CategoryRoute{CategoryNo: config.CategoryNo, Rule: RouteDefault}, nil
+}
+
+// matches reports whether every condition set on the rule holds for the upload
+func (r RoutingRule) matches(input RouteInput, totalSize int64) bool {
+	if r.CategoryNo == 0 {
+		return false
+	}
+	if r.MinTotalBytes > 0 && totalSize < r.MinTotalBytes {
+		return false
+	}
+	if r.MaxTotalBytes > 0 && totalSize > r.MaxTotalBytes {
+		return false
+	}
+	if len(r.Users) > 0 && !containsFold(r.Users, input.User) {
+		return false
+	}
+	if len(r.Extensions) > 0 {
+		for _, path := range input.FilePaths {
+			if !hasExtension(r.Extensions, path) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ValidateRoutingTargets checks that every category targeted by a rule or offered as a
+// choice still exists, returning one problem per missing category
+func ValidateRoutingTargets(config *Config, categories []CategoryWithPath) []string {
+	var problems []string
+	for _, rule := range config.RoutingRules {
+		if !categoryExists(categories, rule.CategoryNo) {
+			problems = append(problems, fmt.Sprintf("rule %q targets category %d, which no longer exists", rule.Name, rule.CategoryNo))
+		}
+	}
+	for _, no := range config.AllowedCategories {
+		if !categoryExists(categories, no) {
+			problems = append(problems, fmt.Sprintf("allowed category %d no longer exists", no))
+		}
+	}
+	return problems
+}
+
+// Verify checks that the routed category still exists
+func (r *CategoryRoute) Verify(categories []CategoryWithPath) error {
+	if !categoryExists(categories, r.CategoryNo) {
+		return fmt.Errorf("category %d selected by %q no longer exists", r.CategoryNo, r.Rule)
+	}
+	return nil
+}
+
+// AllowedCategoryChoices returns the categories a user may pick explicitly, the default first
+func AllowedCategoryChoices(config *Config, categories []CategoryWithPath) []CategoryWithPath {
+	var result []CategoryWithPath
+	seen := make(map[int]bool)
+	for _, no := range append([]int{config.CategoryNo}, config.AllowedCategories...) {
+		if seen[no] {
+			continue
+		}
+		seen[no] = true
+		for _, cat := range categories {
+			if cat.ItemNo == no {
+				result = append(result, cat)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func categoryExists(categories []CategoryWithPath, no int) bool {
+	for _, cat := range categories {
+		if cat.ItemNo == no {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExtension reports whether a file has one of the extensions, given with or without the dot
+func hasExtension(extensions []string, path string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	for _, e := range extensions {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Actions taken when a scanned upload is infected
+const (
+	ScanActionReject     = "reject"
+	ScanActionQuarantine = "quarantine"
+	ScanActionWarn       = "warn"
+)
+
+const (
+	clamdChunkSize      = 64 * 1024
+	defaultScanTimeout  = 60 * time.Second
+	quarantineDirName   = "quarantine"
+	defaultClamdAddress = "tcp://localhost:3310"
+)
+
+// ScanConfig configures virus scanning of uploads through clamd
+type ScanConfig struct {
+	Enabled        bool   `json:"enabled"`
+	Address        string `json:"address"` // "tcp://host:3310" or "unix:///path/to/clamd.sock"
+	Action         string `json:"action"`  // "reject", "quarantine" or "warn"
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// ScanResult is the outcome of scanning one file
+type ScanResult struct {
+	File      string `json:"file"`
+	Clean     bool   `json:"clean"`
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ClamdScanner scans data with clamd using the INSTREAM protocol
+type ClamdScanner struct {
+	Network string
+	Address string
+	Timeout time.Duration
+}
+
+// NewClamdScanner creates a scanner from the scan config
+func NewClamdScanner(config ScanConfig) (*ClamdScanner, error) {
+	address := config.Address
+	if address == "" {
+		address = defaultClamdAddress
+	}
+
+	scanner := &ClamdScanner{Timeout: defaultScanTimeout}
+	if config.TimeoutSeconds > 0 {
+		scanner.Timeout = time.Duration(config.TimeoutSeconds) * time.Second
+	}
+
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		scanner.Network = "unix"
+		scanner.Address = strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		scanner.Network = "tcp"
+		scanner.Address = strings.TrimPrefix(address, "tcp://")
+	default:
+		return nil, fmt.Errorf("invalid clamd address %q - must start with tcp:// or unix://", address)
+	}
+
+	return scanner, nil
+}
+
+// Scan streams r to clamd and returns whether it is clean, and the signature name if not
+func (s *ClamdScanner) Scan(r io.Reader) (bool, string, error) {
+	conn, err := net.DialTimeout(s.Network, s.Address, s.Timeout)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.Timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return false, "", fmt.Errorf("failed to start scan: %w", err)
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return false, "", fmt.Errorf("failed to send data to clamd: %w", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return false, "", fmt.Errorf("failed to send data to clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return false, "", fmt.Errorf("failed to read file for scanning: %w", readErr)
+		}
+	}
+
+	// A zero length chunk ends the stream
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return false, "", fmt.Errorf("failed to finish scan: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && err != io.EOF {
+		return false, "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply interprets replies such as "stream: OK" and "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (bool, string, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		return true, "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return false, strings.TrimSuffix(reply, " FOUND"), nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return false, "", fmt.Errorf("clamd error: %s", strings.TrimSuffix(reply, " ERROR"))
+	}
+	return false, "", fmt.Errorf("unexpected clamd reply: %q", reply)
+}
+
+// ScanFiles scans each file on disk, returning one result per file
+func (s *ClamdScanner) ScanFiles(paths []string) []ScanResult {
+	results := make([]ScanResult, 0, len(paths))
+	for _, path := range paths {
+		result := ScanResult{File: filepath.Base(path)}
+
+		f, err := os.Open(path)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		clean, signature, err := s.Scan(f)
+		f.Close()
+
+		result.Clean = clean
+		result.Signature = signature
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// QuarantineFile copies an infected upload into the quarantine directory next to the config
+func QuarantineFile(path string) (string, error) {
+	dir := filepath.Join(filepath.Dir(GetConfigPath()), quarantineDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(dir, time.Now().Format("20060102-150405")+"-"+filepath.Base(path))
+	if err := os.WriteFile(dest, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to quarantine file: %w", err)
+	}
+	return dest, nil
+}
+
+// describeScanFindings summarises infected or unscanned files for an error message
+func describeScanFindings(results []ScanResult) string {
+	var buf bytes.Buffer
+	for _, r := range results {
+		if r.Clean {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString(", ")
+		}
+		if r.Signature != "" {
+			fmt.Fprintf(&buf, "%s (%s)", r.File, r.Signature)
+		} else {
+			fmt.Fprintf(&buf, "%s (not scanned: %s)", r.File, r.Error)
+		}
+	}
+	return buf.String()
+}
+
+// ScanError blocks a share because an upload is infected or could not be scanned
+type ScanError struct {
+	Infected    bool     // False when clamd was unavailable or failed
+	Findings    string   // Summary of the affected files
+	Quarantined []string // Paths of quarantined copies
+}
+
+func (e *ScanError) Error() string {
+	if e.Infected {
+		return "upload blocked by virus scan: " + e.Findings
+	}
+	return "upload could not be virus scanned: " + e.Findings
+}
+
+// ScanUploads scans uploaded files according to the scan config. With the warn action
+// findings are only reported, otherwise a *ScanError is returned and with the quarantine
+// action infected files are copied aside. Files that can't be scanned are blocked unless
+// the action is warn.
+func ScanUploads(config ScanConfig, paths []string) ([]ScanResult, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	scanner, err := NewClamdScanner(config)
+	if err != nil {
+		return nil, err
+	}
+	results := scanner.ScanFiles(paths)
+
+	scanErr := &ScanError{}
+	for _, r := range results {
+		if r.Signature != "" {
+			scanErr.Infected = true
+		}
+	}
+	scanErr.Findings = describeScanFindings(results)
+	if scanErr.Findings == "" || config.Action == ScanActionWarn {
+		return results, nil
+	}
+
+	if scanErr.Infected && config.Action == ScanActionQuarantine {
+		for i, r := range results {
+			if r.Signature == "" {
+				continue
+			}
+			dest, err := QuarantineFile(paths[i])
+			if err != nil {
+				slog.Error("Failed to quarantine file", "file", r.File, "error", err)
+				continue
+			}
+			scanErr.Quarantined = append(scanErr.Quarantined, dest)
+		}
+	}
+	return results, scanErr
+}
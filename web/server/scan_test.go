@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// eicar is the EICAR anti-virus test file, split so the source itself isn't flagged
+var eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$` + `EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd serves the clamd INSTREAM protocol on a local port and flags streams
+// containing the EICAR test string. It returns the address for ScanConfig.
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn)
+		}
+	}()
+	return "tcp://" + ln.Addr().String()
+}
+
+func serveClamd(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString('\x00')
+	if err != nil || command != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var data bytes.Buffer
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, size); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		if _, err := io.CopyN(&data, r, int64(n)); err != nil {
+			return
+		}
+	}
+
+	if strings.Contains(data.String(), eicar) {
+		conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		clean     bool
+		signature string
+		wantErr   bool
+	}{
+		{"stream: OK\x00", true, "", false},
+		{"stream: Eicar-Test-Signature FOUND\x00", false, "Eicar-Test-Signature", false},
+		{"stream: INSTREAM size limit exceeded. ERROR\x00", false, "", true},
+		{"garbage", false, "", true},
+	}
+	for _, tt := range tests {
+		clean, signature, err := parseClamdReply(tt.reply)
+		if clean != tt.clean || signature != tt.signature || (err != nil) != tt.wantErr {
+			t.Errorf("parseClamdReply(%q) = %v, %q, %v", tt.reply, clean, signature, err)
+		}
+	}
+}
+
+func TestClamdScannerFlagsEICAR(t *testing.T) {
+	scanner, err := NewClamdScanner(ScanConfig{Address: fakeClamd(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clean, signature, err := scanner.Scan(strings.NewReader(eicar))
+	if err != nil || clean || signature != "Eicar-Test-Signature" {
+		t.Errorf("EICAR scan = %v, %q, %v, want infected", clean, signature, err)
+	}
+
+	// Larger than one chunk, so the stream is sent in several
+	clean, signature, err = scanner.Scan(bytes.NewReader(bytes.Repeat([]byte("clean "), clamdChunkSize)))
+	if err != nil || !clean || signature != "" {
+		t.Errorf("clean scan = %v, %q, %v, want clean", clean, signature, err)
+	}
+}
+
+func TestScanUploadsActions(t *testing.T) {
+	address := fakeClamd(t)
+
+	tests := []struct {
+		action      string
+		wantErr     bool
+		quarantined int
+	}{
+		{ScanActionReject, true, 0},
+		{ScanActionQuarantine, true, 1},
+		{ScanActionWarn, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			dataDirOverride = t.TempDir()
+			t.Cleanup(func() { dataDirOverride = "" })
+
+			dir := t.TempDir()
+			infected := filepath.Join(dir, "invoice.exe")
+			clean := filepath.Join(dir, "notes.txt")
+			os.WriteFile(infected, []byte(eicar), 0600)
+			os.WriteFile(clean, []byte("nothing to see"), 0600)
+
+			results, err := ScanUploads(ScanConfig{Enabled: true, Address: address, Action: tt.action}, []string{infected, clean})
+			if len(results) != 2 || results[0].Clean || results[0].Signature == "" || !results[1].Clean {
+				t.Fatalf("results = %+v", results)
+			}
+
+			var scanErr *ScanError
+			if tt.wantErr != errors.As(err, &scanErr) {
+				t.Fatalf("err = %v, want a ScanError: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			if !scanErr.Infected || !strings.Contains(scanErr.Findings, "invoice.exe (Eicar-Test-Signature)") {
+				t.Errorf("scan error = %+v", scanErr)
+			}
+			if len(scanErr.Quarantined) != tt.quarantined {
+				t.Fatalf("quarantined %v, want %d files", scanErr.Quarantined, tt.quarantined)
+			}
+			for _, path := range scanErr.Quarantined {
+				if data, err := os.ReadFile(path); err != nil || string(data) != eicar {
+					t.Errorf("quarantined copy %s: %v", path, err)
+				}
+				if filepath.Dir(path) != filepath.Join(dataDirOverride, quarantineDirName) {
+					t.Errorf("quarantined to %s, want the data directory", path)
+				}
+			}
+		})
+	}
+}
+
+func TestScanUploadsClamdUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := "tcp://" + ln.Addr().String()
+	ln.Close()
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("nothing to see"), 0600)
+
+	_, err = ScanUploads(ScanConfig{Enabled: true, Address: address, Action: ScanActionReject}, []string{path})
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) || scanErr.Infected {
+		t.Fatalf("err = %v, want an unscanned ScanError", err)
+	}
+
+	if _, err := ScanUploads(ScanConfig{Enabled: true, Address: address, Action: ScanActionWarn}, []string{path}); err != nil {
+		t.Errorf("warn action blocked an unscanned file: %v", err)
+	}
+}
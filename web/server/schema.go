@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FieldError is a validation failure of one config field
+type FieldError struct {
+	Field   string `json:"field"` // JSON path, e.g. "base_url" or "dlp_rules[0].patterns[1]"
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a config, or of what Subject names
+type ValidationError struct {
+	Subject string       `json:"-"` // What was validated, default "config"
+	Fields  []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	subject := e.Subject
+	if subject == "" {
+		subject = "config"
+	}
+	return "invalid " + subject + ": " + strings.Join(parts, "; ")
+}
+
+// Add records an invalid field
+func (e *ValidationError) Add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns the error, or nil when no field was invalid
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// URL checks that value is an http or https URL, or empty when not required
+func (e *ValidationError) URL(field, value string, required bool) {
+	if value == "" {
+		if required {
+			e.Add(field, "is required")
+		}
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		e.Add(field, "must be an http or https URL")
+	}
+}
+
+// OneOf checks that value is one of allowed
+func (e *ValidationError) OneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return
+		}
+	}
+	quoted := make([]string, 0, len(allowed))
+	for _, a := range allowed {
+		if a != "" {
+			quoted = append(quoted, `"`+a+`"`)
+		}
+	}
+	e.Add(field, "must be one of %s", strings.Join(quoted, ", "))
+}
+
+// Range checks that n is between min and max inclusive
+func (e *ValidationError) Range(field string, n, min, max int64) {
+	if n < min || n > max {
+		e.Add(field, "must be between %d and %d", min, max)
+	}
+}
+
+// NotNegative checks that n is zero or more
+func (e *ValidationError) NotNegative(field string, n int64) {
+	if n < 0 {
+		e.Add(field, "must not be negative")
+	}
+}
+
+// Email checks that value is a mail address, or empty
+func (e *ValidationError) Email(field, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := mail.ParseAddress(value); err != nil {
+		e.Add(field, "must be an email address")
+	}
+}
+
+// validateSMTP checks the email delivery settings shared by both apps
+func validateSMTP(e *ValidationError, host string, port int, security, from string) {
+	e.Range("smtp_port", int64(port), 0, 65535)
+	e.OneOf("smtp_security", security, "", SMTPSecurityNone, SMTPSecurityStartTLS, SMTPSecurityTLS)
+	e.Email("smtp_from", from)
+	if host != "" && from == "" {
+		e.Add("smtp_from", "is required when smtp_host is set")
+	}
+}
+
+// validateDLPRules checks actions, detectors and that every pattern compiles
+func validateDLPRules(e *ValidationError, rules []DLPRule) {
+	for i, r := range rules {
+		field := fmt.Sprintf("dlp_rules[%d]", i)
+		e.OneOf(field+".action", r.Action, DLPActionBlock, DLPActionRequireProtect, DLPActionRequireApproval)
+		for j, p := range r.Patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				e.Add(fmt.Sprintf("%s.patterns[%d]", field, j), "is not a valid regular expression: %v", err)
+			}
+		}
+		for j, d := range r.Detectors {
+			e.OneOf(fmt.Sprintf("%s.detectors[%d]", field, j), d, DetectorCreditCard, DetectorIBAN)
+		}
+		for j, g := range r.FilenamePatterns {
+			if _, err := filepath.Match(g, ""); err != nil {
+				e.Add(fmt.Sprintf("%s.filename_patterns[%d]", field, j), "is not a valid pattern")
+			}
+		}
+		e.NotNegative(field+".max_file_bytes", r.MaxFileBytes)
+		e.NotNegative(field+".max_expiry_days", int64(r.MaxExpiryDays))
+	}
+}
+
+// validateRouting checks that routing rules and allowed categories name real category numbers
+func validateRouting(e *ValidationError, rules []RoutingRule, allowed []int) {
+	for i, r := range rules {
+		field := fmt.Sprintf("routing_rules[%d]", i)
+		if r.CategoryNo <= 0 {
+			e.Add(field+".category_no", "must be a positive category number")
+		}
+		e.NotNegative(field+".min_total_bytes", r.MinTotalBytes)
+		e.NotNegative(field+".max_total_bytes", r.MaxTotalBytes)
+		if r.MaxTotalBytes > 0 && r.MinTotalBytes > r.MaxTotalBytes {
+			e.Add(field+".max_total_bytes", "must not be below min_total_bytes")
+		}
+	}
+	for i, n := range allowed {
+		if n <= 0 {
+			e.Add(fmt.Sprintf("allowed_categories[%d]", i), "must be a positive category number")
+		}
+	}
+}
+
+// validateSharePolicies checks the share policies of a config
+func validateSharePolicies(e *ValidationError, policies []SharePolicy) {
+	for i, p := range policies {
+		field := fmt.Sprintf("share_policies[%d]", i)
+		if strings.TrimSpace(p.Name) == "" {
+			e.Add(field+".name", "is required")
+		}
+		for j, no := range p.Categories {
+			if no <= 0 {
+				e.Add(fmt.Sprintf("%s.categories[%d]", field, j), "must be a positive category number")
+			}
+		}
+		e.NotNegative(field+".min_password_length", int64(p.MinPasswordLength))
+		e.Range(field+".min_password_classes", int64(p.MinPasswordClasses), 0, 4)
+		e.NotNegative(field+".max_expiry_days", int64(p.MaxExpiryDays))
+		e.NotNegative(field+".default_expiry_days", int64(p.DefaultExpiryDays))
+		if p.MaxExpiryDays > 0 && p.DefaultExpiryDays > p.MaxExpiryDays {
+			e.Add(field+".default_expiry_days", "must not exceed max_expiry_days")
+		}
+	}
+}
+
+// validateObservability checks the logging and tracing settings
+func validateObservability(e *ValidationError, logging LogConfig, tracing TracingConfig) {
+	e.OneOf("logging.level", logging.Level, "", "debug", "info", "warn", "error")
+	e.OneOf("logging.format", logging.Format, "", LogFormatText, LogFormatJSON)
+	e.URL("tracing.endpoint", tracing.Endpoint, false)
+	if tracing.SampleRatio < 0 || tracing.SampleRatio > 1 {
+		e.Add("tracing.sample_ratio", "must be between 0 and 1")
+	}
+}
+
+// configMigration upgrades a stored config to schema version To from the version before it
+type configMigration struct {
+	To          int
+	Description string
+	Migrate     func(raw map[string]json.RawMessage) error
+}
+
+// migrateConfig brings the config file contents up to the last migration's version,
+// running the migrations it has not had yet in order. With persist set, the file as it
+// was before each migration is kept next to it as <name>.v<version>-<time>.bak.
+// It reports whether any migration ran.
+func migrateConfig(path string, data []byte, migrations []configMigration, persist bool) ([]byte, bool, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	version := 0
+	if v, ok := raw["schema_version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, false, fmt.Errorf("invalid schema_version: %w", err)
+		}
+	}
+	latest := migrations[len(migrations)-1].To
+	if version > latest {
+		return nil, false, fmt.Errorf("config schema version %d is newer than this version of the app supports (%d)", version, latest)
+	}
+
+	migrated := false
+	for _, m := range migrations {
+		if m.To <= version {
+			continue
+		}
+		if persist {
+			backup := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102-150405"))
+			if err := writeFileAtomic(backup, data, 0600); err != nil {
+				return nil, false, fmt.Errorf("failed to back up config before migration: %w", err)
+			}
+			slog.Info("Backed up config before migration", "path", backup)
+		}
+		if err := m.Migrate(raw); err != nil {
+			return nil, false, fmt.Errorf("config migration to version %d failed: %w", m.To, err)
+		}
+		raw["schema_version"], _ = json.Marshal(m.To)
+
+		next, err := json.Marshal(raw)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to encode migrated config: %w", err)
+		}
+		slog.Info("Migrated config", "from", version, "to", m.To, "migration", m.Description)
+		data, version, migrated = next, m.To, true
+	}
+	return data, migrated, nil
+}
+
+// rawString returns a string field of a raw config, or ""
+func rawString(raw map[string]json.RawMessage, key string) string {
+	var s string
+	if v, ok := raw[key]; ok {
+		json.Unmarshal(v, &s)
+	}
+	return s
+}
+
+// setRawString sets a string field of a raw config
+func setRawString(raw map[string]json.RawMessage, key, value string) {
+	raw[key], _ = json.Marshal(value)
+}
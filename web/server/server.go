@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultListenAddress = ":8080"
+	tlsDirName           = "tls"
+	localCACertFile      = "local-ca.crt"
+	localCAKeyFile       = "local-ca.key"
+
+	CookieSecureAuto   = "auto"
+	CookieSecureAlways = "always"
+	CookieSecureNever  = "never"
+)
+
+// Origins allowed by CORS when none are configured, the Vite dev server
+var defaultCORSOrigins = []string{"http://localhost:5173", "http://127.0.0.1:5173"}
+
+// ServerConfig configures how the web server listens and how it is reached
+type ServerConfig struct {
+	Listen         string   `json:"listen"`                     // Listen address, default ":8080"
+	TLSCert        string   `json:"tls_cert,omitempty"`         // PEM certificate file, HTTPS is served when set with TLSKey
+	TLSKey         string   `json:"tls_key,omitempty"`          // PEM private key file
+	AutoTLS        bool     `json:"auto_tls,omitempty"`         // Serve HTTPS with a certificate from a local test CA
+	TLSHosts       []string `json:"tls_hosts,omitempty"`        // Extra host names for the auto TLS certificate
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`  // IPs or CIDRs whose X-Forwarded-* headers are believed
+	BasePath       string   `json:"base_path,omitempty"`        // Prefix when hosted under a sub-URL, e.g. "/sharer"
+	CORSOrigins    []string `json:"cors_origins,omitempty"`     // Browser origins allowed to call the API, default the Vite dev server
+	CookieSecure   string   `json:"cookie_secure,omitempty"`    // "auto", "always" or "never", auto marks cookies Secure over HTTPS
+	CookieSameSite string   `json:"cookie_same_site,omitempty"` // "lax", "strict" or "none", default lax
+}
+
+// ListenAddress returns the configured listen address or the default
+func (s ServerConfig) ListenAddress() string {
+	if s.Listen == "" {
+		return defaultListenAddress
+	}
+	return s.Listen
+}
+
+// NormalizedBasePath returns the base path with a leading and without a trailing slash,
+// or "" when the server is hosted at the root
+func (s ServerConfig) NormalizedBasePath() string {
+	p := strings.Trim(strings.TrimSpace(s.BasePath), "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// AllowedOrigins returns the configured CORS origins or the dev server defaults
+func (s ServerConfig) AllowedOrigins() []string {
+	if len(s.CORSOrigins) == 0 {
+		return defaultCORSOrigins
+	}
+	return s.CORSOrigins
+}
+
+// SameSite returns the SameSite mode for session cookies
+func (s ServerConfig) SameSite() http.SameSite {
+	switch strings.ToLower(s.CookieSameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// ProxyTrust decides which X-Forwarded-* headers to believe, only those sent by trusted proxies
+type ProxyTrust struct {
+	nets []*net.IPNet
+}
+
+// NewProxyTrust parses trusted proxy IPs and CIDRs
+func NewProxyTrust(proxies []string) (*ProxyTrust, error) {
+	p := &ProxyTrust{}
+	for _, s := range proxies {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", s)
+		}
+		p.nets = append(p.nets, n)
+	}
+	return p, nil
+}
+
+// Trusted reports whether the request came directly from a trusted proxy
+func (p *ProxyTrust) Trusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHTTPS reports whether the client reached the server over HTTPS, directly or
+// through a trusted proxy that set X-Forwarded-Proto
+func (p *ProxyTrust) IsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return p.Trusted(r) && strings.EqualFold(firstForwardedValue(r.Header.Get("X-Forwarded-Proto")), "https")
+}
+
+// BasePath returns the prefix the client sees: X-Forwarded-Prefix from a trusted proxy
+// that strips the prefix itself, otherwise the configured base path
+func (p *ProxyTrust) BasePath(r *http.Request, configured string) string {
+	if p.Trusted(r) {
+		if prefix := firstForwardedValue(r.Header.Get("X-Forwarded-Prefix")); prefix != "" {
+			return ServerConfig{BasePath: prefix}.NormalizedBasePath()
+		}
+	}
+	return configured
+}
+
+func firstForwardedValue(v string) string {
+	first, _, _ := strings.Cut(v, ",")
+	return strings.TrimSpace(first)
+}
+
+// setSessionCookie sets or, with a negative maxAge, clears the session cookie. It is
+// scoped to the base path and marked Secure when the client uses HTTPS.
+func setSessionCookie(c *gin.Context, config ServerConfig, proxies *ProxyTrust, value string, maxAge int) {
+	secure := proxies.IsHTTPS(c.Request)
+	switch config.CookieSecure {
+	case CookieSecureAlways:
+		secure = true
+	case CookieSecureNever:
+		secure = false
+	}
+	sameSite := config.SameSite()
+	if sameSite == http.SameSiteNoneMode {
+		secure = true // Browsers drop SameSite=None cookies without Secure
+	}
+
+	path := proxies.BasePath(c.Request, config.NormalizedBasePath())
+	if path == "" {
+		path = "/"
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(sessionCookieName, value, maxAge, path, "", secure, true)
+}
+
+// withBasePath serves h under prefix. Requests outside it get a 404, the bare
+// prefix is redirected to prefix + "/".
+func withBasePath(prefix string, h http.Handler) http.Handler {
+	if prefix == "" {
+		return h
+	}
+	stripped := http.StripPrefix(prefix, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix:
+			target := prefix + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			stripped.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// withBaseHref adds a <base> element to index.html so relative asset and API URLs
+// resolve under the base path, whatever page the SPA was loaded from
+func withBaseHref(index []byte, basePath string) []byte {
+	tag := fmt.Sprintf(`<base href="%s/">`, html.EscapeString(basePath))
+	return []byte(strings.Replace(string(index), "<head>", "<head>\n    "+tag, 1))
+}
+
+// configureTLS sets up HTTPS on srv from the configured certificate or the local test CA,
+// and returns the function that starts listening
+func configureTLS(srv *http.Server, config ServerConfig) (func() error, string, error) {
+	switch {
+	case config.TLSCert != "" || config.TLSKey != "":
+		if config.TLSCert == "" || config.TLSKey == "" {
+			return nil, "", fmt.Errorf("both tls_cert and tls_key are required for HTTPS")
+		}
+		return func() error { return srv.ListenAndServeTLS(config.TLSCert, config.TLSKey) }, "https", nil
+	case config.AutoTLS:
+		cert, caPath, err := localCACertificate(config.TLSHosts)
+		if err != nil {
+			return nil, "", err
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		slog.Warn("Serving HTTPS with a certificate from the local test CA, trust its certificate in the browser to avoid warnings", "ca_cert", caPath)
+		return func() error { return srv.ListenAndServeTLS("", "") }, "https", nil
+	default:
+		return srv.ListenAndServe, "http", nil
+	}
+}
+
+// localCACertificate loads or creates a CA in data/tls and issues a server certificate
+// for localhost, this machine and hosts. The CA is kept so it only has to be trusted once.
+func localCACertificate(hosts []string) (tls.Certificate, string, error) {
+	dir := filepath.Join(filepath.Dir(GetConfigPath()), tlsDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("failed to create TLS directory: %w", err)
+	}
+	caCertPath := filepath.Join(dir, localCACertFile)
+	caKeyPath := filepath.Join(dir, localCAKeyFile)
+
+	caCert, caKey, err := loadLocalCA(caCertPath, caKeyPath)
+	if err != nil {
+		if caCert, caKey, err = createLocalCA(caCertPath, caKeyPath); err != nil {
+			return tls.Certificate{}, "", err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("failed to generate server key: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: "ThereforeSharer Web"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, 90),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	names := append([]string{"localhost", "127.0.0.1", "::1"}, hosts...)
+	if hostname, err := os.Hostname(); err == nil {
+		names = append(names, hostname)
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if name != "" {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("failed to issue server certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der, caCert.Raw}, PrivateKey: key}, caCertPath, nil
+}
+
+func loadLocalCA(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("invalid local CA files")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(cert.NotAfter.Add(-24 * time.Hour)) {
+		return nil, nil, fmt.Errorf("local CA has expired")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func createLocalCA(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "ThereforeSharer Local Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode CA key: %w", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to write CA key: %w", err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	slog.Info("Created local test CA", "ca_cert", certPath)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func randomSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 120))
+	return serial
+}
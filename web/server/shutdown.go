@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	uploadJournalFileName  = "uploads_in_flight.json"
+	uploadTempDirName      = "uploads" // Temp files of uploads in progress, in the data directory
+	defaultShutdownTimeout = 30 * time.Second
+	uploadCancelGrace      = 5 * time.Second // Time cancelled uploads get to record their outcome
+)
+
+// InFlightUpload is an upload that may leave a document in Therefore without a shared link
+type InFlightUpload struct {
+	ID         string `json:"id"`
+	DocNo      int64  `json:"docNo,omitempty"` // 0 until CreateDocument returned
+	Filename   string `json:"filename"`
+	SharedBy   string `json:"sharedBy"`
+	StartedAt  string `json:"startedAt"`
+	OrphanedAt string `json:"orphanedAt,omitempty"` // Set once the upload can no longer finish
+	Reason     string `json:"reason,omitempty"`
+}
+
+// UploadJournal records uploads between CreateDocument and CreateSharedLink, so documents
+// left without a link by a crash, restart or failed link creation can be found again
+type UploadJournal struct {
+	mu       sync.Mutex
+	items    []InFlightUpload
+	inFlight sync.WaitGroup
+}
+
+func uploadJournalPath() string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), uploadJournalFileName)
+}
+
+// NewUploadJournal loads the journal. Uploads the previous run never finished are
+// reported as orphans.
+func NewUploadJournal() *UploadJournal {
+	j := &UploadJournal{}
+	if err := readJSONFile(uploadJournalPath(), &j.items); err != nil {
+		slog.Error("Failed to load upload journal", "error", err)
+	}
+
+	changed := false
+	for i := range j.items {
+		u := &j.items[i]
+		if u.OrphanedAt == "" {
+			u.OrphanedAt = time.Now().Format(time.RFC3339)
+			u.Reason = "server stopped during the upload"
+			changed = true
+		}
+		if u.DocNo != 0 {
+			slog.Warn("Document was created without a shared link", "doc_no", u.DocNo, "filename", u.Filename, "shared_by", u.SharedBy, "reason", u.Reason)
+		} else {
+			slog.Warn("Upload was interrupted, its document may exist without a shared link", "filename", u.Filename, "shared_by", u.SharedBy, "started_at", u.StartedAt)
+		}
+	}
+	if changed {
+		j.mu.Lock()
+		j.saveLocked()
+		j.mu.Unlock()
+	}
+	return j
+}
+
+// Begin records an upload about to be sent to Therefore and returns its ID
+func (j *UploadJournal) Begin(filename, user string) string {
+	j.inFlight.Add(1)
+	u := InFlightUpload{
+		ID:        newRandomID(),
+		Filename:  filename,
+		SharedBy:  user,
+		StartedAt: time.Now().Format(time.RFC3339),
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.items = append(j.items, u)
+	j.saveLocked()
+	return u.ID
+}
+
+// SetDocument records the document an upload created
+func (j *UploadJournal) SetDocument(id string, docNo int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range j.items {
+		if j.items[i].ID == id {
+			j.items[i].DocNo = docNo
+			j.saveLocked()
+			return
+		}
+	}
+}
+
+// Finish removes an upload that got its link, or that never created a document
+func (j *UploadJournal) Finish(id string) {
+	defer j.inFlight.Done()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.removeLocked(id)
+}
+
+// Orphan keeps an upload whose document could not be shared for an admin to clean up
+func (j *UploadJournal) Orphan(id, reason string) {
+	defer j.inFlight.Done()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range j.items {
+		if j.items[i].ID == id {
+			j.items[i].OrphanedAt = time.Now().Format(time.RFC3339)
+			j.items[i].Reason = reason
+			slog.Warn("Document was created without a shared link", "doc_no", j.items[i].DocNo, "filename", j.items[i].Filename, "reason", reason)
+			j.saveLocked()
+			return
+		}
+	}
+}
+
+// Orphans returns the uploads left without a link, newest first
+func (j *UploadJournal) Orphans() []InFlightUpload {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	result := make([]InFlightUpload, 0)
+	for i := len(j.items) - 1; i >= 0; i-- {
+		if j.items[i].OrphanedAt != "" {
+			result = append(result, j.items[i])
+		}
+	}
+	return result
+}
+
+// Dismiss removes an orphan once it has been dealt with
+func (j *UploadJournal) Dismiss(id string) (*InFlightUpload, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range j.items {
+		if j.items[i].ID == id && j.items[i].OrphanedAt != "" {
+			u := j.items[i]
+			j.removeLocked(id)
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("orphaned upload not found")
+}
+
+// Wait blocks until in-flight uploads have finished or the timeout passes
+func (j *UploadJournal) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		j.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (j *UploadJournal) removeLocked(id string) {
+	for i := range j.items {
+		if j.items[i].ID == id {
+			j.items = append(j.items[:i], j.items[i+1:]...)
+			j.saveLocked()
+			return
+		}
+	}
+}
+
+// saveLocked persists the journal, the caller must hold j.mu
+func (j *UploadJournal) saveLocked() {
+	if err := writeJSONFile(uploadJournalPath(), j.items); err != nil {
+		slog.Error("Failed to save upload journal", "error", err)
+	}
+}
+
+// uploadTempRoot returns the directory holding the temp directories of uploads. It is
+// kept in the data directory so that other instances on the host have their own.
+func uploadTempRoot() string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), uploadTempDirName)
+}
+
+// newUploadTempDir creates the temp directory of an upload
+func newUploadTempDir() (string, error) {
+	root := uploadTempRoot()
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(root, "upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return dir, nil
+}
+
+// removeStaleUploadDirs deletes temp directories left behind by uploads of a previous run
+func removeStaleUploadDirs() {
+	dirs, _ := filepath.Glob(filepath.Join(uploadTempRoot(), "*"))
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Error("Failed to remove stale upload directory", "path", dir, "error", err)
+		}
+	}
+	if len(dirs) > 0 {
+		slog.Info("Removed stale upload directories", "count", len(dirs))
+	}
+}
+
+// serveUntilSignal runs the server until SIGINT or SIGTERM, then stops accepting
+// connections and waits up to timeout for in-flight requests. Uploads still running
+// after that are cancelled through cancelUploads.
+func serveUntilSignal(srv *http.Server, listen func() error, timeout time.Duration, cancelUploads context.CancelFunc, journal *UploadJournal) error {
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- listen()
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, draining in-flight requests", "timeout", timeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(drainCtx); err != nil {
+		slog.Warn("Drain timeout reached, cancelling in-flight uploads", "error", err)
+		cancelUploads()
+		if !journal.Wait(uploadCancelGrace) {
+			slog.Error("Uploads still running at exit, their documents will be reported as orphans on the next start")
+		}
+		srv.Close()
+	}
+	cancelUploads()
+	slog.Info("Server stopped")
+	return nil
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Webhook event types
+const (
+	EventShareCreated    = "share.created"
+	EventLinkRevoked     = "link.revoked"
+	EventDocumentDeleted = "document.deleted"
+	EventLinkExpired     = "link.expired"
+
+	EventApprovalRequested = "approval.requested"
+	EventApprovalApproved  = "approval.approved"
+	EventApprovalRejected  = "approval.rejected"
+	EventApprovalExpired   = "approval.expired"
+)
+
+const (
+	webhookQueueFileName = "webhook_queue.json"
+	webhookLogFileName   = "webhook_log.json"
+	webhookSignature     = "X-ThereforeSharer-Signature"
+	webhookMaxAttempts   = 10
+	webhookMaxLogEntries = 500
+	webhookPollInterval  = 15 * time.Second
+	expiryCheckInterval  = time.Minute
+)
+
+// WebhookTarget is an admin configured endpoint that receives share events
+type WebhookTarget struct {
+	ID      string   `json:"id"`
+	URL     string   `json:"url"`
+	Secret  string   `json:"secret,omitempty"` // Not returned by GET /api/config
+	Events  []string `json:"events"`           // Empty means all events
+	Enabled bool     `json:"enabled"`
+}
+
+// wants reports whether the target is subscribed to an event
+func (t WebhookTarget) wants(event string) bool {
+	if !t.Enabled || t.URL == "" {
+		return false
+	}
+	if len(t.Events) == 0 {
+		return true
+	}
+	for _, e := range t.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareWebhookTargets gives new targets an ID and every target a secret, so that
+// queued deliveries can be matched to their target and every payload is signed.
+// A target saved without a secret keeps the one already stored for its ID.
+func prepareWebhookTargets(targets, existing []WebhookTarget) {
+	for i := range targets {
+		if targets[i].ID == "" {
+			targets[i].ID = newRandomID()
+		}
+		if targets[i].Secret != "" {
+			continue
+		}
+		for _, w := range existing {
+			if w.ID == targets[i].ID {
+				targets[i].Secret = w.Secret
+			}
+		}
+		if targets[i].Secret == "" {
+			targets[i].Secret = newRandomID()
+		}
+	}
+}
+
+// WebhookEventData is the share information carried by every event
+type WebhookEventData struct {
+	DocNo     int64    `json:"docNo"`
+	LinkID    string   `json:"linkId,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Filename  string   `json:"filename,omitempty"`
+	Files     []string `json:"files,omitempty"`
+	User      string   `json:"user,omitempty"`
+	ExpiresAt string   `json:"expiresAt,omitempty"`
+
+	// Set for approval events
+	ApprovalID string `json:"approvalId,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+}
+
+// WebhookPayload is the JSON body posted to webhook targets
+type WebhookPayload struct {
+	ID        string           `json:"id"`
+	Event     string           `json:"event"`
+	Timestamp string           `json:"timestamp"`
+	Data      WebhookEventData `json:"data"`
+}
+
+// WebhookDelivery is a queued payload waiting to be delivered to one target
+type WebhookDelivery struct {
+	ID          string          `json:"id"`
+	TargetID    string          `json:"targetId"`
+	URL         string          `json:"url"`
+	Event       string          `json:"event"`
+	Body        json.RawMessage `json:"body"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+}
+
+// WebhookLogEntry records the outcome of a single delivery attempt
+type WebhookLogEntry struct {
+	DeliveryID string `json:"deliveryId"`
+	TargetID   string `json:"targetId"`
+	URL        string `json:"url"`
+	Event      string `json:"event"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Success    bool   `json:"success"`
+	GaveUp     bool   `json:"gaveUp,omitempty"`
+	Time       string `json:"time"`
+}
+
+// WebhookDispatcher delivers events asynchronously from a persistent retry queue
+type WebhookDispatcher struct {
+	mu     sync.Mutex
+	queue  []WebhookDelivery
+	log    []WebhookLogEntry
+	client *http.Client
+	wake   chan struct{}
+}
+
+// NewWebhookDispatcher creates a dispatcher, restoring any queued deliveries from disk
+func NewWebhookDispatcher() *WebhookDispatcher {
+	d := &WebhookDispatcher{
+		client: &http.Client{Timeout: 15 * time.Second},
+		wake:   make(chan struct{}, 1),
+	}
+	if err := readJSONFile(webhookDataPath(webhookQueueFileName), &d.queue); err != nil {
+		slog.Error("Failed to load webhook queue", "error", err)
+	}
+	if err := readJSONFile(webhookDataPath(webhookLogFileName), &d.log); err != nil {
+		slog.Error("Failed to load webhook log", "error", err)
+	}
+	return d
+}
+
+// webhookDataPath returns the path of a webhook state file, stored next to the config
+func webhookDataPath(name string) string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), name)
+}
+
+// Start runs the delivery loop and the expired link check in the background
+func (d *WebhookDispatcher) Start() {
+	go func() {
+		poll := time.NewTicker(webhookPollInterval)
+		expiry := time.NewTicker(expiryCheckInterval)
+		defer poll.Stop()
+		defer expiry.Stop()
+
+		d.deliverDue()
+		for {
+			select {
+			case <-d.wake:
+				d.deliverDue()
+			case <-poll.C:
+				d.deliverDue()
+			case <-expiry.C:
+				d.checkExpiredLinks()
+			}
+		}
+	}()
+}
+
+// Emit queues an event for every target subscribed to it
+func (d *WebhookDispatcher) Emit(event string, data WebhookEventData) {
+	config, err := LoadConfig()
+	if err != nil || len(config.Webhooks) == 0 {
+		return
+	}
+
+	payload := WebhookPayload{
+		ID:        newRandomID(),
+		Event:     event,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Data:      data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to marshal webhook payload", "error", err)
+		return
+	}
+
+	d.mu.Lock()
+	queued := false
+	for _, target := range config.Webhooks {
+		if !target.wants(event) {
+			continue
+		}
+		d.queue = append(d.queue, WebhookDelivery{
+			ID:          newRandomID(),
+			TargetID:    target.ID,
+			URL:         target.URL,
+			Event:       event,
+			Body:        body,
+			NextAttempt: time.Now(),
+		})
+		queued = true
+	}
+	if queued {
+		d.saveQueueLocked()
+	}
+	d.mu.Unlock()
+
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Deliveries returns the delivery log (newest first) and the pending queue
+func (d *WebhookDispatcher) Deliveries() ([]WebhookLogEntry, []WebhookDelivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	log := make([]WebhookLogEntry, 0, len(d.log))
+	for i := len(d.log) - 1; i >= 0; i-- {
+		log = append(log, d.log[i])
+	}
+	pending := make([]WebhookDelivery, len(d.queue))
+	copy(pending, d.queue)
+	return log, pending
+}
+
+// deliverDue attempts every queued delivery whose retry time has passed
+func (d *WebhookDispatcher) deliverDue() {
+	d.mu.Lock()
+	now := time.Now()
+	var due []WebhookDelivery
+	for _, delivery := range d.queue {
+		if !delivery.NextAttempt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	d.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return
+	}
+	secrets := make(map[string]string)
+	for _, target := range config.Webhooks {
+		secrets[target.ID] = target.Secret
+	}
+
+	for _, delivery := range due {
+		// Payloads are never sent unsigned, so deliveries to a target that was
+		// removed, or that has no secret, are dropped
+		secret := secrets[delivery.TargetID]
+		if secret == "" {
+			d.drop(delivery, "webhook target was removed or has no secret")
+			continue
+		}
+		statusCode, err := d.send(delivery, secret)
+		d.recordAttempt(delivery, statusCode, err)
+	}
+}
+
+// send posts a signed payload to a target
+func (d *WebhookDispatcher) send(delivery WebhookDelivery, secret string) (int, error) {
+	req, err := http.NewRequest("POST", delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ThereforeSharer-Webhook")
+	req.Header.Set("X-ThereforeSharer-Event", delivery.Event)
+	req.Header.Set("X-ThereforeSharer-Delivery", delivery.ID)
+	req.Header.Set(webhookSignature, "sha256="+SignWebhookPayload(secret, delivery.Body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("target returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordAttempt logs an attempt and removes or reschedules the delivery
+func (d *WebhookDispatcher) recordAttempt(delivery WebhookDelivery, statusCode int, sendErr error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	attempt := delivery.Attempts + 1
+	entry := WebhookLogEntry{
+		DeliveryID: delivery.ID,
+		TargetID:   delivery.TargetID,
+		URL:        delivery.URL,
+		Event:      delivery.Event,
+		Attempt:    attempt,
+		StatusCode: statusCode,
+		Success:    sendErr == nil,
+		Time:       time.Now().Format(time.RFC3339),
+	}
+	if sendErr != nil {
+		entry.Error = sendErr.Error()
+		entry.GaveUp = attempt >= webhookMaxAttempts
+	}
+
+	for i := range d.queue {
+		if d.queue[i].ID != delivery.ID {
+			continue
+		}
+		if sendErr == nil || entry.GaveUp {
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+		} else {
+			d.queue[i].Attempts = attempt
+			d.queue[i].NextAttempt = time.Now().Add(webhookBackoff(attempt))
+		}
+		break
+	}
+
+	d.log = append(d.log, entry)
+	if len(d.log) > webhookMaxLogEntries {
+		d.log = d.log[len(d.log)-webhookMaxLogEntries:]
+	}
+
+	d.saveQueueLocked()
+	if err := writeJSONFile(webhookDataPath(webhookLogFileName), d.log); err != nil {
+		slog.Error("Failed to save webhook log", "error", err)
+	}
+}
+
+// drop removes a delivery from the queue without sending it, logging why
+func (d *WebhookDispatcher) drop(delivery WebhookDelivery, reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i := range d.queue {
+		if d.queue[i].ID == delivery.ID {
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+			break
+		}
+	}
+	d.log = append(d.log, WebhookLogEntry{
+		DeliveryID: delivery.ID,
+		TargetID:   delivery.TargetID,
+		URL:        delivery.URL,
+		Event:      delivery.Event,
+		Attempt:    delivery.Attempts,
+		Error:      reason,
+		GaveUp:     true,
+		Time:       time.Now().Format(time.RFC3339),
+	})
+	if len(d.log) > webhookMaxLogEntries {
+		d.log = d.log[len(d.log)-webhookMaxLogEntries:]
+	}
+
+	d.saveQueueLocked()
+	if err := writeJSONFile(webhookDataPath(webhookLogFileName), d.log); err != nil {
+		slog.Error("Failed to save webhook log", "error", err)
+	}
+}
+
+// saveQueueLocked persists the queue, the caller must hold d.mu
+func (d *WebhookDispatcher) saveQueueLocked() {
+	if err := writeJSONFile(webhookDataPath(webhookQueueFileName), d.queue); err != nil {
+		slog.Error("Failed to save webhook queue", "error", err)
+	}
+}
+
+// checkExpiredLinks emits link.expired once for every recorded share past its expiry
+func (d *WebhookDispatcher) checkExpiredLinks() {
+	records, err := LoadShareRecords()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, record := range records {
+		if record.ExpiresAt == "" || record.ExpiryNotified {
+			continue
+		}
+		expiresAt, err := time.Parse(time.RFC3339, record.ExpiresAt)
+		if err != nil || expiresAt.After(now) {
+			continue
+		}
+
+		d.Emit(EventLinkExpired, record.EventData())
+		record.ExpiryNotified = true
+		if err := SaveShareRecord(record); err != nil {
+			slog.Error("Failed to update share record", "doc_no", record.DocNo, "error", err)
+		}
+	}
+}
+
+// webhookBackoff returns the delay before the next attempt, doubling from 30 seconds up to an hour
+func webhookBackoff(attempt int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 of a payload
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newRandomID returns a random 128-bit hex identifier
+func newRandomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// readJSONFile unmarshals a JSON file, leaving v untouched if the file doesn't exist
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSONFile marshals v as indented JSON to a file
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// Files written by older versions were readable by everyone
+	return os.Chmod(path, 0600)
+}
@@ -100,24 +100,25 @@ func GetFileNameForUpload(filePaths []string, defaultArchiveName string) string
 	return fmt.Sprintf("%s-%s.zip", defaultArchiveName, timestamp)
 }
 
-// ValidateFiles checks if all provided file paths exist and are readable
-func ValidateFiles(filePaths []string) error {
+// ValidateFiles checks if all provided file paths exist and are readable, then
+// inspects them against the DLP rules
+func ValidateFiles(filePaths []string, rules []DLPRule) (*DLPResult, error) {
 	var totalSize int64
 	for _, path := range filePaths {
 		info, err := os.Stat(path)
 		if err != nil {
 			if os.IsNotExist(err) {
-				return fmt.Errorf("file does not exist: %s", path)
+				return nil, fmt.Errorf("file does not exist: %s", path)
 			}
-			return fmt.Errorf("cannot access file %s: %w", path, err)
+			return nil, fmt.Errorf("cannot access file %s: %w", path, err)
 		}
 		if info.IsDir() {
-			return fmt.Errorf("directories not supported: %s", path)
+			return nil, fmt.Errorf("directories not supported: %s", path)
 		}
 		totalSize += info.Size()
 	}
 
 	// Note: Large files (over 100MB) may take a while to upload
 
-	return nil
+	return InspectFiles(rules, filePaths)
 }